@@ -18,10 +18,13 @@ const (
 	CodeAssertionFailed = 68 // 断言失败（数量不符、语义不符等）
 
 	// 70–79: 程序自身或依赖错误
-	CodeCmdFailed   = 70 // 命令执行失败（catch-all）
-	CodeSSHError    = 71 // SSH 层错误（连接失败、channel 拒绝等）
-	CodeIOError     = 72 // 文件或设备读写失败
-	CodeInternalErr = 74 // 内部 bug、panic、未捕捉异常
+	CodeCmdFailed        = 70 // 命令执行失败（catch-all）
+	CodeSSHError         = 71 // SSH 层错误（连接失败、channel 拒绝等）
+	CodeIOError          = 72 // 文件或设备读写失败
+	CodeHostKeyMismatch  = 73 // 主机密钥和 known_hosts 中的记录不一致（中间人攻击或者主机重装）
+	CodeInternalErr      = 74 // 内部 bug、panic、未捕捉异常
+	CodeHostKeyUnknown   = 75 // 严格校验模式下主机不在 known_hosts 中
+	CodeChecksumMismatch = 76 // 文件传输后两端的校验和不一致
 
 	// 80–89: 外部服务或系统相关错误（可扩展）
 	CodeConfigError = 80 // 配置文件有误或缺失
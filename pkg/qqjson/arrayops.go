@@ -0,0 +1,239 @@
+package qqjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"common_tool/pkg/errorutil"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// -m a 模式的数组操作，值的含义和操作有关
+// append / prepend / insert : 插入的元素
+// remove                    : 删除和值相等的所有元素(按规范化后的 JSON 比较，1 和 1.0 相等)
+// remove-if                 : 删除满足 gjson 查询条件(#(...) 括号中的部分)的元素
+// dedupe                    : 去掉重复的元素，保留第一次出现的，值不使用
+// sort                      : 按值指定的子路径排序，值为空时按元素本身排序
+const (
+	ArrayOpAppend   = "append"
+	ArrayOpPrepend  = "prepend"
+	ArrayOpInsert   = "insert"
+	ArrayOpRemove   = "remove"
+	ArrayOpRemoveIf = "remove-if"
+	ArrayOpDedupe   = "dedupe"
+	ArrayOpSort     = "sort"
+)
+
+// 返回和 setValue / deleteValue 相同签名的操作函数，-P 和 -M 都通过 modifyJSON 使用
+func (opts *CLIOptions) arrayOperation() (func([]byte, string, any) ([]byte, error), error) {
+	switch opts.ArrayOp {
+	case ArrayOpAppend:
+		return appendValue, nil
+	case ArrayOpPrepend:
+		return func(jsonData []byte, path string, value any) ([]byte, error) {
+			return updateArray(jsonData, path, func(items []string) ([]string, error) {
+				return insertItem(items, 0, value)
+			})
+		}, nil
+	case ArrayOpInsert:
+		return func(jsonData []byte, path string, value any) ([]byte, error) {
+			return updateArray(jsonData, path, func(items []string) ([]string, error) {
+				// 负数从末尾计算，-1 表示末尾
+				index := opts.ArrayIndex
+				if index < 0 {
+					index += len(items) + 1
+				}
+				if index < 0 || index > len(items) {
+					return nil, fmt.Errorf("下标 %d 超出范围，数组长度为 %d", opts.ArrayIndex, len(items))
+				}
+				return insertItem(items, index, value)
+			})
+		}, nil
+	case ArrayOpRemove:
+		return func(jsonData []byte, path string, value any) ([]byte, error) {
+			target, err := canonicalValue(value)
+			if err != nil {
+				return nil, err
+			}
+			return updateArray(jsonData, path, func(items []string) ([]string, error) {
+				return filterItems(items, func(item string) (bool, error) {
+					c, err := canonicalJSON([]byte(item))
+					return string(c) != target, err
+				})
+			})
+		}, nil
+	case ArrayOpRemoveIf:
+		return func(jsonData []byte, path string, value any) ([]byte, error) {
+			cond, ok := value.(string)
+			if !ok || cond == "" {
+				return nil, fmt.Errorf("remove-if 的值必须是 gjson 的查询条件")
+			}
+			return updateArray(jsonData, path, func(items []string) ([]string, error) {
+				return filterItems(items, func(item string) (bool, error) {
+					return !matchCondition([]byte(item), cond), nil
+				})
+			})
+		}, nil
+	case ArrayOpDedupe:
+		return func(jsonData []byte, path string, _ any) ([]byte, error) {
+			return updateArray(jsonData, path, func(items []string) ([]string, error) {
+				seen := map[string]bool{}
+				return filterItems(items, func(item string) (bool, error) {
+					c, err := canonicalJSON([]byte(item))
+					if err != nil || seen[string(c)] {
+						return false, err
+					}
+					seen[string(c)] = true
+					return true, nil
+				})
+			})
+		}, nil
+	case ArrayOpSort:
+		return func(jsonData []byte, path string, value any) ([]byte, error) {
+			key, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("sort 的值必须是子路径字符串")
+			}
+			return updateArray(jsonData, path, func(items []string) ([]string, error) {
+				return sortItems(items, key, opts.Descending)
+			})
+		}, nil
+	default:
+		return nil, fmt.Errorf("未知的数组操作: %q，请使用 append / prepend / insert / remove / remove-if / dedupe / sort", opts.ArrayOp)
+	}
+}
+
+// 路径不存在时按空数组处理，存在但不是数组时报错
+func arrayItems(jsonData []byte, path string) ([]string, error) {
+	res := gjson.ParseBytes(jsonData)
+	if path != "" {
+		res = gjson.GetBytes(jsonData, path)
+	}
+	if !res.Exists() {
+		return []string{}, nil
+	}
+	if !res.IsArray() {
+		err := fmt.Errorf("路径 %q 的值不是数组", path)
+		return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, err.Error(), err)
+	}
+
+	items := []string{}
+	res.ForEach(func(_, v gjson.Result) bool {
+		items = append(items, v.Raw)
+		return true
+	})
+	return items, nil
+}
+
+// 元素以原始的 JSON 片段处理，没有改动的元素保持原来的写法
+func updateArray(jsonData []byte, path string, fn func([]string) ([]string, error)) ([]byte, error) {
+	items, err := arrayItems(jsonData, path)
+	if err != nil {
+		return nil, err
+	}
+	if items, err = fn(items); err != nil {
+		return nil, err
+	}
+
+	raw := "[" + strings.Join(items, ",") + "]"
+	if path == "" {
+		return []byte(raw), nil
+	}
+	return sjson.SetRawBytes(jsonData, path, []byte(raw))
+}
+
+// 先确认目标是数组(或者不存在)再使用 sjson 的 -1 下标追加
+// 否则对象上的 -1 会被当成普通的键写入
+func appendValue(jsonData []byte, path string, value any) ([]byte, error) {
+	if _, err := arrayItems(jsonData, path); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return updateArray(jsonData, path, func(items []string) ([]string, error) {
+			return insertItem(items, len(items), value)
+		})
+	}
+	return sjson.SetBytes(jsonData, path+".-1", value)
+}
+
+func insertItem(items []string, index int, value any) ([]string, error) {
+	data, err := marshalJSON(rawValue(value))
+	if err != nil {
+		return nil, fmt.Errorf("无法编码插入的值: %w", err)
+	}
+	out := make([]string, 0, len(items)+1)
+	out = append(out, items[:index]...)
+	out = append(out, string(data))
+	return append(out, items[index:]...), nil
+}
+
+func filterItems(items []string, keep func(string) (bool, error)) ([]string, error) {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		ok, err := keep(item)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, item)
+		}
+	}
+	return out, nil
+}
+
+// 排序规则和 -m q 的 sort_by 相同: null < false < true < 数字 < 字符串 < 数组 < 对象
+// 没有子路径的元素按 null 处理，相同的元素保持原来的顺序
+func sortItems(items []string, key string, descending bool) ([]string, error) {
+	keys := make([]any, len(items))
+	for i, item := range items {
+		raw := item
+		if key != "" {
+			res := gjson.Get(item, key)
+			if !res.Exists() {
+				continue
+			}
+			raw = res.Raw
+		}
+		if err := json.Unmarshal([]byte(raw), &keys[i]); err != nil {
+			return nil, fmt.Errorf("无法解析元素 %s: %w", item, err)
+		}
+	}
+
+	idx := make([]int, len(items))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		c := compareQueryValues(keys[idx[a]], keys[idx[b]])
+		if descending {
+			return c > 0
+		}
+		return c < 0
+	})
+	out := make([]string, len(items))
+	for i, j := range idx {
+		out[i] = items[j]
+	}
+	return out, nil
+}
+
+func canonicalValue(value any) (string, error) {
+	data, err := marshalJSON(rawValue(value))
+	if err != nil {
+		return "", err
+	}
+	c, err := canonicalJSON(data)
+	return string(c), err
+}
+
+// -o 读入的文件内容是 []byte，按字符串写入，而不是像 encoding/json 那样编码成 base64
+func rawValue(value any) any {
+	if data, ok := value.([]byte); ok {
+		return string(data)
+	}
+	return value
+}
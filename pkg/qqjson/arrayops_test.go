@@ -0,0 +1,62 @@
+package qqjson
+
+import (
+	"errors"
+	"testing"
+
+	"common_tool/pkg/errorutil"
+)
+
+func TestArrayOperation(t *testing.T) {
+	tests := []struct {
+		op    string
+		index int
+		input string
+		path  string
+		value any
+		want  string
+	}{
+		{ArrayOpAppend, 0, `{"l":[1]}`, "l", 2.0, `{"l":[1,2]}`},
+		{ArrayOpAppend, 0, `[1]`, "", "x", `[1,"x"]`},
+		{ArrayOpAppend, 0, `{}`, "l", 1.0, `{"l":[1]}`},
+		// -o 读入的文件内容按字符串写入
+		{ArrayOpPrepend, 0, `{"l":[1]}`, "l", []byte("hi\n"), `{"l":["hi\n",1]}`},
+		{ArrayOpInsert, -1, `[1,2]`, "", []byte("x"), `[1,2,"x"]`},
+		{ArrayOpInsert, 1, `[1, 2.50]`, "", 9.0, `[1,9,2.50]`},
+		{ArrayOpRemove, 0, `["x",1,"x",1.0]`, "", []byte("x"), `[1,1.0]`},
+		{ArrayOpRemove, 0, `[1,2,1.0]`, "", 1.0, `[2]`},
+		{ArrayOpRemoveIf, 0, `[{"a":1},{"a":2}]`, "", "a>1", `[{"a":1}]`},
+		{ArrayOpDedupe, 0, `[1,{"a":1},1.0,{"a":1}]`, "", nil, `[1,{"a":1}]`},
+		{ArrayOpSort, 0, `[{"n":2},{"n":1},{}]`, "", "n", `[{},{"n":1},{"n":2}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			opts := &CLIOptions{ArrayOp: tt.op, ArrayIndex: tt.index}
+			fn, err := opts.arrayOperation()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := fn([]byte(tt.input), tt.path, tt.value)
+			if err != nil {
+				t.Fatalf("%s 失败: %v", tt.op, err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("%s %s = %s，期望 %s", tt.op, tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArrayOperationNotArray(t *testing.T) {
+	for _, tt := range []struct{ input, path string }{
+		{`{"a":1}`, ""},
+		{`{"a":1}`, "a"},
+	} {
+		_, err := appendValue([]byte(tt.input), tt.path, 1.0)
+		var exitErr *errorutil.ExitErrorWithCode
+		if !errors.As(err, &exitErr) || exitErr.Code != errorutil.CodeInvalidData {
+			t.Errorf("%s 路径 %q 不是数组，错误 = %v，期望退出码 %d", tt.input, tt.path, err, errorutil.CodeInvalidData)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package qqjson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"common_tool/pkg/errorutil"
+	"common_tool/pkg/sh"
+)
+
+// 批处理脚本中支持的操作
+const (
+	BatchOpSet     = "set"
+	BatchOpSetJSON = "set-json"
+	BatchOpDelete  = "delete"
+	BatchOpRead    = "read"
+)
+
+// 批处理中的一条操作，Path 和 -P 参数一样是未转义的路径片段
+type batchOp struct {
+	Op    string
+	Path  []string
+	Value any
+}
+
+// JSON 数组格式的脚本中的单个元素
+// [{"op": "set", "path": ["a", "b"], "value": "x"}]
+type batchOpJSON struct {
+	Op    string          `json:"op"`
+	Path  []string        `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// 读取批处理脚本，"" 或者 "-" 表示从标准输入读取
+func (opts *CLIOptions) readBatchScript() ([]byte, error) {
+	if opts.ScriptFile == "" || opts.ScriptFile == "-" {
+		if opts.Kind != "file" && opts.Kind != "str" {
+			return nil, fmt.Errorf("JSON 和批处理脚本不能同时从标准输入读取")
+		}
+		return io.ReadAll(os.Stdin)
+	}
+
+	data, err := os.ReadFile(opts.ScriptFile)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取脚本文件 %s: %w", opts.ScriptFile, err)
+	}
+	return data, nil
+}
+
+// 解析批处理脚本，以 [ 开头的按 JSON 数组解析，否则按行解析
+func parseBatchScript(script []byte) ([]batchOp, error) {
+	trimmed := bytes.TrimSpace(script)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		return parseBatchJSON(trimmed)
+	}
+	return parseBatchLines(script)
+}
+
+func parseBatchJSON(script []byte) ([]batchOp, error) {
+	var items []batchOpJSON
+	if err := json.Unmarshal(script, &items); err != nil {
+		return nil, fmt.Errorf("无效的批处理 JSON 脚本: %w", err)
+	}
+
+	ops := make([]batchOp, 0, len(items))
+	for i, item := range items {
+		op := batchOp{Op: item.Op, Path: item.Path}
+		switch item.Op {
+		case BatchOpSet:
+			var s string
+			if err := json.Unmarshal(item.Value, &s); err != nil {
+				return nil, fmt.Errorf("第 %d 条操作的 value 必须是字符串: %w", i+1, err)
+			}
+			op.Value = s
+		case BatchOpSetJSON:
+			var v any
+			if err := json.Unmarshal(item.Value, &v); err != nil {
+				return nil, fmt.Errorf("第 %d 条操作的 value 不是有效的 JSON: %w", i+1, err)
+			}
+			op.Value = v
+		case BatchOpDelete, BatchOpRead:
+		default:
+			return nil, fmt.Errorf("第 %d 条操作未知: %q", i+1, item.Op)
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// 按行解析，每行按 Bash 规则拆分单词，空行和 # 开头的行忽略
+//
+//	set      <字符串值> <路径片段>...
+//	set-json <JSON值>   <路径片段>...
+//	delete   <路径片段>...
+//	read     [路径片段]...
+func parseBatchLines(script []byte) ([]batchOp, error) {
+	var ops []batchOp
+
+	scanner := bufio.NewScanner(bytes.NewReader(script))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(script)+1)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		words, err := sh.SplitWords(line)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行解析失败: %w", lineNo, err)
+		}
+
+		op := batchOp{Op: words[0]}
+		args := words[1:]
+		switch op.Op {
+		case BatchOpSet, BatchOpSetJSON:
+			if len(args) < 2 {
+				return nil, fmt.Errorf("第 %d 行缺少值或路径: %s", lineNo, line)
+			}
+			op.Path = args[1:]
+			if op.Op == BatchOpSet {
+				op.Value = args[0]
+			} else {
+				var v any
+				if err := json.Unmarshal([]byte(args[0]), &v); err != nil {
+					return nil, fmt.Errorf("第 %d 行的值不是有效的 JSON: %w", lineNo, err)
+				}
+				op.Value = v
+			}
+		case BatchOpDelete, BatchOpRead:
+			op.Path = args
+		default:
+			return nil, fmt.Errorf("第 %d 行操作未知: %q", lineNo, op.Op)
+		}
+		ops = append(ops, op)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取批处理脚本失败: %w", err)
+	}
+	return ops, nil
+}
+
+// 在同一份内存中的 JSON 上依次执行所有操作，有修改的时候最后只写一次
+func (opts *CLIOptions) runBatch() error {
+	formatter, err := opts.formatter()
+	if err != nil {
+		return err
+	}
+
+	script, err := opts.readBatchScript()
+	if err != nil {
+		return err
+	}
+
+	ops, err := parseBatchScript(script)
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "批处理脚本格式错误", err)
+	}
+
+	unlock, err := opts.lockTarget()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	jsonData, err := opts.loadTarget()
+	if err != nil {
+		return err
+	}
+
+	doc := opts.document(jsonData)
+	modified := false
+	for i, op := range ops {
+		path := qJsonEscapeAndJoin(op.Path)
+
+		switch op.Op {
+		case BatchOpSet, BatchOpSetJSON:
+			err = doc.Set(path, op.Value)
+			modified = true
+		case BatchOpDelete:
+			err = doc.Delete(path)
+			modified = true
+		case BatchOpRead:
+			err = opts.batchRead(formatter, doc.Bytes(), path)
+		}
+
+		if err != nil {
+			return fmt.Errorf("第 %d 条操作 %s %q 失败: %w", i+1, op.Op, path, err)
+		}
+	}
+
+	if !modified {
+		return nil
+	}
+	return opts.storeTarget(doc.Bytes())
+}
+
+// 批处理中的读取，和 --lines 一样每个结果占一行(shtree 是一组 declare 语句)
+// 类型码无法通过退出码返回，type 格式直接打印类型码
+func (opts *CLIOptions) batchRead(formatter OutputFormatter, jsonData []byte, path string) error {
+	value, err := opts.document(jsonData).Get(path)
+	if err != nil {
+		return err
+	}
+	return opts.writeLineResult(os.Stdout, formatter, value.res)
+}
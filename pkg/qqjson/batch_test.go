@@ -0,0 +1,131 @@
+package qqjson
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestParseBatchScript(t *testing.T) {
+	want := []batchOp{
+		{Op: BatchOpSet, Path: []string{"devices", "r1.lab", "user"}, Value: "admin user"},
+		{Op: BatchOpSetJSON, Path: []string{"devices", "r1.lab", "ports"}, Value: []any{float64(22), "x"}},
+		{Op: BatchOpDelete, Path: []string{"old"}},
+		{Op: BatchOpRead, Path: nil},
+		{Op: BatchOpSet, Path: []string{"msg"}, Value: "it's\n"},
+	}
+
+	scripts := map[string]string{
+		"按行": `# 注释
+set 'admin user' devices r1.lab user
+
+  set-json '[22, "x"]' devices "r1.lab" ports
+delete old
+read
+set $'it\'s\n' msg
+`,
+		"JSON 数组": ` [
+	{"op": "set", "path": ["devices", "r1.lab", "user"], "value": "admin user"},
+	{"op": "set-json", "path": ["devices", "r1.lab", "ports"], "value": [22, "x"]},
+	{"op": "delete", "path": ["old"]},
+	{"op": "read"},
+	{"op": "set", "path": ["msg"], "value": "it's\n"}
+]`,
+	}
+	for name, script := range scripts {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseBatchScript([]byte(script))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 没有路径的 read 两种写法分别得到 nil 和空切片
+			for i := range got {
+				if len(got[i].Path) == 0 {
+					got[i].Path = nil
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("结果 = %#v\n期望   %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseBatchScriptErrors(t *testing.T) {
+	for _, script := range []string{
+		"set onlyvalue",
+		"set-json {bad a",
+		"set-json '{bad' a",
+		"rename a b",
+		"set 'a b",
+		`[{"op": "set", "path": ["a"], "value": 1}]`,
+		`[{"op": "set-json", "path": ["a"], "value": }]`,
+		`[{"op": "move", "path": ["a"]}]`,
+	} {
+		if ops, err := parseBatchScript([]byte(script)); err == nil {
+			t.Errorf("%q 应该报错，得到 %+v", script, ops)
+		}
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "a.json")
+	run := func(script string) error {
+		scriptFile := filepath.Join(dir, "script")
+		if err := os.WriteFile(scriptFile, []byte(script), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		opts := &CLIOptions{Kind: "file", InArg: target, ScriptFile: scriptFile, Format: "txt", JSONFormat: JSONFormatRaw}
+		return opts.runBatch()
+	}
+
+	const original = `{"a":1}`
+	if err := os.WriteFile(target, []byte(original), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 中间的操作失败时前面的修改也不写回
+	if err := run("set x b\nread missing\nset y c\n"); err == nil {
+		t.Fatal("读取不存在的路径应该失败")
+	}
+	if got, _ := os.ReadFile(target); string(got) != original {
+		t.Errorf("失败后文件被修改: %s", got)
+	}
+
+	if err := run("set x b\nset-json [1] c d\ndelete a\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(target); string(got) != `{"b":"x","c":{"d":[1]}}` {
+		t.Errorf("文件 = %s", got)
+	}
+}
+
+func TestWriteLineResult(t *testing.T) {
+	res := gjson.Parse(`{"a":[1,"x"]}`)
+	tests := []struct {
+		formatter  OutputFormatter
+		jsonFormat JSONFormat
+		want       string
+	}{
+		{TextFormatter{}, JSONFormatMul, "{\n    \"a\": [\n        1,\n        \"x\"\n    ]\n}\n"},
+		{TextFormatter{}, JSONFormatOne, `{"a":[1,"x"]}` + "\n"},
+		{BashFormatter{}, JSONFormatMul, "[$'a']=$'a:[1,\"x\"]'\n"},
+		{TypeFormatter{}, JSONFormatMul, "7\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		opts := &CLIOptions{JSONFormat: tt.jsonFormat}
+		if err := opts.writeLineResult(&buf, tt.formatter, res); err != nil {
+			t.Fatal(err)
+		}
+		// 每个结果只有一个换行，while read 可以逐个读取
+		if buf.String() != tt.want {
+			t.Errorf("%T %s = %q，期望 %q", tt.formatter, tt.jsonFormat, buf.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package qqjson
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"common_tool/pkg/errorutil"
+)
+
+// RFC 8785 JSON Canonicalization Scheme (JCS)
+// 1. 没有空白
+// 2. 对象的键按 UTF-16 编码单元排序
+// 3. 数字按 ECMAScript 的 Number.prototype.toString 输出(1.0 -> 1，1e2 -> 100)
+// 4. 字符串只转义 " \ 和控制字符，其它字符原样输出
+func canonicalJSON(data []byte) ([]byte, error) {
+	doc, err := decodeJSONDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, v any) error {
+	switch val := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(val))
+	case json.Number:
+		f, err := strconv.ParseFloat(val.String(), 64)
+		if err != nil {
+			return fmt.Errorf("数字超出范围: %s", val)
+		}
+		s, err := canonicalNumber(f)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+	case string:
+		writeCanonicalString(buf, val)
+	case []any:
+		buf.WriteByte('[')
+		for i, item := range val {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]any:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return lessUTF16(keys[i], keys[j]) })
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, k)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, val[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("不支持的类型: %T", v)
+	}
+	return nil
+}
+
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// ECMAScript 的数字格式: 最短的能还原的有效数字，
+// 小数点位置在 (-6, 21] 之间用普通写法，其它用 1e+21 这样的指数写法
+func canonicalNumber(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("JSON 不支持的数值: %v", f)
+	}
+	if f == 0 {
+		return "0", nil
+	}
+
+	sign := ""
+	if f < 0 {
+		sign = "-"
+		f = -f
+	}
+
+	// d.ddde±x 形式，digits 是所有的有效数字，n 是小数点的位置
+	mantissa, expStr, _ := strings.Cut(strconv.FormatFloat(f, 'e', -1, 64), "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	exp, _ := strconv.Atoi(expStr)
+	n := exp + 1
+	k := len(digits)
+
+	var s string
+	switch {
+	case k <= n && n <= 21:
+		s = digits + strings.Repeat("0", n-k)
+	case 0 < n && n <= 21:
+		s = digits[:n] + "." + digits[n:]
+	case -6 < n && n <= 0:
+		s = "0." + strings.Repeat("0", -n) + digits
+	default:
+		e := n - 1
+		expSign := "+"
+		if e < 0 {
+			expSign = "-"
+			e = -e
+		}
+		s = digits[:1]
+		if k > 1 {
+			s += "." + digits[1:]
+		}
+		s += "e" + expSign + strconv.Itoa(e)
+	}
+	return sign + s, nil
+}
+
+// 输出规范化 JSON 的 SHA-256，-p/-P 指定时只计算对应的子树
+// 键的顺序、空白、数字的写法(1 / 1.0 / 1e0)不影响结果
+func (opts *CLIOptions) hashJSON() error {
+	raw, err := opts.readDocument()
+	if err != nil {
+		return err
+	}
+	value, err := opts.document(raw).Get(opts.Path)
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, err.Error(), err)
+	}
+
+	canonical, err := canonicalJSON([]byte(value.Raw))
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "无法规范化 JSON", err)
+	}
+
+	sum := sha256.Sum256(canonical)
+	fmt.Println(hex.EncodeToString(sum[:]))
+	return nil
+}
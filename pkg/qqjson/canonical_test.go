@@ -0,0 +1,134 @@
+package qqjson
+
+import (
+	"io"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+// RFC 8785 附录 B 的数字，按 IEEE 754 的位表示给出
+func TestCanonicalNumber(t *testing.T) {
+	tests := []struct {
+		bits uint64
+		want string
+	}{
+		{0x0000000000000000, "0"},
+		{0x8000000000000000, "0"},
+		{0x0000000000000001, "5e-324"},
+		{0x8000000000000001, "-5e-324"},
+		{0x7fefffffffffffff, "1.7976931348623157e+308"},
+		{0xffefffffffffffff, "-1.7976931348623157e+308"},
+		{0x4340000000000000, "9007199254740992"},
+		{0xc340000000000000, "-9007199254740992"},
+		{0x4430000000000000, "295147905179352830000"},
+		{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+		{0x44b52d02c7e14af6, "1e+23"},
+		{0x44b52d02c7e14af7, "1.0000000000000001e+23"},
+		{0x444b1ae4d6e2ef4e, "999999999999999700000"},
+		{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+		{0x444b1ae4d6e2ef50, "1e+21"},
+		{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+		{0x3eb0c6f7a0b5ed8d, "0.000001"},
+		{0x41b3de4355555553, "333333333.3333332"},
+		{0x41b3de4355555554, "333333333.33333325"},
+		{0x41b3de4355555555, "333333333.3333333"},
+		{0x41b3de4355555556, "333333333.3333334"},
+		{0x41b3de4355555557, "333333333.33333343"},
+		{0xbecbf647612f3696, "-0.0000033333333333333333"},
+		{0x43143ff3c1cb0959, "1424953923781206.2"},
+	}
+	for _, tt := range tests {
+		f := math.Float64frombits(tt.bits)
+		got, err := canonicalNumber(f)
+		if err != nil {
+			t.Errorf("%016x 失败: %v", tt.bits, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%016x = %s，期望 %s", tt.bits, got, tt.want)
+		}
+	}
+
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := canonicalNumber(f); err == nil {
+			t.Errorf("%v 应该报错", f)
+		}
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"数字的写法", `[1e21, 1e-7, 1.0, 1e0, -0, 0.1e1, 100E-2, 5e-324]`,
+			`[1e+21,1e-7,1,1,0,1,1,5e-324]`},
+		// RFC 8785 3.2.3 的例子，😀 是代理对 D83D DE00，按 UTF-16 排在 U+FB33 之前
+		{"键按 UTF-16 排序", `{"\u20ac":"Euro Sign","\r":"Carriage Return","\ufb33":"Hebrew Letter Dalet With Dagesh","1":"One","\ud83d\ude00":"Emoji: Grinning Face","\u0080":"Control","\u00f6":"Latin Small Letter O With Diaeresis"}`,
+			"{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"\u00f6\":\"Latin Small Letter O With Diaeresis\"," +
+				"\"\u20ac\":\"Euro Sign\",\"\U0001F600\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}"},
+		{"字符串转义", `{"s":"\u0041\"\\\/\b\u001f\u007f<>&é"}`, "{\"s\":\"A\\\"\\\\/\\b\\u001f\u007f<>&é\"}"},
+		{"空白", " { \"b\" : [ ] , \"a\" : { } } ", `{"a":{},"b":[]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalJSON([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("结果 = %s\n期望   %s", got, tt.want)
+			}
+		})
+	}
+
+	if !lessUTF16("\U0001F600", "\uFB33") || lessUTF16("\uFB33", "\U0001F600") {
+		t.Errorf("辅助平面的字符应该按代理对排在 U+FB33 之前")
+	}
+	if _, err := canonicalJSON([]byte(`[1e400]`)); err == nil {
+		t.Errorf("超出 float64 范围的数字应该报错")
+	}
+}
+
+// 执行 fn，返回它输出到标准输出的内容
+func captureStdout(t *testing.T, fn func() error) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	errFn := fn()
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+	if errFn != nil {
+		t.Fatal(errFn)
+	}
+	return string(out)
+}
+
+func TestHashJSON(t *testing.T) {
+	var first string
+	for _, in := range []string{`{"a":1,"b":[true]}`, `{"b":[true],"a":1.0}`, "{ \"a\": 1e0,\n \"b\": [ true ] }"} {
+		opts := &CLIOptions{Kind: "str", InArg: in}
+		sum := strings.TrimSpace(captureStdout(t, opts.hashJSON))
+		if len(sum) != 64 {
+			t.Fatalf("%s 的摘要 = %q", in, sum)
+		}
+		if first == "" {
+			first = sum
+		} else if sum != first {
+			t.Errorf("%s 的摘要 = %s，期望和第一个相同 %s", in, sum, first)
+		}
+	}
+
+	opts := &CLIOptions{Kind: "str", InArg: `{"a":2,"b":[true]}`}
+	if sum := strings.TrimSpace(captureStdout(t, opts.hashJSON)); sum == first {
+		t.Errorf("不同的文档摘要相同")
+	}
+}
@@ -0,0 +1,502 @@
+package qqjson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// 输入输出的文件格式，内部统一转换成 JSON 处理
+type DataFormat string
+
+const (
+	DataFormatJSON DataFormat = "json"
+	DataFormatYAML DataFormat = "yaml"
+	DataFormatTOML DataFormat = "toml"
+	DataFormatINI  DataFormat = "ini"
+	// 带注释、结尾逗号等扩展写法的 JSON，修改时保留原来的注释和格式
+	DataFormatJSON5 DataFormat = "json5"
+)
+
+func (f *DataFormat) String() string { return string(*f) }
+
+func (f *DataFormat) Set(val string) error {
+	switch val {
+	case string(DataFormatJSON),
+		string(DataFormatYAML),
+		string(DataFormatTOML),
+		string(DataFormatINI),
+		string(DataFormatJSON5):
+		*f = DataFormat(val)
+		return nil
+	case "yml":
+		*f = DataFormatYAML
+		return nil
+	case "jsonc":
+		*f = DataFormatJSON5
+		return nil
+	default:
+		return fmt.Errorf("无效的文件格式: %s", val)
+	}
+}
+
+func (f *DataFormat) Type() string {
+	return "dataformat"
+}
+
+// 列出所有的合法值
+func (DataFormat) Values() []string {
+	return []string{
+		string(DataFormatJSON),
+		string(DataFormatYAML),
+		string(DataFormatTOML),
+		string(DataFormatINI),
+		string(DataFormatJSON5),
+	}
+}
+
+// 输入格式，没有指定 --in-format 的时候按文件扩展名判断，其它情况都是 JSON
+func (opts *CLIOptions) inFormat() DataFormat {
+	if opts.InFormat != "" {
+		return opts.InFormat
+	}
+	if opts.Kind == "file" {
+		return formatOfFile(opts.InArg)
+	}
+	return DataFormatJSON
+}
+
+// 按文件扩展名判断格式，不认识的扩展名都按 JSON 处理
+func formatOfFile(path string) DataFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return DataFormatYAML
+	case ".toml":
+		return DataFormatTOML
+	case ".ini":
+		return DataFormatINI
+	case ".json5", ".jsonc":
+		return DataFormatJSON5
+	}
+	return DataFormatJSON
+}
+
+// 输出格式，没有指定 --out-format 的时候和输入格式相同
+func (opts *CLIOptions) outFormat() DataFormat {
+	if opts.OutFormat != "" {
+		return opts.OutFormat
+	}
+	return opts.inFormat()
+}
+
+// 读取输入并转换成 JSON，用于所有需要解析文档的模式
+func (opts *CLIOptions) readDocument() ([]byte, error) {
+	raw, err := opts.readInput()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := convertToJSON(raw, opts.inFormat())
+	if err != nil || !opts.Decrypt {
+		return doc, err
+	}
+	return opts.decryptDocument(doc)
+}
+
+// 把 format 格式的数据转换成 JSON，空内容保持为空，交给 sjson 当作空对象处理
+func convertToJSON(data []byte, format DataFormat) ([]byte, error) {
+	if format == DataFormatJSON || len(bytes.TrimSpace(data)) == 0 {
+		return data, nil
+	}
+
+	var v any
+	switch format {
+	case DataFormatJSON5:
+		doc, err := parseJSON5(data)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 JSON5 内容: %w", err)
+		}
+		return doc.json, nil
+	case DataFormatYAML:
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("无效的 YAML 内容: %w", err)
+		}
+	case DataFormatTOML:
+		m := map[string]any{}
+		if _, err := toml.Decode(string(data), &m); err != nil {
+			return nil, fmt.Errorf("无效的 TOML 内容: %w", err)
+		}
+		v = m
+	case DataFormatINI:
+		m, err := parseINI(data)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 INI 内容: %w", err)
+		}
+		v = m
+	default:
+		return nil, fmt.Errorf("不支持的输入格式: %s", format)
+	}
+
+	normalized, err := normalizeToJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	return marshalJSON(normalized)
+}
+
+// 把 JSON 转换成 format 格式，JSON 本身就是合法的 JSON5
+// times 是原始输入中的时间(见 collectTimes)，没有修改过的时间按原来的类型写回，可以为 nil
+func convertFromJSON(data []byte, format DataFormat, times map[string]timeValue) ([]byte, error) {
+	if format == DataFormatJSON || format == DataFormatJSON5 {
+		return data, nil
+	}
+
+	var v any = map[string]any{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		doc, err := decodeJSONDocument(data)
+		if err != nil {
+			return nil, fmt.Errorf("内容不是有效的 JSON: %w", err)
+		}
+		v = toNative(doc, nil, times, format)
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case DataFormatYAML:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return nil, fmt.Errorf("转换成 YAML 失败: %w", err)
+		}
+		if err := enc.Close(); err != nil {
+			return nil, fmt.Errorf("转换成 YAML 失败: %w", err)
+		}
+	case DataFormatTOML:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("TOML 的顶层必须是对象")
+		}
+		if err := toml.NewEncoder(&buf).Encode(m); err != nil {
+			return nil, fmt.Errorf("转换成 TOML 失败: %w", err)
+		}
+	case DataFormatINI:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("INI 的顶层必须是对象")
+		}
+		if err := writeINI(&buf, m); err != nil {
+			return nil, fmt.Errorf("转换成 INI 失败: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("不支持的输出格式: %s", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// YAML / TOML 解码出来的值转换成 encoding/json 能处理的类型
+// YAML 中非字符串的键转换成字符串，时间转换成 RFC 3339 字符串
+func normalizeToJSON(v any) (any, error) {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			n, err := normalizeToJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			val[k] = n
+		}
+		return val, nil
+	case map[any]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			n, err := normalizeToJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			out[fmt.Sprint(k)] = n
+		}
+		return out, nil
+	case []any:
+		for i, item := range val {
+			n, err := normalizeToJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			val[i] = n
+		}
+		return val, nil
+	case []map[string]any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			n, err := normalizeToJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = n
+		}
+		return out, nil
+	case float64:
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return nil, fmt.Errorf("JSON 不支持的数值: %v", val)
+		}
+		return val, nil
+	case time.Time:
+		// TOML 中没有时区的日期和时间用特殊名字的 Location 标记
+		switch val.Location().String() {
+		case "date-local":
+			return val.Format(time.DateOnly), nil
+		case "time-local":
+			return val.Format("15:04:05.999999999"), nil
+		case "datetime-local":
+			return val.Format("2006-01-02T15:04:05.999999999"), nil
+		}
+		return val.Format(time.RFC3339Nano), nil
+	default:
+		return val, nil
+	}
+}
+
+// json.Number 转换成 numberText，保留原来的文本，否则 YAML / TOML 会把它当成字符串输出
+// 原始输入中是时间、现在还是同样的字符串的值恢复成时间
+func toNative(v any, path []string, times map[string]timeValue, format DataFormat) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			val[k] = toNative(item, appendPath(path, k), times, format)
+		}
+		return val
+	case []any:
+		for i, item := range val {
+			val[i] = toNative(item, appendPath(path, strconv.Itoa(i)), times, format)
+		}
+		return val
+	case json.Number:
+		return numberText(val)
+	case string:
+		if t, ok := times[jsonPointer(path)]; ok && t.normalized == val {
+			return t.native(format)
+		}
+		return val
+	default:
+		return val
+	}
+}
+
+// 保留 JSON 原文的数字，输出 YAML / TOML 时原样写出，不经过 float64，
+// 超出 int64 的大整数和 1.10 这样的写法都不会改变
+type numberText string
+
+func (n numberText) isInteger() bool {
+	return !strings.ContainsAny(string(n), ".eE")
+}
+
+func (n numberText) MarshalYAML() (any, error) {
+	tag := "!!float"
+	if n.isInteger() {
+		tag = "!!int"
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: string(n)}, nil
+}
+
+// TOML 的整数只能是 64 位有符号整数，超出时报错而不是转换成浮点数丢掉精度
+func (n numberText) MarshalTOML() ([]byte, error) {
+	if n.isInteger() {
+		if _, err := strconv.ParseInt(string(n), 10, 64); err != nil {
+			return nil, fmt.Errorf("TOML 不支持超出 int64 范围的整数: %s", n)
+		}
+	}
+	return []byte(n), nil
+}
+
+// 原始输入中的时间，JSON 中只能表示为字符串(normalized，和 normalizeToJSON 的结果相同)
+// text 是 YAML 中原来的写法，比如 2024-01-02，TOML 的时间本身带有日期/时间/时区的类型
+type timeValue struct {
+	t          time.Time
+	text       string
+	normalized string
+}
+
+func (t timeValue) native(format DataFormat) any {
+	if format == DataFormatYAML && t.text != "" {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!timestamp", Value: t.text}
+	}
+	return t.t
+}
+
+// 收集 YAML / TOML 原始输入中所有的时间，key 是 JSON Pointer
+// 写回时只修改了其它键的情况下，这些时间不会变成带引号的字符串
+func collectTimes(data []byte, format DataFormat) map[string]timeValue {
+	times := map[string]timeValue{}
+	add := func(path []string, t time.Time, text string) {
+		normalized, _ := normalizeToJSON(t)
+		s, _ := normalized.(string)
+		times[jsonPointer(path)] = timeValue{t: t, text: text, normalized: s}
+	}
+
+	switch format {
+	case DataFormatYAML:
+		var root yaml.Node
+		if yaml.Unmarshal(data, &root) == nil {
+			collectYAMLTimes(&root, nil, add, 0)
+		}
+	case DataFormatTOML:
+		m := map[string]any{}
+		if _, err := toml.Decode(string(data), &m); err == nil {
+			collectTOMLTimes(m, nil, add)
+		}
+	}
+	return times
+}
+
+func collectYAMLTimes(node *yaml.Node, path []string, add func([]string, time.Time, string), depth int) {
+	// 防止锚点的循环引用
+	if node == nil || depth > maxSchemaDepth {
+		return
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, c := range node.Content {
+			collectYAMLTimes(c, path, add, depth+1)
+		}
+	case yaml.AliasNode:
+		collectYAMLTimes(node.Alias, path, add, depth+1)
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			collectYAMLTimes(node.Content[i+1], appendPath(path, node.Content[i].Value), add, depth+1)
+		}
+	case yaml.SequenceNode:
+		for i, c := range node.Content {
+			collectYAMLTimes(c, appendPath(path, strconv.Itoa(i)), add, depth+1)
+		}
+	case yaml.ScalarNode:
+		var t time.Time
+		if node.ShortTag() == "!!timestamp" && node.Decode(&t) == nil {
+			add(path, t, node.Value)
+		}
+	}
+}
+
+func collectTOMLTimes(v any, path []string, add func([]string, time.Time, string)) {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			collectTOMLTimes(item, appendPath(path, k), add)
+		}
+	case []map[string]any:
+		for i, item := range val {
+			collectTOMLTimes(item, appendPath(path, strconv.Itoa(i)), add)
+		}
+	case []any:
+		for i, item := range val {
+			collectTOMLTimes(item, appendPath(path, strconv.Itoa(i)), add)
+		}
+	case time.Time:
+		add(path, val, "")
+	}
+}
+
+// 解析 INI，[section] 转换成对象，section 之前的键放在顶层
+// 值都是字符串，; 和 # 开头的行是注释，值两边的引号会被去掉
+func parseINI(data []byte) (map[string]any, error) {
+	root := map[string]any{}
+	cur := root
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("第 %d 行的 section 缺少 ]: %s", lineNo, line)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			section, ok := root[name].(map[string]any)
+			if !ok {
+				section = map[string]any{}
+				root[name] = section
+			}
+			cur = section
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("第 %d 行缺少 =: %s", lineNo, line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		cur[strings.TrimSpace(key)] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// 顶层的标量先输出，对象作为 [section] 输出，INI 只能表示两层
+func writeINI(buf *bytes.Buffer, m map[string]any) error {
+	keys := sortedKeys(m)
+
+	for _, k := range keys {
+		if _, isSection := m[k].(map[string]any); isSection {
+			continue
+		}
+		value, err := iniValue(m[k])
+		if err != nil {
+			return fmt.Errorf("键 %q: %w", k, err)
+		}
+		fmt.Fprintf(buf, "%s = %s\n", k, value)
+	}
+
+	for _, k := range keys {
+		section, ok := m[k].(map[string]any)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(buf, "\n[%s]\n", k)
+		for _, name := range sortedKeys(section) {
+			value, err := iniValue(section[name])
+			if err != nil {
+				return fmt.Errorf("键 %q: %w", k+"."+name, err)
+			}
+			fmt.Fprintf(buf, "%s = %s\n", name, value)
+		}
+	}
+	return nil
+}
+
+func iniValue(v any) (string, error) {
+	switch val := v.(type) {
+	case string:
+		if strings.ContainsAny(val, "\n\r") {
+			return "", fmt.Errorf("INI 的值不能包含换行")
+		}
+		if val != strings.TrimSpace(val) {
+			return `"` + val + `"`, nil
+		}
+		return val, nil
+	case nil:
+		return "", nil
+	case map[string]any, []any:
+		return "", fmt.Errorf("INI 只支持两层的标量值")
+	default:
+		return fmt.Sprint(val), nil
+	}
+}
@@ -0,0 +1,125 @@
+package qqjson
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/tidwall/sjson"
+	"gopkg.in/yaml.v3"
+)
+
+// 读入 -> 写入一个新键 -> 写回，没有修改的键应该保持原来的值和类型
+func roundTrip(t *testing.T, input string, format DataFormat) string {
+	t.Helper()
+	jsonData, err := convertToJSON([]byte(input), format)
+	if err != nil {
+		t.Fatalf("转换成 JSON 失败: %v", err)
+	}
+	jsonData, err = sjson.SetBytes(jsonData, "added", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := convertFromJSON(jsonData, format, collectTimes([]byte(input), format))
+	if err != nil {
+		t.Fatalf("转换成 %s 失败: %v", format, err)
+	}
+	return string(out)
+}
+
+func TestRoundTripYAML(t *testing.T) {
+	input := `big: 12345678901234567890
+neg: -9223372036854775808
+f: 1.5
+date: 2024-01-02
+ts: 2001-12-14t21:59:43.10-05:00
+quoted: "2024-01-02"
+list:
+  - 2024-05-06
+  - 3
+nested:
+  on: true
+  empty: null
+`
+	out := roundTrip(t, input, DataFormatYAML)
+
+	var before, after map[string]any
+	if err := yaml.Unmarshal([]byte(input), &before); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal([]byte(out), &after); err != nil {
+		t.Fatalf("输出不是有效的 YAML: %v\n%s", err, out)
+	}
+	if after["added"] != "new" {
+		t.Errorf("新写入的键 = %v", after["added"])
+	}
+	delete(after, "added")
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("没有修改的键发生了变化\n之前: %#v\n之后: %#v\n输出:\n%s", before, after, out)
+	}
+
+	// 日期保持原来的写法，不变成带引号的 RFC 3339 字符串
+	for _, line := range []string{"big: 12345678901234567890", "date: 2024-01-02", `quoted: "2024-01-02"`, "- 2024-05-06"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("输出缺少 %q\n%s", line, out)
+		}
+	}
+}
+
+func TestRoundTripTOML(t *testing.T) {
+	input := `odt = 1979-05-27T07:32:00Z
+offset = 1979-05-27T00:32:00-07:00
+ld = 1979-05-27
+lt = 07:32:00
+ldt = 1979-05-27T07:32:00
+max = 9223372036854775807
+f = 3.25
+s = "1979-05-27"
+
+[t]
+when = [1979-05-27, 1980-01-01]
+`
+	out := roundTrip(t, input, DataFormatTOML)
+
+	var before, after map[string]any
+	if _, err := toml.Decode(input, &before); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := toml.Decode(out, &after); err != nil {
+		t.Fatalf("输出不是有效的 TOML: %v\n%s", err, out)
+	}
+	delete(after, "added")
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("没有修改的键发生了变化\n之前: %#v\n之后: %#v\n输出:\n%s", before, after, out)
+	}
+}
+
+func TestConvertFromJSONNumbers(t *testing.T) {
+	tests := []struct {
+		json   string
+		format DataFormat
+		want   string
+	}{
+		{`{"v":12345678901234567890}`, DataFormatYAML, "v: 12345678901234567890\n"},
+		{`{"v":1.10}`, DataFormatYAML, "v: 1.10\n"},
+		{`{"n":-5}`, DataFormatTOML, "n = -5\n"},
+		{`{"n":1e3}`, DataFormatTOML, "n = 1e3\n"},
+		{`{"n":7}`, DataFormatINI, "n = 7\n"},
+	}
+	for _, tt := range tests {
+		out, err := convertFromJSON([]byte(tt.json), tt.format, nil)
+		if err != nil {
+			t.Errorf("%s -> %s 失败: %v", tt.json, tt.format, err)
+			continue
+		}
+		if string(out) != tt.want {
+			t.Errorf("%s -> %s = %q，期望 %q", tt.json, tt.format, out, tt.want)
+		}
+	}
+
+	// TOML 表示不了的大整数报错，而不是变成浮点数
+	if _, err := convertFromJSON([]byte(`{"n":12345678901234567890}`), DataFormatTOML, nil); err == nil {
+		t.Errorf("超出 int64 的整数转换成 TOML 应该报错")
+	}
+}
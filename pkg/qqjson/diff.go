@@ -0,0 +1,184 @@
+package qqjson
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"common_tool/pkg/errorutil"
+	"common_tool/pkg/sh"
+)
+
+// 比较输入和 --other 指定的文件，-p/-P 指定时只比较对应的子树
+// 有差异时返回 CodeAssertionFailed，和 diff 命令一样可以直接用退出码判断
+func (opts *CLIOptions) diffJSONDocuments() error {
+	if opts.Format != "txt" && opts.Format != "sh" && opts.Format != "patch" {
+		return fmt.Errorf("diff 模式只支持 txt / sh / patch 格式: %s", opts.Format)
+	}
+	if opts.OtherFile == "" {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeMissingInput, "缺少 --other 参数", fmt.Errorf("diff 模式需要指定比较的文件"))
+	}
+
+	otherRaw, err := os.ReadFile(opts.OtherFile)
+	if err != nil {
+		return fmt.Errorf("无法读取文件 %s: %w", opts.OtherFile, err)
+	}
+	// 另一个文件和输入使用相同的格式
+	otherRaw, err = convertToJSON(otherRaw, opts.inFormat())
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "无法转换输入格式", err)
+	}
+	raw, err := opts.readDocument()
+	if err != nil {
+		return err
+	}
+
+	oldDoc, err := decodeSubtree(opts.document(raw), opts.Path)
+	if err != nil {
+		return err
+	}
+	newDoc, err := decodeSubtree(opts.document(otherRaw), opts.Path)
+	if err != nil {
+		return err
+	}
+
+	base := opts.ArgPath
+	if !opts.UseArgPath {
+		base = splitGJSONPath(opts.Path)
+	}
+	changes := diffJSON(oldDoc, newDoc, base)
+
+	switch opts.Format {
+	case "patch":
+		data, err := diffToPatch(changes)
+		if err != nil {
+			return errorutil.NewExitError(errorutil.CodeInternalErr, err)
+		}
+		if _, err := os.Stdout.Write(formatJSON(data, opts.JSONFormat, opts.TrieSeparator)); err != nil {
+			return errorutil.NewExitError(errorutil.CodeIOError, err)
+		}
+	case "sh":
+		outputDiffBash(changes)
+	default:
+		outputDiffText(changes)
+	}
+
+	if len(changes) > 0 {
+		return &errorutil.ExitErrorWithCode{
+			Code:    errorutil.CodeAssertionFailed,
+			Message: fmt.Sprintf("两个文档不同，共 %d 处差异", len(changes)),
+		}
+	}
+	return nil
+}
+
+// 取出 path 对应的子树并解码
+func decodeSubtree(d *Document, path string) (any, error) {
+	value, err := d.Get(path)
+	if err != nil {
+		return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, err.Error(), err)
+	}
+	doc, err := decodeJSONDocument([]byte(value.Raw))
+	if err != nil {
+		return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "输入内容不是有效的 JSON", err)
+	}
+	return doc, nil
+}
+
+// 每行一处差异，路径和 -p 参数的格式相同
+// + key1.key2: "value1"
+// - key1.old: 3
+// ~ key1.num: 1 -> 2
+// 整个文档不同(根是标量或者类型不同)时路径显示为 ""
+// ~ "": 1 -> 2
+func outputDiffText(changes []diffChange) {
+	for _, c := range changes {
+		path := qJsonEscapeAndJoin(c.Path)
+		if len(c.Path) == 0 {
+			path = `""`
+		}
+		switch c.Op {
+		case DiffOpAdd:
+			fmt.Printf("+ %s: %s\n", path, compactJSON(c.New))
+		case DiffOpRemove:
+			fmt.Printf("- %s: %s\n", path, compactJSON(c.Old))
+		default:
+			fmt.Printf("~ %s: %s -> %s\n", path, compactJSON(c.Old), compactJSON(c.New))
+		}
+	}
+}
+
+// 输出为关联数组的内容，键是路径，值是 add / remove / replace
+// declare -A changes=()
+// eval -- changes=($(gobolt json -m diff -t sh ...))
+func outputDiffBash(changes []diffChange) {
+	parts := make([]string, 0, len(changes))
+	for _, c := range changes {
+		// 根路径和 validate 一样用 (root)，关联数组不允许空的下标
+		key := qJsonEscapeAndJoin(c.Path)
+		if len(c.Path) == 0 {
+			key = bashRootKey
+		}
+		parts = append(parts, fmt.Sprintf("[%s]=%s",
+			sh.BashANSIQuote(key),
+			sh.BashANSIQuote(c.Op),
+		))
+	}
+	fmt.Printf("%s", strings.Join(parts, " "))
+}
+
+// 读取补丁文件，"" 或者 "-" 表示从标准输入读取
+func (opts *CLIOptions) readPatchFile() ([]byte, error) {
+	if opts.PatchFile == "" || opts.PatchFile == "-" {
+		if opts.Kind != "file" && opts.Kind != "str" {
+			return nil, fmt.Errorf("JSON 和补丁不能同时从标准输入读取")
+		}
+		return io.ReadAll(os.Stdin)
+	}
+
+	data, err := os.ReadFile(opts.PatchFile)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取补丁文件 %s: %w", opts.PatchFile, err)
+	}
+	return data, nil
+}
+
+// 把 RFC 6902 或者 RFC 7386 补丁应用到输入上，写回方式和 -m w 相同
+// 补丁中的任何一条操作失败都不会写回
+func (opts *CLIOptions) patchJSON() error {
+	patchData, err := opts.readPatchFile()
+	if err != nil {
+		return err
+	}
+
+	unlock, err := opts.lockTarget()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	jsonData, err := opts.loadTarget()
+	if err != nil {
+		return err
+	}
+
+	// 和 sjson 一样，空文件按空对象处理
+	if len(strings.TrimSpace(string(jsonData))) == 0 {
+		jsonData = []byte("{}")
+	} else if _, err := decodeJSONDocument(jsonData); err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "输入内容不是有效的 JSON", err)
+	}
+
+	// 直接修改原来的文本，没有修改的键保持原来的顺序
+	updated, err := applyPatchRaw(jsonData, patchData)
+	if err != nil {
+		var testErr *patchTestError
+		if errors.As(err, &testErr) {
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeAssertionFailed, "补丁中的 test 操作不通过", err)
+		}
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "补丁无法应用", err)
+	}
+	return opts.storeTarget(updated)
+}
@@ -0,0 +1,157 @@
+package qqjson
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/tidwall/gjson"
+)
+
+// Document 是命令行各个模式使用的读写规则的库接口，Go 代码可以在进程内直接使用
+// 路径和 -p 参数的格式相同(gjson/sjson 的语法，: 前缀强制按对象创建)，
+// 路径段中有 . [ ] 等特殊字符时用 JoinPath 转义后连接(和 -P 相同)
+//
+//	doc, err := qqjson.NewDocument(data)
+//	err = doc.Set(qqjson.JoinPath("devices", "r1", "port"), 22)
+//	err = doc.SetMulti("devices.r1.user", "s:admin", "devices.:2024.ok", "j:true")
+//	v, err := doc.Get("devices.r1")
+//	v.Type == qqjson.JSONTypeObject
+//	sh := v.Bash()
+type Document struct {
+	data []byte
+	// Format(JSONFormatTrie) 使用的分隔符
+	TrieSeparator string
+}
+
+// data 为空时是一个空文档，第一次写入的时候按路径创建
+func NewDocument(data []byte) (*Document, error) {
+	if len(bytes.TrimSpace(data)) > 0 && !gjson.ValidBytes(data) {
+		return nil, fmt.Errorf("输入内容不是有效的 JSON")
+	}
+	return &Document{data: data, TrieSeparator: DefaultSep}, nil
+}
+
+// 解析 format 格式(yaml / toml / ini / json5)的内容，和 --in-format 相同
+func ParseDocument(data []byte, format DataFormat) (*Document, error) {
+	jsonData, err := convertToJSON(data, format)
+	if err != nil {
+		return nil, err
+	}
+	return NewDocument(jsonData)
+}
+
+// 把路径段转义后连接成一个路径，和 -P 参数相同
+func JoinPath(segments ...string) string {
+	return qJsonEscapeAndJoin(segments)
+}
+
+// 文档当前的 JSON 内容
+func (d *Document) Bytes() []byte {
+	return d.data
+}
+
+// Value 是读取到的值，Type 是类型码(JSONTypeNull ... JSONTypeObject)，和 -m r 的退出码相同
+type Value struct {
+	Raw  string
+	Type int
+
+	res     gjson.Result
+	trieSep string
+}
+
+// 读取 path 对应的值，path 为空时是整个文档，路径不存在时返回错误
+// 空文档中任何路径(包括 "")都不存在
+func (d *Document) Get(path string) (Value, error) {
+	if len(bytes.TrimSpace(d.data)) == 0 {
+		return Value{}, fmt.Errorf("字段 %q 不存在", path)
+	}
+	res, err := lookupPath(d.data, path)
+	if err != nil {
+		return Value{}, err
+	}
+	return d.value(res), nil
+}
+
+func (d *Document) Exists(path string) bool {
+	_, err := d.Get(path)
+	return err == nil
+}
+
+func (d *Document) value(res gjson.Result) Value {
+	code, _ := TypeOf(res)
+	sep := d.TrieSeparator
+	if sep == "" {
+		sep = DefaultSep
+	}
+	return Value{Raw: res.Raw, Type: code, res: res, trieSep: sep}
+}
+
+// 写入值，和 -m w 相同，路径不存在时自动创建
+func (d *Document) Set(path string, value any) error {
+	return d.apply(path, value, setValue)
+}
+
+// 删除值，和 -m d 相同
+func (d *Document) Delete(path string) error {
+	return d.apply(path, nil, deleteValue)
+}
+
+// 按顺序写入多个值，参数和 -M 相同: 路径, 带 s: / j: 前缀的值, 路径, 值 ...
+// 任何一个失败时文档保持不变
+func (d *Document) SetMulti(pairs ...string) error {
+	return d.applyPairs(pairs, setValue)
+}
+
+// 命令行的写入模式(w / d / a 和 --encrypt)都通过 apply 和 applyPairs 修改文档
+func (d *Document) apply(path string, value any, operation func([]byte, string, any) ([]byte, error)) error {
+	return d.update(func(jsonData []byte) ([]byte, error) {
+		return operation(jsonData, path, value)
+	})
+}
+
+func (d *Document) applyPairs(pairs []string, operation func([]byte, string, any) ([]byte, error)) error {
+	return d.update(func(jsonData []byte) ([]byte, error) {
+		return applyPairs(jsonData, pairs, operation)
+	})
+}
+
+func (d *Document) update(fn func([]byte) ([]byte, error)) error {
+	updated, err := fn(d.data)
+	if err != nil {
+		return err
+	}
+	d.data = updated
+	return nil
+}
+
+// 整个文档按 -F 的格式输出
+func (d *Document) Format(format JSONFormat) []byte {
+	return d.value(gjson.ParseBytes(d.data)).Format(format)
+}
+
+// 和 -t txt -F format 的输出相同
+func (v Value) Format(format JSONFormat) []byte {
+	return formatJSON([]byte(v.Raw), format, v.trieSep)
+}
+
+// 和 -t sh 的输出相同，字符串等标量的末尾有一个补充字符 X
+func (v Value) Bash() []byte {
+	var buf bytes.Buffer
+	writeBash(&buf, v.res)
+	return buf.Bytes()
+}
+
+// 和 -t shtree --var-prefix prefix 的输出相同
+func (v Value) BashTree(prefix string) ([]byte, error) {
+	if !isBashIdentifier(prefix) {
+		return nil, fmt.Errorf("无效的变量名前缀: %q", prefix)
+	}
+	var buf bytes.Buffer
+	writeBashTree(&buf, v.res, prefix)
+	return buf.Bytes(), nil
+}
+
+// 字符串返回内容本身，其它类型返回 JSON
+func (v Value) String() string {
+	return v.res.String()
+}
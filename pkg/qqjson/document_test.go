@@ -0,0 +1,138 @@
+package qqjson
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocumentReadWrite(t *testing.T) {
+	doc, err := NewDocument([]byte(`{"devices":{"r1":{"port":22}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name string
+		fn   func() error
+	}{
+		{"Set", func() error { return doc.Set("devices.r1.user", "admin") }},
+		{"Set 转义的路径", func() error { return doc.Set(JoinPath("devices", "r2.lab", "port"), 2222) }},
+		{"Set : 强制创建对象", func() error { return doc.Set("devices.:3.ok", true) }},
+		{"SetMulti", func() error { return doc.SetMulti("devices.r1.port", "j:23", "devices.r1.tags", `j:["a"]`) }},
+		{"Delete", func() error { return doc.Delete("devices.r1.tags") }},
+	}
+	for _, step := range steps {
+		if err := step.fn(); err != nil {
+			t.Fatalf("%s 失败: %v", step.name, err)
+		}
+	}
+
+	want := `{"devices":{"r1":{"port":23,"user":"admin"},"r2.lab":{"port":2222},"3":{"ok":true}}}`
+	if got := string(doc.Bytes()); got != want {
+		t.Errorf("文档 = %s\n期望   %s", got, want)
+	}
+
+	tests := []struct {
+		path     string
+		typ      int
+		raw, str string
+	}{
+		{"devices.r1.port", JSONTypeNumber, "23", "23"},
+		{"devices.r1.user", JSONTypeString, `"admin"`, "admin"},
+		{JoinPath("devices", "r2.lab"), JSONTypeObject, `{"port":2222}`, `{"port":2222}`},
+		{"devices.3.ok", JSONTypeTrue, "true", "true"},
+	}
+	for _, tt := range tests {
+		v, err := doc.Get(tt.path)
+		if err != nil {
+			t.Errorf("Get(%q) 失败: %v", tt.path, err)
+			continue
+		}
+		if v.Type != tt.typ || v.Raw != tt.raw || v.String() != tt.str {
+			t.Errorf("Get(%q) = {%d %s %s}，期望 {%d %s %s}", tt.path, v.Type, v.Raw, v.String(), tt.typ, tt.raw, tt.str)
+		}
+	}
+
+	if doc.Exists("devices.r1.tags") {
+		t.Errorf("删除的路径仍然存在")
+	}
+	if _, err := doc.Get("devices.nope"); err == nil {
+		t.Errorf("不存在的路径应该返回错误")
+	}
+}
+
+func TestDocumentSetMultiAtomic(t *testing.T) {
+	doc, err := NewDocument([]byte(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pairs := range [][]string{
+		{"b", "s:x", "c"},
+		{"b", "s:x", "c", "j:{bad"},
+		{"b", "x:1"},
+	} {
+		if err := doc.SetMulti(pairs...); err == nil {
+			t.Errorf("SetMulti(%q) 应该失败", pairs)
+		}
+	}
+	if got := string(doc.Bytes()); got != `{"a":1}` {
+		t.Errorf("失败的 SetMulti 修改了文档: %s", got)
+	}
+}
+
+func TestDocumentEmpty(t *testing.T) {
+	doc, err := NewDocument(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 空文档读取时报告路径不存在，而不是 JSON 无效
+	for _, path := range []string{"", "a.b"} {
+		_, err := doc.Get(path)
+		if err == nil || !strings.Contains(err.Error(), "不存在") {
+			t.Errorf("空文档 Get(%q) 的错误 = %v，期望路径不存在", path, err)
+		}
+		if doc.Exists(path) {
+			t.Errorf("空文档中 %q 不应该存在", path)
+		}
+	}
+
+	if err := doc.Set("a.b", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(doc.Bytes()); got != `{"a":{"b":"x"}}` {
+		t.Errorf("第一次写入后 = %s", got)
+	}
+
+	if _, err := NewDocument([]byte(`{"a":`)); err == nil {
+		t.Errorf("无效的 JSON 应该返回错误")
+	}
+}
+
+func TestDocumentFormat(t *testing.T) {
+	doc, err := ParseDocument([]byte("a:\n  b: [1, x]\n"), DataFormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(doc.Format(JSONFormatOne)); strings.TrimSpace(got) != `{"a":{"b":[1,"x"]}}` {
+		t.Errorf("Format(one) = %q", got)
+	}
+
+	v, err := doc.Get("a.b.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(v.Bash()); got != "xX" {
+		t.Errorf("Bash() = %q，期望 %q", got, "xX")
+	}
+
+	want := ` [$'{a}\034{b}\034[0]\034']=$'1\034' [$'{a}\034{b}\034[1]\034']=$'x'`
+	if got := string(doc.Format(JSONFormatTrie)); got != want {
+		t.Errorf("Format(trie) = %q，期望 %q", got, want)
+	}
+
+	if _, err := v.BashTree("1bad"); err == nil {
+		t.Errorf("无效的变量名前缀应该返回错误")
+	}
+}
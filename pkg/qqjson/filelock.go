@@ -0,0 +1,110 @@
+package qqjson
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// 锁文件的后缀，锁加在旁边的 .lock 文件上而不是目标文件本身，
+// 因为目标文件会被 rename 替换，加在它上面的锁会随旧文件一起失效
+const (
+	lockSuffix   = ".lock"
+	backupSuffix = ".bak"
+)
+
+// 对 path 加排他的建议锁（flock），返回的函数用于解锁并删除锁文件
+// 同一个文件的多个 gobolt 进程会在这里排队，path 是符号链接时锁加在链接指向的文件上
+func lockPath(path string) (func(), error) {
+	lockName := resolveSymlink(path) + lockSuffix
+	for {
+		f, err := os.OpenFile(lockName, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("无法创建锁文件: %w", err)
+		}
+
+		if err := lockFile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("加锁失败 %s: %w", path, err)
+		}
+
+		// 等锁的时候上一个进程可能已经删除了锁文件，这时锁住的是已经删除的文件，
+		// 和之后新建锁文件的进程互不排斥，所以要重新打开
+		fileInfo, errFile := f.Stat()
+		pathInfo, errPath := os.Stat(lockName)
+		if errFile == nil && errPath == nil && os.SameFile(fileInfo, pathInfo) {
+			return func() {
+				// 持有锁的时候删除，保证等待的进程能发现锁文件已经被替换
+				// (Windows 下打开的文件不能删除，锁文件会保留)
+				os.Remove(lockName)
+				unlockFile(f)
+				f.Close()
+			}, nil
+		}
+		unlockFile(f)
+		f.Close()
+	}
+}
+
+// 符号链接指向的真实路径，不是符号链接或者链接指向的文件不存在时返回 path 本身
+func resolveSymlink(path string) string {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	return path
+}
+
+// 先写临时文件再 rename，保证目标文件要么是旧内容要么是完整的新内容
+// 目标文件已经存在时沿用它的权限
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return writeFileAtomicFunc(path, perm, func(w io.Writer) error {
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("写入临时文件失败: %w", err)
+		}
+		return nil
+	})
+}
+
+// 和 writeFileAtomic 相同，内容由 write 流式写入临时文件
+// path 是符号链接时替换链接指向的文件，链接本身保留
+func writeFileAtomicFunc(path string, perm os.FileMode, write func(io.Writer) error) error {
+	path = resolveSymlink(path)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("无法创建临时文件: %w", err)
+	}
+	tmpName := tmp.Name()
+
+	// 任何一步失败都清理掉临时文件
+	success := false
+	defer func() {
+		if !success {
+			tmp.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	if err := write(tmp); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("同步临时文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("关闭临时文件失败: %w", err)
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return fmt.Errorf("设置临时文件权限失败: %w", err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("替换文件失败: %w", err)
+	}
+
+	success = true
+	return nil
+}
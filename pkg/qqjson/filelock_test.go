@@ -0,0 +1,95 @@
+package qqjson
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFileAtomicKeepsSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 下创建符号链接需要权限")
+	}
+	dir := t.TempDir()
+	real := filepath.Join(dir, "real.json")
+	link := filepath.Join(dir, "link.json")
+	if err := os.WriteFile(real, []byte(`{"a":1}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("real.json", link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(link, []byte(`{"a":2}`), 0644); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("符号链接被替换成了普通文件")
+	}
+	data, _ := os.ReadFile(real)
+	if string(data) != `{"a":2}` {
+		t.Errorf("链接指向的文件内容 = %s，期望 {\"a\":2}", data)
+	}
+	if info, _ := os.Stat(real); info.Mode().Perm() != 0600 {
+		t.Errorf("权限 = %v，期望沿用原来的 0600", info.Mode().Perm())
+	}
+}
+
+func TestLockPathRemovesLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "demo.json")
+
+	for i := 0; i < 2; i++ {
+		unlock, err := lockPath(path)
+		if err != nil {
+			t.Fatalf("加锁失败: %v", err)
+		}
+		if _, err := os.Stat(path + lockSuffix); err != nil {
+			t.Errorf("加锁后锁文件不存在: %v", err)
+		}
+		unlock()
+		if runtime.GOOS == "windows" {
+			continue
+		}
+		if _, err := os.Stat(path + lockSuffix); !os.IsNotExist(err) {
+			t.Errorf("解锁后锁文件没有删除: %v", err)
+		}
+	}
+}
+
+func TestBackupSkipsNewFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "new.json")
+	opts := &CLIOptions{Kind: "file", InArg: path, Backup: true, JSONFormat: JSONFormatMul}
+
+	if _, err := opts.loadTarget(); err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if err := opts.storeTarget([]byte(`{"a":1}`)); err != nil {
+		t.Fatalf("写回失败: %v", err)
+	}
+	if _, err := os.Stat(path + backupSuffix); !os.IsNotExist(err) {
+		t.Errorf("新建的文件不应该生成备份: %v", err)
+	}
+
+	// 已有的文件正常备份
+	opts = &CLIOptions{Kind: "file", InArg: path, Backup: true, JSONFormat: JSONFormatMul}
+	if _, err := opts.loadTarget(); err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if err := opts.storeTarget([]byte(`{"a":2}`)); err != nil {
+		t.Fatalf("写回失败: %v", err)
+	}
+	data, err := os.ReadFile(path + backupSuffix)
+	if err != nil {
+		t.Fatalf("没有生成备份: %v", err)
+	}
+	if len(data) == 0 {
+		t.Errorf("备份的内容为空")
+	}
+}
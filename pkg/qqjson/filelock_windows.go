@@ -0,0 +1,18 @@
+//go:build windows
+
+package qqjson
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows 下没有 flock，用 LockFileEx 锁住第一个字节达到同样的效果
+func lockFile(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, &windows.Overlapped{})
+}
+
+func unlockFile(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
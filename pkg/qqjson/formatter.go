@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"sort"
 	"strings"
@@ -46,6 +47,24 @@ var formatters = map[string]OutputFormatter{
 	"type": TypeFormatter{},
 }
 
+// -t 对应的 formatter，shtree 需要 --var-prefix 指定的变量名前缀
+func (opts *CLIOptions) formatter() (OutputFormatter, error) {
+	if opts.Format == "shtree" {
+		if !isBashIdentifier(opts.VarPrefix) {
+			return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage,
+				fmt.Sprintf("无效的变量名前缀: %q", opts.VarPrefix),
+				fmt.Errorf("--var-prefix 必须是合法的 bash 变量名"))
+		}
+		return BashTreeFormatter{Prefix: opts.VarPrefix}, nil
+	}
+
+	formatter, ok := formatters[opts.Format]
+	if !ok {
+		return nil, fmt.Errorf("不支持的格式: %s", opts.Format)
+	}
+	return formatter, nil
+}
+
 func writeCustomJSON(buf *bytes.Buffer, v any, indent int) {
 	indentStr := strings.Repeat(" ", indent)
 	switch val := v.(type) {
@@ -182,8 +201,12 @@ func writeTrieLeaf(buf *bytes.Buffer, v any, path string, trieSep string) {
 
 // 命令的退出码输出对象类型
 func outputType(res gjson.Result) *errorutil.ExitErrorWithCode {
-	typeErr := &errorutil.ExitErrorWithCode{Code: errorutil.CodeSuccess, Message: "", Err: nil, CmdExitCode: errorutil.CodeSuccess}
+	code, name := TypeOf(res)
+	return &errorutil.ExitErrorWithCode{Code: errorutil.CodeSuccess, Message: name, Err: nil, CmdExitCode: code}
+}
 
+// 值的类型码和类型名，类型码就是 -m r 的退出码
+func TypeOf(res gjson.Result) (int, string) {
 	var typeMap = map[gjson.Type]struct {
 		Code    int
 		Message string
@@ -196,20 +219,13 @@ func outputType(res gjson.Result) *errorutil.ExitErrorWithCode {
 	}
 
 	if res.IsObject() {
-		typeErr.CmdExitCode = JSONTypeObject
-		typeErr.Message = "object"
+		return JSONTypeObject, "object"
 	} else if res.IsArray() {
-		typeErr.CmdExitCode = JSONTypeArray
-		typeErr.Message = "array"
+		return JSONTypeArray, "array"
 	} else if info, ok := typeMap[res.Type]; ok {
-		typeErr.CmdExitCode = info.Code
-		typeErr.Message = info.Message
-	} else {
-		typeErr.CmdExitCode = JSONTypeUnknown
-		typeErr.Message = "unknown"
+		return info.Code, info.Message
 	}
-
-	return typeErr
+	return JSONTypeUnknown, "unknown"
 }
 
 func prefixValue(v gjson.Result) string {
@@ -259,7 +275,11 @@ func prefixValue(v gjson.Result) string {
 // )
 
 func outputBash(res gjson.Result) *errorutil.ExitErrorWithCode {
+	writeBash(os.Stdout, res)
+	return outputType(res)
+}
 
+func writeBash(w io.Writer, res gjson.Result) {
 	// 创建一个和数组/对象大小一摸一样的切片避免扩容提升性能
 	// 其它对象返回0,就是一个空切片
 	parts := make([]string, 0, res.Get("#").Int())
@@ -269,7 +289,7 @@ func outputBash(res gjson.Result) *errorutil.ExitErrorWithCode {
 			parts = append(parts, sh.BashANSIQuote(prefixValue(v)))
 			return true
 		})
-		fmt.Printf("%s", strings.Join(parts, " "))
+		fmt.Fprintf(w, "%s", strings.Join(parts, " "))
 	} else if res.IsObject() {
 		res.ForEach(func(k, v gjson.Result) bool {
 			parts = append(parts, fmt.Sprintf("[%s]=%s",
@@ -278,14 +298,12 @@ func outputBash(res gjson.Result) *errorutil.ExitErrorWithCode {
 			))
 			return true
 		})
-		fmt.Printf("%s", strings.Join(parts, " "))
+		fmt.Fprintf(w, "%s", strings.Join(parts, " "))
 	} else {
 		// 这里不处理null,因为会和字符串的null冲突
 		// 结尾增加一个补充字符是为了防止Bash中$()自动去掉结尾的换行符行为
-		fmt.Printf("%sX", res.String())
+		fmt.Fprintf(w, "%sX", res.String())
 	}
-
-	return outputType(res)
 }
 
 func formatJSON(data []byte, format JSONFormat, trieSep string) []byte {
@@ -323,6 +341,12 @@ func formatJSON(data []byte, format JSONFormat, trieSep string) []byte {
 		writeTrieJSON(&buf, raw, "", trieSep)
 
 		return buf.Bytes()
+	case JSONFormatCanonical:
+		canonical, err := canonicalJSON(data)
+		if err != nil {
+			return fmt.Appendf(nil, "error: %v", err)
+		}
+		return canonical
 	default:
 		return data
 	}
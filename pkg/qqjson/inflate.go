@@ -0,0 +1,321 @@
+package qqjson
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"common_tool/pkg/errorutil"
+	"common_tool/pkg/sh"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// -F trie 的逆操作，把扁平的键值对重新组装成 JSON
+// --flat trie : -F trie 输出的关联数组内容，或者每行一个 路径<SEP>值
+// --flat props: 每行一个 key.path=value，路径和 -p 参数的格式相同
+
+const (
+	FlatFormatTrie  = "trie"
+	FlatFormatProps = "props"
+)
+
+// 扁平格式中的一个叶子，path 是 sjson 的路径，raw 是 JSON 片段
+type flatEntry struct {
+	path string
+	raw  string
+}
+
+func (opts *CLIOptions) inflateJSON() error {
+	data, err := opts.readInput()
+	if err != nil {
+		return err
+	}
+
+	var entries []flatEntry
+	root := "{}"
+	switch opts.FlatFormat {
+	case FlatFormatTrie:
+		entries, err = parseTrieEntries(string(data), opts.TrieSeparator)
+		root = trieRoot(entries)
+	case FlatFormatProps:
+		entries, err = parsePropsEntries(string(data))
+	default:
+		return fmt.Errorf("不支持的扁平格式: %s，请使用 trie / props", opts.FlatFormat)
+	}
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "扁平格式的内容无效", err)
+	}
+
+	jsonData, err := buildFromEntries(entries, root)
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "无法组装 JSON", err)
+	}
+
+	out := formatJSON(jsonData, opts.JSONFormat, opts.TrieSeparator)
+	if opts.OutFormat != "" && opts.OutFormat != DataFormatJSON {
+		if out, err = convertFromJSON(jsonData, opts.OutFormat, nil); err != nil {
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "无法转换输出格式", err)
+		}
+	}
+	if _, err := os.Stdout.Write(out); err != nil {
+		return errorutil.NewExitError(errorutil.CodeIOError, err)
+	}
+	return nil
+}
+
+// 从 root({} 或者 []) 开始按顺序写入每个叶子，路径的创建规则和 -m w 相同
+// 路径为空的叶子是整个文档，只能单独出现
+func buildFromEntries(entries []flatEntry, root string) ([]byte, error) {
+	jsonData := []byte(root)
+	for _, e := range entries {
+		if e.path == "" {
+			if len(entries) > 1 {
+				return nil, fmt.Errorf("根节点的值 %s 不能和其它路径同时出现", e.raw)
+			}
+			jsonData = []byte(e.raw)
+			continue
+		}
+		var err error
+		jsonData, err = sjson.SetRawBytes(jsonData, e.path, []byte(e.raw))
+		if err != nil {
+			return nil, fmt.Errorf("路径 %q 写入失败: %w", e.path, err)
+		}
+	}
+	return jsonData, nil
+}
+
+// 整个内容以 [$' 开头时按 -F trie 的原始输出解析，否则每行一个 路径<SEP>值
+func parseTrieEntries(content, sep string) ([]flatEntry, error) {
+	if sep == "" {
+		return nil, fmt.Errorf("trie 分隔符不能为空")
+	}
+	if strings.HasPrefix(strings.TrimSpace(content), "[$'") {
+		return parseTrieAssoc(content, sep)
+	}
+
+	var entries []flatEntry
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		e, err := parseTrieLine(line, sep)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行: %w", i+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// [$'{key1}\034[0]\034']=$'value' [$'{key1}\034[1]\034']=$'2\034' ...
+func parseTrieAssoc(content, sep string) ([]flatEntry, error) {
+	words, err := sh.SplitWords(content)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]flatEntry, 0, len(words))
+	for _, w := range words {
+		// 根节点的路径为空，其它路径总是以分隔符结尾
+		var path, value string
+		switch {
+		case strings.HasPrefix(w, "[]="):
+			value = w[len("[]="):]
+		case strings.HasPrefix(w, "["):
+			idx := strings.Index(w, sep+"]=")
+			if idx < 0 {
+				return nil, fmt.Errorf("无效的元素: %q", w)
+			}
+			path, value = w[1:idx+len(sep)], w[idx+len(sep)+len("]="):]
+		default:
+			return nil, fmt.Errorf("无效的元素: %q", w)
+		}
+
+		segments, err := splitTriePath(path, sep)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := trieValueRaw(value, sep)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, flatEntry{path: trieSegmentsToPath(segments), raw: raw})
+	}
+	return entries, nil
+}
+
+// {key1}<SEP>[0]<SEP>值，非字符串的值后面还有一个分隔符
+// 只有 {} 有歧义(空对象或者空字符串键)，按空对象处理
+func parseTrieLine(line, sep string) (flatEntry, error) {
+	fields := strings.Split(line, sep)
+
+	var value string
+	var segments []string
+	last := len(fields) - 1
+	if last >= 1 && fields[last] == "" && isTrieLiteral(fields[last-1]) {
+		value = fields[last-1] + sep
+		segments = fields[:last-1]
+	} else {
+		value = fields[last]
+		segments = fields[:last]
+	}
+
+	var path []string
+	if len(segments) > 0 {
+		var err error
+		if path, err = splitTriePath(strings.Join(segments, sep)+sep, sep); err != nil {
+			return flatEntry{}, err
+		}
+	}
+	raw, err := trieValueRaw(value, sep)
+	if err != nil {
+		return flatEntry{}, err
+	}
+	return flatEntry{path: trieSegmentsToPath(path), raw: raw}, nil
+}
+
+// 把 {key}<SEP>[0]<SEP> 拆分成 sjson 的路径段
+// 对象的键总是加上 : 前缀，这样数字键也会按对象创建
+func splitTriePath(path, sep string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !strings.HasSuffix(path, sep) {
+		return nil, fmt.Errorf("路径没有以分隔符结尾: %q", path)
+	}
+
+	var segments []string
+	for _, part := range strings.Split(strings.TrimSuffix(path, sep), sep) {
+		switch {
+		case len(part) >= 2 && part[0] == '{' && part[len(part)-1] == '}':
+			segments = append(segments, ":"+qJsonEscape(part[1:len(part)-1]))
+		case len(part) >= 3 && part[0] == '[' && part[len(part)-1] == ']' && isDigits(part[1:len(part)-1]):
+			segments = append(segments, part[1:len(part)-1])
+		default:
+			return nil, fmt.Errorf("无效的路径段: %q", part)
+		}
+	}
+	return segments, nil
+}
+
+// trie 中对象的键总是以 : 开头，第一段是数字时根节点是数组
+func trieRoot(entries []flatEntry) string {
+	if len(entries) > 0 {
+		first, _, _ := strings.Cut(entries[0].path, ".")
+		if isDigits(first) {
+			return "[]"
+		}
+	}
+	return "{}"
+}
+
+func trieSegmentsToPath(segments []string) string {
+	return strings.Join(segments, ".")
+}
+
+// 以分隔符结尾的是数字 true false null [] {}，其它都是字符串
+func trieValueRaw(value, sep string) (string, error) {
+	literal, typed := strings.CutSuffix(value, sep)
+	if !typed {
+		return marshalString(value), nil
+	}
+	if !isTrieLiteral(literal) {
+		return "", fmt.Errorf("无效的值: %q", literal)
+	}
+	return literal, nil
+}
+
+func isTrieLiteral(s string) bool {
+	switch s {
+	case "true", "false", "null", "[]", "{}":
+		return true
+	}
+	return s != "" && gjson.Valid(s) && gjson.Parse(s).Type == gjson.Number
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// key.path=value，# 开头的行是注释，键中的 = 需要写成 \=
+// 值可以带上和 -t sh 相同的类型前缀(s: i: t: f: n: o: a:)，没有前缀的都是字符串
+func parsePropsEntries(content string) ([]flatEntry, error) {
+	var entries []flatEntry
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		eq := -1
+		for j := 0; j < len(line); j++ {
+			if line[j] == '\\' {
+				j++
+				continue
+			}
+			if line[j] == '=' {
+				eq = j
+				break
+			}
+		}
+		if eq < 0 {
+			return nil, fmt.Errorf("第 %d 行缺少 =: %s", i+1, line)
+		}
+
+		path := strings.ReplaceAll(strings.TrimSpace(line[:eq]), `\=`, "=")
+		if path == "" {
+			return nil, fmt.Errorf("第 %d 行的路径为空", i+1)
+		}
+		raw, err := propsValueRaw(line[eq+1:])
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行: %w", i+1, err)
+		}
+		entries = append(entries, flatEntry{path: path, raw: raw})
+	}
+	return entries, nil
+}
+
+func propsValueRaw(value string) (string, error) {
+	if len(value) < 2 || value[1] != ':' {
+		return marshalString(value), nil
+	}
+
+	body := value[2:]
+	switch value[0] {
+	case 's':
+		return marshalString(body), nil
+	case 't':
+		return "true", nil
+	case 'f':
+		return "false", nil
+	case 'n':
+		return "null", nil
+	case 'i':
+		if !gjson.Valid(body) || gjson.Parse(body).Type != gjson.Number {
+			return "", fmt.Errorf("无效的数字: %q", body)
+		}
+		return body, nil
+	case 'o', 'a':
+		res := gjson.Parse(body)
+		if !gjson.Valid(body) || (value[0] == 'o' && !res.IsObject()) || (value[0] == 'a' && !res.IsArray()) {
+			return "", fmt.Errorf("无效的 JSON: %q", body)
+		}
+		return body, nil
+	default:
+		return marshalString(value), nil
+	}
+}
+
+func marshalString(s string) string {
+	data, _ := marshalJSON(s)
+	return string(bytes.TrimSpace(data))
+}
@@ -0,0 +1,183 @@
+package qqjson
+
+import (
+	"testing"
+)
+
+const testTrieSep = "\034"
+
+// 键的顺序不影响比较结果
+func sameJSON(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+	a, err := canonicalJSON(got)
+	if err != nil {
+		t.Fatalf("组装的 JSON 无效: %v\n%s", err, got)
+	}
+	b, err := canonicalJSON([]byte(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(a) == string(b)
+}
+
+// -F trie 的输出 -> inflate -> 应该得到相同的 JSON
+func TestInflateTrieRoundTrip(t *testing.T) {
+	tests := []string{
+		`{"a":{"b":[1,"x",true,null]}}`,
+		`{"0":"zero","1":{"2":[3]},"list":[{"10":false}]}`,
+		`{"empty_obj":{},"empty_arr":[],"nested":[[],{}]}`,
+		`{"a.b":"dot","*":"star","?":"q","c|d":"pipe","#":"hash"}`,
+		`{"num":"12","bool":"true","null":"null","s":"with space","neg":-1.5,"exp":1e21}`,
+		`{"multi":"line1\nline2","quote":"it's \"q\"","tab":"\t"}`,
+		`[1,[2,{"k":[]}]]`,
+		`{}`,
+		`[]`,
+		`42`,
+		`"str"`,
+	}
+	for _, input := range tests {
+		trie := formatJSON([]byte(input), JSONFormatTrie, testTrieSep)
+		entries, err := parseTrieEntries(string(trie), testTrieSep)
+		if err != nil {
+			t.Errorf("%s: 解析 %q 失败: %v", input, trie, err)
+			continue
+		}
+		got, err := buildFromEntries(entries, trieRoot(entries))
+		if err != nil {
+			t.Errorf("%s: 组装失败: %v", input, err)
+			continue
+		}
+		if !sameJSON(t, got, input) {
+			t.Errorf("%s: 往返后得到 %s\ntrie: %q", input, got, trie)
+		}
+	}
+}
+
+func TestParseTrieLine(t *testing.T) {
+	sep := testTrieSep
+	tests := []struct {
+		line string
+		path string
+		raw  string
+	}{
+		{"{a}" + sep + "[0]" + sep + "value", ":a.0", `"value"`},
+		{"{a}" + sep + "[1]" + sep + "2" + sep, ":a.1", `2`},
+		{"{0}" + sep + "true" + sep, ":0", `true`},
+		{"{x.y}" + sep + "{}" + sep, `:x\.y`, `{}`},
+		{"{a}" + sep + "[]" + sep, ":a", `[]`},
+		// 字符串的值没有结尾的分隔符，看起来像数字也是字符串
+		{"{a}" + sep + "12", ":a", `"12"`},
+		{"{a}" + sep, ":a", `""`},
+		{"null" + sep, "", `null`},
+		{"plain", "", `"plain"`},
+	}
+	for _, tt := range tests {
+		e, err := parseTrieLine(tt.line, sep)
+		if err != nil {
+			t.Errorf("parseTrieLine(%q) 返回错误: %v", tt.line, err)
+			continue
+		}
+		if e.path != tt.path || e.raw != tt.raw {
+			t.Errorf("parseTrieLine(%q) = (%q, %s)，期望 (%q, %s)", tt.line, e.path, e.raw, tt.path, tt.raw)
+		}
+	}
+
+	for _, line := range []string{
+		"a" + sep + "1",
+		"[x]" + sep + "1",
+		"{a}" + sep + "abc" + sep + sep,
+	} {
+		if _, err := parseTrieLine(line, sep); err == nil {
+			t.Errorf("parseTrieLine(%q) 应该返回错误", line)
+		}
+	}
+}
+
+// 每行一个 路径<SEP>值 的形式，数字键按对象创建
+func TestParseTrieEntriesLines(t *testing.T) {
+	sep := "|"
+	content := "{a}|[0]|1|\r\n\n{a}|[1]|x\n{7}|{b}|{}|\n{e}|[]|\n"
+	entries, err := parseTrieEntries(content, sep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := buildFromEntries(entries, trieRoot(entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":[1,"x"],"7":{"b":{}},"e":[]}`; !sameJSON(t, got, want) {
+		t.Errorf("得到 %s，期望 %s", got, want)
+	}
+
+	if _, err := parseTrieEntries(content, ""); err == nil {
+		t.Errorf("空的分隔符应该返回错误")
+	}
+	if _, err := parseTrieEntries("{a}|1|\nbad|x\n", sep); err == nil {
+		t.Errorf("无效的路径段应该返回错误")
+	}
+
+	entries, err = parseTrieEntries(`[$'{a}\034']=$'x' [$'']=$'1\034'`, testTrieSep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildFromEntries(entries, trieRoot(entries)); err == nil {
+		t.Errorf("根节点和其它路径同时出现应该返回错误")
+	}
+}
+
+func TestParsePropsEntries(t *testing.T) {
+	content := `# 注释
+  # 缩进的注释
+
+name=gobolt
+port=i:8080
+ratio=i:-1.5e3
+on=t:
+off=f:
+nothing=n:
+str=s:i:42
+plain=i
+tags=a:["a","b"]
+meta=o:{"k":1}
+list.0=first
+list.-1=second
+ids.:1.name=one
+ids.:2=s:two
+a\=b=eq
+empty=
+url=http://x/?a=1
+`
+	entries, err := parsePropsEntries(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := buildFromEntries(entries, "{}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+		"name":"gobolt","port":8080,"ratio":-1.5e3,
+		"on":true,"off":false,"nothing":null,
+		"str":"i:42","plain":"i",
+		"tags":["a","b"],"meta":{"k":1},
+		"list":["first","second"],
+		"ids":{"1":{"name":"one"},"2":"two"},
+		"a=b":"eq","empty":"","url":"http://x/?a=1"
+	}`
+	if !sameJSON(t, got, want) {
+		t.Errorf("得到 %s\n期望 %s", got, want)
+	}
+
+	for _, bad := range []string{
+		"noeq",
+		"=value",
+		"port=i:abc",
+		"meta=o:[1]",
+		"tags=a:{}",
+		"tags=a:[1,",
+	} {
+		if _, err := parsePropsEntries(bad); err == nil {
+			t.Errorf("parsePropsEntries(%q) 应该返回错误", bad)
+		}
+	}
+}
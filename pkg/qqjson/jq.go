@@ -0,0 +1,2360 @@
+package qqjson
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"common_tool/pkg/sh"
+)
+
+// jq 语法的一个子集，用于 -m q 模式的查询
+// 支持:
+//   . .foo ."foo" .[n] .[a:b] .[] .. ? | , ( )
+//   字面量 数字 字符串("\(表达式)" 插值) true false null [..] {..}
+//   + - * / % == != < <= > >= and or not //
+//   if A then B elif C then D else E end
+//   表达式 as $name | 表达式
+//   @json @text @csv @tsv @sh @base64 @base64d @uri
+//   内置函数见 queryBuiltins
+// 数字统一按 float64 处理，超过 2^53 的整数会丢失精度
+
+// ---------------------------------------------------------------------
+// 词法分析
+
+type queryTokenKind int
+
+const (
+	qtEOF    queryTokenKind = iota
+	qtIdent                 // 关键字和函数名
+	qtField                 // .foo
+	qtVar                   // $name
+	qtFormat                // @base64
+	qtNumber                // 1 1.5 1e3
+	qtString                // "..."，可能带插值
+	qtOp                    // 标点和运算符
+)
+
+type queryToken struct {
+	kind  queryTokenKind
+	text  string
+	num   float64
+	parts []queryStrPart
+	pos   int
+}
+
+// 字符串中的一段，expr 不为 nil 时是 \(...) 插值
+type queryStrPart struct {
+	lit  string
+	expr queryNode
+}
+
+// 按长度从长到短排列，保证先匹配到长的运算符
+var queryOps = []string{
+	"==", "!=", "<=", ">=", "//", "..",
+	"|", ",", "(", ")", "[", "]", "{", "}", ":", ";", "?",
+	"+", "-", "*", "/", "%", "<", ">", ".",
+}
+
+func isQueryIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isQueryIdentPart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// 从 start 开始词法分析，stopAtParen 为 true 的时候遇到不匹配的 ) 就停止，
+// 用于字符串插值 \(...)，返回停止处 ) 之后的位置
+func lexQuery(src string, start int, stopAtParen bool) ([]queryToken, int, error) {
+	var tokens []queryToken
+	depth := 0
+	i := start
+
+	for i < len(src) {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			continue
+		case r == '#':
+			// 注释到行尾
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case r == '"':
+			parts, next, err := lexQueryString(src, i+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			tokens = append(tokens, queryToken{kind: qtString, parts: parts, pos: i})
+			i = next
+			continue
+		case r == '$' || r == '@':
+			j := i + 1
+			for j < len(src) {
+				r2, s2 := utf8.DecodeRuneInString(src[j:])
+				if !isQueryIdentPart(r2) {
+					break
+				}
+				j += s2
+			}
+			if j == i+1 {
+				return nil, 0, fmt.Errorf("位置 %d: %c 后面缺少名字", i, r)
+			}
+			kind := qtVar
+			if r == '@' {
+				kind = qtFormat
+			}
+			tokens = append(tokens, queryToken{kind: kind, text: src[i+1 : j], pos: i})
+			i = j
+			continue
+		case r >= '0' && r <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			if j < len(src) && (src[j] == 'e' || src[j] == 'E') {
+				j++
+				if j < len(src) && (src[j] == '+' || src[j] == '-') {
+					j++
+				}
+				for j < len(src) && src[j] >= '0' && src[j] <= '9' {
+					j++
+				}
+			}
+			n, err := strconv.ParseFloat(src[i:j], 64)
+			if err != nil {
+				return nil, 0, fmt.Errorf("位置 %d: 无效的数字 %q", i, src[i:j])
+			}
+			tokens = append(tokens, queryToken{kind: qtNumber, num: n, text: src[i:j], pos: i})
+			i = j
+			continue
+		case isQueryIdentStart(r):
+			j := i
+			for j < len(src) {
+				r2, s2 := utf8.DecodeRuneInString(src[j:])
+				if !isQueryIdentPart(r2) {
+					break
+				}
+				j += s2
+			}
+			tokens = append(tokens, queryToken{kind: qtIdent, text: src[i:j], pos: i})
+			i = j
+			continue
+		case r == '.' && i+1 < len(src):
+			// .foo 作为一个整体，. 和 foo 之间不能有空格
+			r2, _ := utf8.DecodeRuneInString(src[i+1:])
+			if isQueryIdentStart(r2) {
+				j := i + 1
+				for j < len(src) {
+					r3, s3 := utf8.DecodeRuneInString(src[j:])
+					if !isQueryIdentPart(r3) {
+						break
+					}
+					j += s3
+				}
+				tokens = append(tokens, queryToken{kind: qtField, text: src[i+1 : j], pos: i})
+				i = j
+				continue
+			}
+		}
+
+		matched := ""
+		for _, op := range queryOps {
+			if strings.HasPrefix(src[i:], op) {
+				matched = op
+				break
+			}
+		}
+		if matched == "" {
+			return nil, 0, fmt.Errorf("位置 %d: 无法识别的字符 %q", i, r)
+		}
+
+		if stopAtParen {
+			if matched == "(" {
+				depth++
+			} else if matched == ")" {
+				if depth == 0 {
+					tokens = append(tokens, queryToken{kind: qtEOF, pos: i})
+					return tokens, i + 1, nil
+				}
+				depth--
+			}
+		}
+		tokens = append(tokens, queryToken{kind: qtOp, text: matched, pos: i})
+		i += len(matched)
+	}
+
+	if stopAtParen {
+		return nil, 0, fmt.Errorf("字符串插值缺少 )")
+	}
+	tokens = append(tokens, queryToken{kind: qtEOF, pos: i})
+	return tokens, i, nil
+}
+
+// 从引号之后开始解析字符串，返回结束引号之后的位置
+func lexQueryString(src string, start int) ([]queryStrPart, int, error) {
+	var parts []queryStrPart
+	var lit strings.Builder
+
+	i := start
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == '"':
+			if lit.Len() > 0 || len(parts) == 0 {
+				parts = append(parts, queryStrPart{lit: lit.String()})
+			}
+			return parts, i + 1, nil
+		case c == '\\' && i+1 < len(src):
+			e := src[i+1]
+			i += 2
+			switch e {
+			case '(':
+				tokens, next, err := lexQuery(src, i, true)
+				if err != nil {
+					return nil, 0, err
+				}
+				expr, err := parseQueryTokens(tokens)
+				if err != nil {
+					return nil, 0, err
+				}
+				if lit.Len() > 0 {
+					parts = append(parts, queryStrPart{lit: lit.String()})
+					lit.Reset()
+				}
+				parts = append(parts, queryStrPart{expr: expr})
+				i = next
+			case 'n':
+				lit.WriteByte('\n')
+			case 't':
+				lit.WriteByte('\t')
+			case 'r':
+				lit.WriteByte('\r')
+			case 'b':
+				lit.WriteByte('\b')
+			case 'f':
+				lit.WriteByte('\f')
+			case 'u':
+				if i+4 > len(src) {
+					return nil, 0, fmt.Errorf("无效的 \\u 转义")
+				}
+				n, err := strconv.ParseUint(src[i:i+4], 16, 32)
+				if err != nil {
+					return nil, 0, fmt.Errorf("无效的 \\u 转义: %s", src[i:i+4])
+				}
+				lit.WriteRune(rune(n))
+				i += 4
+			default:
+				lit.WriteByte(e)
+			}
+		default:
+			lit.WriteByte(c)
+			i++
+		}
+	}
+	return nil, 0, fmt.Errorf("字符串缺少结束的引号")
+}
+
+// ---------------------------------------------------------------------
+// 语法分析
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func parseQuery(src string) (queryNode, error) {
+	tokens, _, err := lexQuery(src, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	return parseQueryTokens(tokens)
+}
+
+func parseQueryTokens(tokens []queryToken) (queryNode, error) {
+	p := &queryParser{tokens: tokens}
+	if p.peek().kind == qtEOF {
+		return identityNode{}, nil
+	}
+	node, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != qtEOF {
+		return nil, fmt.Errorf("位置 %d: 多余的内容 %q", tok.pos, tok.text)
+	}
+	return node, nil
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != qtEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *queryParser) isOp(text string) bool {
+	tok := p.peek()
+	return tok.kind == qtOp && tok.text == text
+}
+
+func (p *queryParser) isKeyword(text string) bool {
+	tok := p.peek()
+	return tok.kind == qtIdent && tok.text == text
+}
+
+func (p *queryParser) expectOp(text string) error {
+	if !p.isOp(text) {
+		tok := p.peek()
+		return fmt.Errorf("位置 %d: 期望 %q，实际是 %q", tok.pos, text, tok.text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *queryParser) expectKeyword(text string) error {
+	if !p.isKeyword(text) {
+		tok := p.peek()
+		return fmt.Errorf("位置 %d: 期望 %q，实际是 %q", tok.pos, text, tok.text)
+	}
+	p.next()
+	return nil
+}
+
+// pipe: term as $x | pipe
+//
+//	| comma ('|' pipe)?
+func (p *queryParser) parsePipe() (queryNode, error) {
+	start := p.pos
+	if term, err := p.parsePostfix(); err == nil && p.isKeyword("as") {
+		p.next()
+		tok := p.next()
+		if tok.kind != qtVar {
+			return nil, fmt.Errorf("位置 %d: as 后面必须是 $变量", tok.pos)
+		}
+		if err := p.expectOp("|"); err != nil {
+			return nil, err
+		}
+		body, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		return bindNode{source: term, name: tok.text, body: body}, nil
+	}
+	p.pos = start
+
+	left, err := p.parseComma()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOp("|") {
+		p.next()
+		right, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		return pipeNode{left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseComma() (queryNode, error) {
+	left, err := p.parseAlternative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(",") {
+		p.next()
+		right, err := p.parseAlternative()
+		if err != nil {
+			return nil, err
+		}
+		left = commaNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAlternative() (queryNode, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOp("//") {
+		p.next()
+		right, err := p.parseAlternative()
+		if err != nil {
+			return nil, err
+		}
+		return alternativeNode{left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicNode{and: false, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		left = logicNode{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseCompare() (queryNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.isOp(op) {
+			p.next()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return binaryNode{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAdditive() (queryNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+") || p.isOp("-") {
+		op := p.next().text
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseMultiplicative() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*") || p.isOp("/") || p.isOp("%") {
+		op := p.next().text
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.isOp("-") {
+		p.next()
+		operand, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		return negateNode{operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+// term 后面跟着 .foo [..] ? 这些后缀
+func (p *queryParser) parsePostfix() (queryNode, error) {
+	term, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		switch {
+		case tok.kind == qtField:
+			p.next()
+			term = indexNode{target: term, index: literalNode{value: tok.text}}
+		case tok.kind == qtOp && tok.text == "." && p.tokens[p.pos+1].kind == qtString:
+			p.next()
+			key, err := p.parseStringLiteral(p.next())
+			if err != nil {
+				return nil, err
+			}
+			term = indexNode{target: term, index: key}
+		case tok.kind == qtOp && tok.text == "." && p.tokens[p.pos+1].kind == qtOp && p.tokens[p.pos+1].text == "[":
+			// .a.[0] 和 .a[0] 相同
+			p.next()
+		case tok.kind == qtOp && tok.text == "[":
+			term, err = p.parseBracketSuffix(term)
+			if err != nil {
+				return nil, err
+			}
+		case tok.kind == qtOp && tok.text == "?":
+			p.next()
+			term = tryNode{body: term}
+		default:
+			return term, nil
+		}
+	}
+}
+
+// [] [n] [a:b] [:b] [a:]
+func (p *queryParser) parseBracketSuffix(target queryNode) (queryNode, error) {
+	p.next()
+	if p.isOp("]") {
+		p.next()
+		return iterateNode{target: target}, nil
+	}
+
+	var from, to queryNode
+	var err error
+	if !p.isOp(":") {
+		from, err = p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.isOp(":") {
+		p.next()
+		if !p.isOp("]") {
+			to, err = p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expectOp("]"); err != nil {
+			return nil, err
+		}
+		return sliceNode{target: target, from: from, to: to}, nil
+	}
+	if err := p.expectOp("]"); err != nil {
+		return nil, err
+	}
+	return indexNode{target: target, index: from}, nil
+}
+
+func (p *queryParser) parseStringLiteral(tok queryToken) (queryNode, error) {
+	if len(tok.parts) == 1 && tok.parts[0].expr == nil {
+		return literalNode{value: tok.parts[0].lit}, nil
+	}
+	return stringNode{parts: tok.parts}, nil
+}
+
+func (p *queryParser) parseTerm() (queryNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case qtNumber:
+		return literalNode{value: tok.num}, nil
+	case qtString:
+		return p.parseStringLiteral(tok)
+	case qtField:
+		return indexNode{target: identityNode{}, index: literalNode{value: tok.text}}, nil
+	case qtVar:
+		return varNode{name: tok.text}, nil
+	case qtFormat:
+		return formatNode{name: tok.text}, nil
+	case qtIdent:
+		return p.parseIdent(tok)
+	case qtOp:
+		switch tok.text {
+		case ".":
+			if p.peek().kind == qtString {
+				key, err := p.parseStringLiteral(p.next())
+				if err != nil {
+					return nil, err
+				}
+				return indexNode{target: identityNode{}, index: key}, nil
+			}
+			return identityNode{}, nil
+		case "..":
+			return recurseNode{}, nil
+		case "(":
+			inner, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		case "[":
+			if p.isOp("]") {
+				p.next()
+				return arrayNode{}, nil
+			}
+			inner, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp("]"); err != nil {
+				return nil, err
+			}
+			return arrayNode{body: inner}, nil
+		case "{":
+			return p.parseObject()
+		}
+	}
+	if tok.kind == qtEOF {
+		return nil, fmt.Errorf("表达式不完整")
+	}
+	return nil, fmt.Errorf("位置 %d: 意外的 %q", tok.pos, tok.text)
+}
+
+func (p *queryParser) parseIdent(tok queryToken) (queryNode, error) {
+	switch tok.text {
+	case "true":
+		return literalNode{value: true}, nil
+	case "false":
+		return literalNode{value: false}, nil
+	case "null":
+		return literalNode{value: nil}, nil
+	case "if":
+		return p.parseIf()
+	case "then", "elif", "else", "end", "as", "and", "or":
+		return nil, fmt.Errorf("位置 %d: 意外的关键字 %q", tok.pos, tok.text)
+	}
+
+	call := callNode{name: tok.text}
+	if p.isOp("(") {
+		p.next()
+		for {
+			arg, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if p.isOp(";") {
+				p.next()
+				continue
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	if _, ok := queryBuiltins[builtinKey(call.name, len(call.args))]; !ok {
+		return nil, fmt.Errorf("位置 %d: 未知的函数 %s/%d", tok.pos, call.name, len(call.args))
+	}
+	return call, nil
+}
+
+func (p *queryParser) parseIf() (queryNode, error) {
+	cond, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("then"); err != nil {
+		return nil, err
+	}
+	then, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+
+	node := ifNode{cond: cond, then: then, otherwise: identityNode{}}
+	switch {
+	case p.isKeyword("elif"):
+		p.next()
+		// elif 等价于 else if ... end，共用最后的 end
+		rest, err := p.parseIf()
+		if err != nil {
+			return nil, err
+		}
+		node.otherwise = rest
+		return node, nil
+	case p.isKeyword("else"):
+		p.next()
+		node.otherwise, err = p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("end"); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// {a, "b": 1, $x, (.k): .v, "\(.x)": 2}
+func (p *queryParser) parseObject() (queryNode, error) {
+	var node objectNode
+	for !p.isOp("}") {
+		tok := p.next()
+		var entry objectEntry
+		switch tok.kind {
+		case qtIdent:
+			entry.key = literalNode{value: tok.text}
+			entry.value = indexNode{target: identityNode{}, index: literalNode{value: tok.text}}
+		case qtVar:
+			entry.key = literalNode{value: tok.text}
+			entry.value = varNode{name: tok.text}
+		case qtString:
+			key, err := p.parseStringLiteral(tok)
+			if err != nil {
+				return nil, err
+			}
+			entry.key = key
+			entry.value = indexNode{target: identityNode{}, index: key}
+		case qtNumber:
+			entry.key = literalNode{value: tok.text}
+		case qtOp:
+			if tok.text != "(" {
+				return nil, fmt.Errorf("位置 %d: 无效的对象键 %q", tok.pos, tok.text)
+			}
+			key, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			entry.key = key
+		default:
+			return nil, fmt.Errorf("位置 %d: 无效的对象键", tok.pos)
+		}
+
+		if p.isOp(":") {
+			p.next()
+			value, err := p.parseAlternative()
+			if err != nil {
+				return nil, err
+			}
+			entry.value = value
+		} else if entry.value == nil {
+			return nil, fmt.Errorf("位置 %d: 对象键后面缺少 :", tok.pos)
+		}
+		node.entries = append(node.entries, entry)
+
+		if p.isOp(",") {
+			p.next()
+			continue
+		}
+		if !p.isOp("}") {
+			tok := p.peek()
+			return nil, fmt.Errorf("位置 %d: 期望 , 或者 }，实际是 %q", tok.pos, tok.text)
+		}
+	}
+	p.next()
+	return node, nil
+}
+
+// ---------------------------------------------------------------------
+// 求值，每个表达式对一个输入产生零个或多个输出
+
+type queryEnv struct {
+	name   string
+	value  any
+	parent *queryEnv
+}
+
+func (e *queryEnv) lookup(name string) (any, bool) {
+	for cur := e; cur != nil; cur = cur.parent {
+		if cur.name == name {
+			return cur.value, true
+		}
+	}
+	return nil, false
+}
+
+type queryNode interface {
+	eval(env *queryEnv, in any) ([]any, error)
+}
+
+type identityNode struct{}
+
+func (identityNode) eval(_ *queryEnv, in any) ([]any, error) {
+	return []any{in}, nil
+}
+
+type literalNode struct{ value any }
+
+func (n literalNode) eval(_ *queryEnv, _ any) ([]any, error) {
+	return []any{n.value}, nil
+}
+
+type stringNode struct{ parts []queryStrPart }
+
+func (n stringNode) eval(env *queryEnv, in any) ([]any, error) {
+	results := []string{""}
+	for _, part := range n.parts {
+		if part.expr == nil {
+			for i := range results {
+				results[i] += part.lit
+			}
+			continue
+		}
+		outs, err := part.expr.eval(env, in)
+		if err != nil {
+			return nil, err
+		}
+		var next []string
+		for _, prefix := range results {
+			for _, out := range outs {
+				next = append(next, prefix+queryToString(out))
+			}
+		}
+		results = next
+	}
+
+	values := make([]any, len(results))
+	for i, s := range results {
+		values[i] = s
+	}
+	return values, nil
+}
+
+type varNode struct{ name string }
+
+func (n varNode) eval(env *queryEnv, _ any) ([]any, error) {
+	v, ok := env.lookup(n.name)
+	if !ok {
+		return nil, fmt.Errorf("未定义的变量 $%s", n.name)
+	}
+	return []any{v}, nil
+}
+
+type bindNode struct {
+	source queryNode
+	name   string
+	body   queryNode
+}
+
+func (n bindNode) eval(env *queryEnv, in any) ([]any, error) {
+	values, err := n.source.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	for _, v := range values {
+		res, err := n.body.eval(&queryEnv{name: n.name, value: v, parent: env}, in)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, res...)
+	}
+	return out, nil
+}
+
+type pipeNode struct{ left, right queryNode }
+
+func (n pipeNode) eval(env *queryEnv, in any) ([]any, error) {
+	values, err := n.left.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	for _, v := range values {
+		res, err := n.right.eval(env, v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, res...)
+	}
+	return out, nil
+}
+
+type commaNode struct{ left, right queryNode }
+
+func (n commaNode) eval(env *queryEnv, in any) ([]any, error) {
+	left, err := n.left.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+	return append(left, right...), nil
+}
+
+type indexNode struct{ target, index queryNode }
+
+func (n indexNode) eval(env *queryEnv, in any) ([]any, error) {
+	targets, err := n.target.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := n.index.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []any
+	for _, t := range targets {
+		for _, idx := range indexes {
+			v, err := queryIndex(t, idx)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+func queryIndex(t, idx any) (any, error) {
+	switch tv := t.(type) {
+	case nil:
+		return nil, nil
+	case map[string]any:
+		key, ok := idx.(string)
+		if !ok {
+			return nil, fmt.Errorf("不能用 %s 索引对象", queryTypeName(idx))
+		}
+		return tv[key], nil
+	case []any:
+		f, ok := idx.(float64)
+		if !ok {
+			return nil, fmt.Errorf("不能用 %s 索引数组", queryTypeName(idx))
+		}
+		i := int(math.Floor(f))
+		if i < 0 {
+			i += len(tv)
+		}
+		if i < 0 || i >= len(tv) {
+			return nil, nil
+		}
+		return tv[i], nil
+	default:
+		return nil, fmt.Errorf("不能索引 %s", queryTypeName(t))
+	}
+}
+
+type sliceNode struct{ target, from, to queryNode }
+
+func (n sliceNode) eval(env *queryEnv, in any) ([]any, error) {
+	targets, err := n.target.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+
+	bound := func(node queryNode) ([]any, error) {
+		if node == nil {
+			return []any{nil}, nil
+		}
+		return node.eval(env, in)
+	}
+	froms, err := bound(n.from)
+	if err != nil {
+		return nil, err
+	}
+	tos, err := bound(n.to)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []any
+	for _, t := range targets {
+		for _, from := range froms {
+			for _, to := range tos {
+				v, err := querySlice(t, from, to)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, v)
+			}
+		}
+	}
+	return out, nil
+}
+
+func querySlice(t, from, to any) (any, error) {
+	var length int
+	switch tv := t.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		length = len(tv)
+	case string:
+		length = utf8.RuneCountInString(tv)
+	default:
+		return nil, fmt.Errorf("不能对 %s 切片", queryTypeName(t))
+	}
+
+	clamp := func(v any, def int) (int, error) {
+		if v == nil {
+			return def, nil
+		}
+		f, ok := v.(float64)
+		if !ok {
+			return 0, fmt.Errorf("切片的下标必须是数字")
+		}
+		i := int(math.Floor(f))
+		if i < 0 {
+			i += length
+		}
+		return max(0, min(i, length)), nil
+	}
+	start, err := clamp(from, 0)
+	if err != nil {
+		return nil, err
+	}
+	end, err := clamp(to, length)
+	if err != nil {
+		return nil, err
+	}
+	if end < start {
+		end = start
+	}
+
+	if arr, ok := t.([]any); ok {
+		return append([]any{}, arr[start:end]...), nil
+	}
+	return string([]rune(t.(string))[start:end]), nil
+}
+
+type iterateNode struct{ target queryNode }
+
+func (n iterateNode) eval(env *queryEnv, in any) ([]any, error) {
+	targets, err := n.target.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	for _, t := range targets {
+		values, err := queryValues(t)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, values...)
+	}
+	return out, nil
+}
+
+// 数组的元素或者对象的值，对象按键排序保证输出稳定
+func queryValues(v any) ([]any, error) {
+	switch tv := v.(type) {
+	case []any:
+		return tv, nil
+	case map[string]any:
+		out := make([]any, 0, len(tv))
+		for _, k := range sortedKeys(tv) {
+			out = append(out, tv[k])
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("不能遍历 %s", queryTypeName(v))
+	}
+}
+
+type recurseNode struct{}
+
+func (recurseNode) eval(_ *queryEnv, in any) ([]any, error) {
+	var out []any
+	var walk func(v any)
+	walk = func(v any) {
+		out = append(out, v)
+		if children, err := queryValues(v); err == nil {
+			for _, c := range children {
+				walk(c)
+			}
+		}
+	}
+	walk(in)
+	return out, nil
+}
+
+type tryNode struct{ body queryNode }
+
+func (n tryNode) eval(env *queryEnv, in any) ([]any, error) {
+	out, err := n.body.eval(env, in)
+	if err != nil {
+		return nil, nil
+	}
+	return out, nil
+}
+
+type arrayNode struct{ body queryNode }
+
+func (n arrayNode) eval(env *queryEnv, in any) ([]any, error) {
+	if n.body == nil {
+		return []any{[]any{}}, nil
+	}
+	values, err := n.body.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = []any{}
+	}
+	return []any{values}, nil
+}
+
+type objectEntry struct{ key, value queryNode }
+
+type objectNode struct{ entries []objectEntry }
+
+// 每个键和值都可能有多个输出，结果是所有组合
+func (n objectNode) eval(env *queryEnv, in any) ([]any, error) {
+	results := []map[string]any{{}}
+	for _, entry := range n.entries {
+		keys, err := entry.key.eval(env, in)
+		if err != nil {
+			return nil, err
+		}
+		values, err := entry.value.eval(env, in)
+		if err != nil {
+			return nil, err
+		}
+
+		var next []map[string]any
+		for _, base := range results {
+			for _, k := range keys {
+				key, ok := k.(string)
+				if !ok {
+					return nil, fmt.Errorf("对象的键必须是字符串，实际是 %s", queryTypeName(k))
+				}
+				for _, v := range values {
+					obj := make(map[string]any, len(base)+1)
+					for bk, bv := range base {
+						obj[bk] = bv
+					}
+					obj[key] = v
+					next = append(next, obj)
+				}
+			}
+		}
+		results = next
+	}
+
+	out := make([]any, len(results))
+	for i, r := range results {
+		out[i] = r
+	}
+	return out, nil
+}
+
+type negateNode struct{ operand queryNode }
+
+func (n negateNode) eval(env *queryEnv, in any) ([]any, error) {
+	values, err := n.operand.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]any, 0, len(values))
+	for _, v := range values {
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("不能对 %s 取负", queryTypeName(v))
+		}
+		out = append(out, -f)
+	}
+	return out, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right queryNode
+}
+
+func (n binaryNode) eval(env *queryEnv, in any) ([]any, error) {
+	lefts, err := n.left.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+	rights, err := n.right.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []any
+	for _, r := range rights {
+		for _, l := range lefts {
+			v, err := queryBinary(n.op, l, r)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+func queryBinary(op string, l, r any) (any, error) {
+	switch op {
+	case "==":
+		return compareQueryValues(l, r) == 0, nil
+	case "!=":
+		return compareQueryValues(l, r) != 0, nil
+	case "<":
+		return compareQueryValues(l, r) < 0, nil
+	case "<=":
+		return compareQueryValues(l, r) <= 0, nil
+	case ">":
+		return compareQueryValues(l, r) > 0, nil
+	case ">=":
+		return compareQueryValues(l, r) >= 0, nil
+	case "+":
+		return queryAdd(l, r)
+	}
+
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	switch op {
+	case "-":
+		if lok && rok {
+			return lf - rf, nil
+		}
+		la, lok := l.([]any)
+		ra, rok := r.([]any)
+		if lok && rok {
+			out := []any{}
+			for _, item := range la {
+				if !slicesContainsQuery(ra, item) {
+					out = append(out, item)
+				}
+			}
+			return out, nil
+		}
+	case "*":
+		if lok && rok {
+			return lf * rf, nil
+		}
+		lm, lok := l.(map[string]any)
+		rm, rok := r.(map[string]any)
+		if lok && rok {
+			return queryDeepMerge(lm, rm), nil
+		}
+	case "/":
+		if lok && rok {
+			if rf == 0 {
+				return nil, fmt.Errorf("除数不能为 0")
+			}
+			return lf / rf, nil
+		}
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		if lok && rok {
+			return splitToQueryArray(ls, rs), nil
+		}
+	case "%":
+		if lok && rok {
+			ri := int64(rf)
+			if ri == 0 {
+				return nil, fmt.Errorf("除数不能为 0")
+			}
+			return float64(int64(lf) % ri), nil
+		}
+	}
+	return nil, fmt.Errorf("%s 和 %s 不能进行 %s 运算", queryTypeName(l), queryTypeName(r), op)
+}
+
+func queryAdd(l, r any) (any, error) {
+	if l == nil {
+		return r, nil
+	}
+	if r == nil {
+		return l, nil
+	}
+	switch lv := l.(type) {
+	case float64:
+		if rv, ok := r.(float64); ok {
+			return lv + rv, nil
+		}
+	case string:
+		if rv, ok := r.(string); ok {
+			return lv + rv, nil
+		}
+	case []any:
+		if rv, ok := r.([]any); ok {
+			return append(append([]any{}, lv...), rv...), nil
+		}
+	case map[string]any:
+		if rv, ok := r.(map[string]any); ok {
+			out := make(map[string]any, len(lv)+len(rv))
+			for k, v := range lv {
+				out[k] = v
+			}
+			for k, v := range rv {
+				out[k] = v
+			}
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("%s 和 %s 不能相加", queryTypeName(l), queryTypeName(r))
+}
+
+func queryDeepMerge(l, r map[string]any) map[string]any {
+	out := make(map[string]any, len(l)+len(r))
+	for k, v := range l {
+		out[k] = v
+	}
+	for k, v := range r {
+		lm, lok := out[k].(map[string]any)
+		rm, rok := v.(map[string]any)
+		if lok && rok {
+			out[k] = queryDeepMerge(lm, rm)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+type logicNode struct {
+	and         bool
+	left, right queryNode
+}
+
+func (n logicNode) eval(env *queryEnv, in any) ([]any, error) {
+	lefts, err := n.left.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	for _, l := range lefts {
+		// 短路求值
+		if n.and && !queryTruthy(l) {
+			out = append(out, false)
+			continue
+		}
+		if !n.and && queryTruthy(l) {
+			out = append(out, true)
+			continue
+		}
+		rights, err := n.right.eval(env, in)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rights {
+			out = append(out, queryTruthy(r))
+		}
+	}
+	return out, nil
+}
+
+type alternativeNode struct{ left, right queryNode }
+
+// a // b: a 中不是 false/null 的输出，没有的话输出 b，a 中的错误被忽略
+func (n alternativeNode) eval(env *queryEnv, in any) ([]any, error) {
+	lefts, _ := n.left.eval(env, in)
+	var out []any
+	for _, l := range lefts {
+		if queryTruthy(l) {
+			out = append(out, l)
+		}
+	}
+	if len(out) > 0 {
+		return out, nil
+	}
+	return n.right.eval(env, in)
+}
+
+type ifNode struct{ cond, then, otherwise queryNode }
+
+func (n ifNode) eval(env *queryEnv, in any) ([]any, error) {
+	conds, err := n.cond.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	for _, c := range conds {
+		branch := n.otherwise
+		if queryTruthy(c) {
+			branch = n.then
+		}
+		res, err := branch.eval(env, in)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, res...)
+	}
+	return out, nil
+}
+
+type formatNode struct{ name string }
+
+func (n formatNode) eval(_ *queryEnv, in any) ([]any, error) {
+	s, err := queryFormat(n.name, in)
+	if err != nil {
+		return nil, err
+	}
+	return []any{s}, nil
+}
+
+func queryFormat(name string, in any) (string, error) {
+	switch name {
+	case "json":
+		return compactJSON(in), nil
+	case "text":
+		return queryToString(in), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString([]byte(queryToString(in))), nil
+	case "base64d":
+		data, err := base64.StdEncoding.DecodeString(queryToString(in))
+		if err != nil {
+			return "", fmt.Errorf("无效的 base64: %w", err)
+		}
+		return string(data), nil
+	case "uri":
+		return queryURIEscape(queryToString(in)), nil
+	case "sh":
+		// 和 -t sh 一样使用 $'...' 引用，数组按空格连接每个引用后的元素
+		items, ok := in.([]any)
+		if !ok {
+			items = []any{in}
+		}
+		parts := make([]string, 0, len(items))
+		for _, item := range items {
+			switch item.(type) {
+			case map[string]any, []any:
+				return "", fmt.Errorf("@sh 不能格式化 %s", queryTypeName(item))
+			}
+			parts = append(parts, sh.BashANSIQuote(queryToString(item)))
+		}
+		return strings.Join(parts, " "), nil
+	case "csv", "tsv":
+		items, ok := in.([]any)
+		if !ok {
+			return "", fmt.Errorf("@%s 的输入必须是数组", name)
+		}
+		parts := make([]string, 0, len(items))
+		for _, item := range items {
+			s := queryToString(item)
+			if item == nil {
+				s = ""
+			}
+			if name == "csv" {
+				if _, isStr := item.(string); isStr {
+					s = `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+				}
+			} else {
+				s = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`).Replace(s)
+			}
+			parts = append(parts, s)
+		}
+		sep := ","
+		if name == "tsv" {
+			sep = "\t"
+		}
+		return strings.Join(parts, sep), nil
+	default:
+		return "", fmt.Errorf("未知的格式 @%s", name)
+	}
+}
+
+// 和 jq 一样，除了 A-Z a-z 0-9 -_.~ 以外的字节都按 %XX 编码，空格是 %20 而不是 +
+func queryURIEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+type callNode struct {
+	name string
+	args []queryNode
+}
+
+func (n callNode) eval(env *queryEnv, in any) ([]any, error) {
+	fn := queryBuiltins[builtinKey(n.name, len(n.args))]
+	return fn(env, in, n.args)
+}
+
+// ---------------------------------------------------------------------
+// 内置函数
+
+type queryBuiltin func(env *queryEnv, in any, args []queryNode) ([]any, error)
+
+func builtinKey(name string, arity int) string {
+	return name + "/" + strconv.Itoa(arity)
+}
+
+var queryBuiltins map[string]queryBuiltin
+
+// 只有一个输出的简单函数
+func simpleBuiltin(fn func(in any) (any, error)) queryBuiltin {
+	return func(_ *queryEnv, in any, _ []queryNode) ([]any, error) {
+		v, err := fn(in)
+		if err != nil {
+			return nil, err
+		}
+		return []any{v}, nil
+	}
+}
+
+// 参数按值使用的函数，对参数的每个输出各调用一次
+func valueArgBuiltin(fn func(in, arg any) (any, error)) queryBuiltin {
+	return func(env *queryEnv, in any, args []queryNode) ([]any, error) {
+		values, err := args[0].eval(env, in)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]any, 0, len(values))
+		for _, a := range values {
+			v, err := fn(in, a)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	}
+}
+
+// 对数组的每个元素求 f 的第一个输出，用于 sort_by group_by 这类函数
+func evalKeys(env *queryEnv, in any, f queryNode, name string) ([]any, []any, error) {
+	arr, ok := in.([]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s 的输入必须是数组，实际是 %s", name, queryTypeName(in))
+	}
+	keys := make([]any, len(arr))
+	for i, item := range arr {
+		res, err := f.eval(env, item)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(res) == 1 {
+			keys[i] = res[0]
+		} else {
+			keys[i] = res
+		}
+	}
+	return arr, keys, nil
+}
+
+func init() {
+	queryBuiltins = map[string]queryBuiltin{
+		"empty/0": func(_ *queryEnv, _ any, _ []queryNode) ([]any, error) {
+			return nil, nil
+		},
+		"error/1": func(env *queryEnv, in any, args []queryNode) ([]any, error) {
+			msgs, err := args[0].eval(env, in)
+			if err != nil {
+				return nil, err
+			}
+			if len(msgs) == 0 {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("%s", queryToString(msgs[0]))
+		},
+		"not/0": simpleBuiltin(func(in any) (any, error) {
+			return !queryTruthy(in), nil
+		}),
+		"length/0": simpleBuiltin(func(in any) (any, error) {
+			switch v := in.(type) {
+			case nil:
+				return float64(0), nil
+			case bool:
+				return nil, fmt.Errorf("boolean 没有长度")
+			case float64:
+				return math.Abs(v), nil
+			case string:
+				return float64(utf8.RuneCountInString(v)), nil
+			case []any:
+				return float64(len(v)), nil
+			case map[string]any:
+				return float64(len(v)), nil
+			}
+			return nil, fmt.Errorf("%s 没有长度", queryTypeName(in))
+		}),
+		"keys/0":          simpleBuiltin(queryKeys),
+		"keys_unsorted/0": simpleBuiltin(queryKeys),
+		"values/0": func(_ *queryEnv, in any, _ []queryNode) ([]any, error) {
+			if in == nil {
+				return nil, nil
+			}
+			return []any{in}, nil
+		},
+		"type/0": simpleBuiltin(func(in any) (any, error) {
+			return queryTypeName(in), nil
+		}),
+		"has/1": valueArgBuiltin(func(in, key any) (any, error) {
+			switch v := in.(type) {
+			case map[string]any:
+				k, ok := key.(string)
+				if !ok {
+					return nil, fmt.Errorf("对象的键必须是字符串")
+				}
+				_, exists := v[k]
+				return exists, nil
+			case []any:
+				f, ok := key.(float64)
+				if !ok {
+					return nil, fmt.Errorf("数组的下标必须是数字")
+				}
+				return f >= 0 && int(f) < len(v), nil
+			}
+			return nil, fmt.Errorf("不能对 %s 使用 has", queryTypeName(in))
+		}),
+		"select/1": func(env *queryEnv, in any, args []queryNode) ([]any, error) {
+			conds, err := args[0].eval(env, in)
+			if err != nil {
+				return nil, err
+			}
+			var out []any
+			for _, c := range conds {
+				if queryTruthy(c) {
+					out = append(out, in)
+				}
+			}
+			return out, nil
+		},
+		"map/1": func(env *queryEnv, in any, args []queryNode) ([]any, error) {
+			return arrayNode{body: pipeNode{left: iterateNode{target: identityNode{}}, right: args[0]}}.eval(env, in)
+		},
+		"map_values/1": func(env *queryEnv, in any, args []queryNode) ([]any, error) {
+			switch v := in.(type) {
+			case []any:
+				out := make([]any, 0, len(v))
+				for _, item := range v {
+					res, err := args[0].eval(env, item)
+					if err != nil {
+						return nil, err
+					}
+					if len(res) > 0 {
+						out = append(out, res[0])
+					}
+				}
+				return []any{out}, nil
+			case map[string]any:
+				out := make(map[string]any, len(v))
+				for k, item := range v {
+					res, err := args[0].eval(env, item)
+					if err != nil {
+						return nil, err
+					}
+					if len(res) > 0 {
+						out[k] = res[0]
+					}
+				}
+				return []any{out}, nil
+			}
+			return nil, fmt.Errorf("不能遍历 %s", queryTypeName(in))
+		},
+		"to_entries/0": simpleBuiltin(func(in any) (any, error) {
+			obj, ok := in.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("to_entries 的输入必须是对象")
+			}
+			out := make([]any, 0, len(obj))
+			for _, k := range sortedKeys(obj) {
+				out = append(out, map[string]any{"key": k, "value": obj[k]})
+			}
+			return out, nil
+		}),
+		"from_entries/0": simpleBuiltin(queryFromEntries),
+		"with_entries/1": func(env *queryEnv, in any, args []queryNode) ([]any, error) {
+			entries, err := queryBuiltins["to_entries/0"](env, in, nil)
+			if err != nil {
+				return nil, err
+			}
+			mapped, err := queryBuiltins["map/1"](env, entries[0], args)
+			if err != nil {
+				return nil, err
+			}
+			return simpleBuiltin(queryFromEntries)(env, mapped[0], nil)
+		},
+		"add/0": simpleBuiltin(func(in any) (any, error) {
+			values, err := queryValues(in)
+			if err != nil {
+				return nil, err
+			}
+			var acc any
+			for _, v := range values {
+				if acc, err = queryAdd(acc, v); err != nil {
+					return nil, err
+				}
+			}
+			return acc, nil
+		}),
+		"any/0": simpleBuiltin(func(in any) (any, error) {
+			values, err := queryValues(in)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range values {
+				if queryTruthy(v) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}),
+		"all/0": simpleBuiltin(func(in any) (any, error) {
+			values, err := queryValues(in)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range values {
+				if !queryTruthy(v) {
+					return false, nil
+				}
+			}
+			return true, nil
+		}),
+		"flatten/0": simpleBuiltin(func(in any) (any, error) {
+			return queryFlatten(in, -1)
+		}),
+		"flatten/1": valueArgBuiltin(func(in, depth any) (any, error) {
+			d, ok := depth.(float64)
+			if !ok || d < 0 {
+				return nil, fmt.Errorf("flatten 的深度必须是非负数")
+			}
+			return queryFlatten(in, int(d))
+		}),
+		"range/1": func(env *queryEnv, in any, args []queryNode) ([]any, error) {
+			return queryRange(env, in, literalNode{value: float64(0)}, args[0])
+		},
+		"range/2": func(env *queryEnv, in any, args []queryNode) ([]any, error) {
+			return queryRange(env, in, args[0], args[1])
+		},
+		"sort/0": simpleBuiltin(func(in any) (any, error) {
+			arr, ok := in.([]any)
+			if !ok {
+				return nil, fmt.Errorf("sort 的输入必须是数组")
+			}
+			out := append([]any{}, arr...)
+			sort.SliceStable(out, func(i, j int) bool { return compareQueryValues(out[i], out[j]) < 0 })
+			return out, nil
+		}),
+		"sort_by/1": func(env *queryEnv, in any, args []queryNode) ([]any, error) {
+			arr, keys, err := evalKeys(env, in, args[0], "sort_by")
+			if err != nil {
+				return nil, err
+			}
+			idx := sortedIndexes(keys)
+			out := make([]any, len(arr))
+			for i, j := range idx {
+				out[i] = arr[j]
+			}
+			return []any{out}, nil
+		},
+		"group_by/1": func(env *queryEnv, in any, args []queryNode) ([]any, error) {
+			arr, keys, err := evalKeys(env, in, args[0], "group_by")
+			if err != nil {
+				return nil, err
+			}
+			out := []any{}
+			var group []any
+			var last any
+			for n, j := range sortedIndexes(keys) {
+				if n > 0 && compareQueryValues(keys[j], last) != 0 {
+					out = append(out, group)
+					group = nil
+				}
+				group = append(group, arr[j])
+				last = keys[j]
+			}
+			if group != nil {
+				out = append(out, group)
+			}
+			return []any{out}, nil
+		},
+		"unique/0": simpleBuiltin(func(in any) (any, error) {
+			arr, ok := in.([]any)
+			if !ok {
+				return nil, fmt.Errorf("unique 的输入必须是数组")
+			}
+			return uniqueByKeys(arr, arr), nil
+		}),
+		"unique_by/1": func(env *queryEnv, in any, args []queryNode) ([]any, error) {
+			arr, keys, err := evalKeys(env, in, args[0], "unique_by")
+			if err != nil {
+				return nil, err
+			}
+			return []any{uniqueByKeys(arr, keys)}, nil
+		},
+		"min/0": simpleBuiltin(func(in any) (any, error) {
+			return queryExtreme(in, in, -1)
+		}),
+		"max/0": simpleBuiltin(func(in any) (any, error) {
+			return queryExtreme(in, in, 1)
+		}),
+		"min_by/1": func(env *queryEnv, in any, args []queryNode) ([]any, error) {
+			_, keys, err := evalKeys(env, in, args[0], "min_by")
+			if err != nil {
+				return nil, err
+			}
+			v, err := queryExtreme(in, keys, -1)
+			return []any{v}, err
+		},
+		"max_by/1": func(env *queryEnv, in any, args []queryNode) ([]any, error) {
+			_, keys, err := evalKeys(env, in, args[0], "max_by")
+			if err != nil {
+				return nil, err
+			}
+			v, err := queryExtreme(in, keys, 1)
+			return []any{v}, err
+		},
+		"reverse/0": simpleBuiltin(func(in any) (any, error) {
+			switch v := in.(type) {
+			case nil:
+				return []any{}, nil
+			case string:
+				rs := []rune(v)
+				for i, j := 0, len(rs)-1; i < j; i, j = i+1, j-1 {
+					rs[i], rs[j] = rs[j], rs[i]
+				}
+				return string(rs), nil
+			case []any:
+				out := make([]any, len(v))
+				for i, item := range v {
+					out[len(v)-1-i] = item
+				}
+				return out, nil
+			}
+			return nil, fmt.Errorf("不能反转 %s", queryTypeName(in))
+		}),
+		"first/0": simpleBuiltin(func(in any) (any, error) {
+			return queryIndex(in, float64(0))
+		}),
+		"last/0": simpleBuiltin(func(in any) (any, error) {
+			return queryIndex(in, float64(-1))
+		}),
+		"first/1": func(env *queryEnv, in any, args []queryNode) ([]any, error) {
+			res, err := args[0].eval(env, in)
+			if err != nil || len(res) == 0 {
+				return nil, err
+			}
+			return res[:1], nil
+		},
+		"last/1": func(env *queryEnv, in any, args []queryNode) ([]any, error) {
+			res, err := args[0].eval(env, in)
+			if err != nil || len(res) == 0 {
+				return nil, err
+			}
+			return res[len(res)-1:], nil
+		},
+		"tostring/0": simpleBuiltin(func(in any) (any, error) {
+			return queryToString(in), nil
+		}),
+		"tonumber/0": simpleBuiltin(func(in any) (any, error) {
+			switch v := in.(type) {
+			case float64:
+				return v, nil
+			case string:
+				f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil {
+					return nil, fmt.Errorf("无法转换成数字: %q", v)
+				}
+				return f, nil
+			}
+			return nil, fmt.Errorf("%s 无法转换成数字", queryTypeName(in))
+		}),
+		"tojson/0": simpleBuiltin(func(in any) (any, error) {
+			return compactJSON(in), nil
+		}),
+		"fromjson/0": simpleBuiltin(func(in any) (any, error) {
+			s, ok := in.(string)
+			if !ok {
+				return nil, fmt.Errorf("fromjson 的输入必须是字符串")
+			}
+			var v any
+			if err := json.Unmarshal([]byte(s), &v); err != nil {
+				return nil, fmt.Errorf("无效的 JSON: %w", err)
+			}
+			return v, nil
+		}),
+		"ascii_downcase/0": stringBuiltin(strings.ToLower),
+		"ascii_upcase/0":   stringBuiltin(strings.ToUpper),
+		"ltrimstr/1": valueArgBuiltin(func(in, arg any) (any, error) {
+			s, ok1 := in.(string)
+			prefix, ok2 := arg.(string)
+			if !ok1 || !ok2 {
+				return in, nil
+			}
+			return strings.TrimPrefix(s, prefix), nil
+		}),
+		"rtrimstr/1": valueArgBuiltin(func(in, arg any) (any, error) {
+			s, ok1 := in.(string)
+			suffix, ok2 := arg.(string)
+			if !ok1 || !ok2 {
+				return in, nil
+			}
+			return strings.TrimSuffix(s, suffix), nil
+		}),
+		"startswith/1": stringPairBuiltin("startswith", strings.HasPrefix),
+		"endswith/1":   stringPairBuiltin("endswith", strings.HasSuffix),
+		"split/1": valueArgBuiltin(func(in, arg any) (any, error) {
+			s, ok1 := in.(string)
+			sep, ok2 := arg.(string)
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("split 的输入和参数必须是字符串")
+			}
+			return splitToQueryArray(s, sep), nil
+		}),
+		"join/1": valueArgBuiltin(func(in, arg any) (any, error) {
+			arr, ok1 := in.([]any)
+			sep, ok2 := arg.(string)
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("join 的输入必须是数组，参数必须是字符串")
+			}
+			parts := make([]string, len(arr))
+			for i, item := range arr {
+				switch item.(type) {
+				case nil:
+				case map[string]any, []any:
+					return nil, fmt.Errorf("join 不能连接 %s", queryTypeName(item))
+				default:
+					parts[i] = queryToString(item)
+				}
+			}
+			return strings.Join(parts, sep), nil
+		}),
+		"test/1": valueArgBuiltin(func(in, arg any) (any, error) {
+			s, ok1 := in.(string)
+			pattern, ok2 := arg.(string)
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("test 的输入和参数必须是字符串")
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("无效的正则表达式 %q: %w", pattern, err)
+			}
+			return re.MatchString(s), nil
+		}),
+		"contains/1": valueArgBuiltin(func(in, arg any) (any, error) {
+			return queryContains(in, arg)
+		}),
+		"inside/1": valueArgBuiltin(func(in, arg any) (any, error) {
+			return queryContains(arg, in)
+		}),
+		"nulls/0":     typeSelectBuiltin("null"),
+		"booleans/0":  typeSelectBuiltin("boolean"),
+		"numbers/0":   typeSelectBuiltin("number"),
+		"strings/0":   typeSelectBuiltin("string"),
+		"arrays/0":    typeSelectBuiltin("array"),
+		"objects/0":   typeSelectBuiltin("object"),
+		"iterables/0": typeSelectBuiltin("array", "object"),
+		"scalars/0":   typeSelectBuiltin("null", "boolean", "number", "string"),
+		"floor/0":     numberBuiltin(math.Floor),
+		"ceil/0":      numberBuiltin(math.Ceil),
+		"round/0":     numberBuiltin(math.Round),
+		"sqrt/0":      numberBuiltin(math.Sqrt),
+		"abs/0":       numberBuiltin(math.Abs),
+	}
+}
+
+// 输入是指定的类型时原样输出，否则没有输出
+func typeSelectBuiltin(types ...string) queryBuiltin {
+	return func(_ *queryEnv, in any, _ []queryNode) ([]any, error) {
+		name := queryTypeName(in)
+		for _, t := range types {
+			if t == name {
+				return []any{in}, nil
+			}
+		}
+		return nil, nil
+	}
+}
+
+func stringBuiltin(fn func(string) string) queryBuiltin {
+	return simpleBuiltin(func(in any) (any, error) {
+		s, ok := in.(string)
+		if !ok {
+			return nil, fmt.Errorf("输入必须是字符串，实际是 %s", queryTypeName(in))
+		}
+		return fn(s), nil
+	})
+}
+
+func stringPairBuiltin(name string, fn func(string, string) bool) queryBuiltin {
+	return valueArgBuiltin(func(in, arg any) (any, error) {
+		s, ok1 := in.(string)
+		t, ok2 := arg.(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("%s 的输入和参数必须是字符串", name)
+		}
+		return fn(s, t), nil
+	})
+}
+
+func numberBuiltin(fn func(float64) float64) queryBuiltin {
+	return simpleBuiltin(func(in any) (any, error) {
+		f, ok := in.(float64)
+		if !ok {
+			return nil, fmt.Errorf("输入必须是数字，实际是 %s", queryTypeName(in))
+		}
+		return fn(f), nil
+	})
+}
+
+func queryKeys(in any) (any, error) {
+	switch v := in.(type) {
+	case map[string]any:
+		keys := sortedKeys(v)
+		out := make([]any, len(keys))
+		for i, k := range keys {
+			out[i] = k
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for i := range v {
+			out[i] = float64(i)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("%s 没有键", queryTypeName(in))
+}
+
+// 支持 key/k/name/Name/Key 和 value/v/Value 几种写法
+func queryFromEntries(in any) (any, error) {
+	arr, ok := in.([]any)
+	if !ok {
+		return nil, fmt.Errorf("from_entries 的输入必须是数组")
+	}
+	out := make(map[string]any, len(arr))
+	for _, item := range arr {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("from_entries 的元素必须是对象")
+		}
+		var key any
+		for _, name := range []string{"key", "k", "name", "Name", "Key"} {
+			if k, exists := entry[name]; exists && k != nil {
+				key = k
+				break
+			}
+		}
+		var value any
+		for _, name := range []string{"value", "v", "Value"} {
+			if v, exists := entry[name]; exists {
+				value = v
+				break
+			}
+		}
+		switch k := key.(type) {
+		case string:
+			out[k] = value
+		case float64, bool:
+			out[queryToString(k)] = value
+		default:
+			return nil, fmt.Errorf("from_entries 的键无效: %s", compactJSON(key))
+		}
+	}
+	return out, nil
+}
+
+func queryFlatten(in any, depth int) (any, error) {
+	arr, ok := in.([]any)
+	if !ok {
+		return nil, fmt.Errorf("flatten 的输入必须是数组")
+	}
+	out := []any{}
+	for _, item := range arr {
+		if sub, isArr := item.([]any); isArr && depth != 0 {
+			flat, err := queryFlatten(sub, depth-1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, flat.([]any)...)
+		} else {
+			out = append(out, item)
+		}
+	}
+	return out, nil
+}
+
+// range 一次最多产生的结果数，查询一次算出所有结果，没有上限时 range(1e18) 会耗尽内存
+const maxRangeResults = 1 << 20
+
+// range 的参数，必须是整数并且在 float64 可以精确表示的范围内
+func rangeBound(v any) (int64, error) {
+	f, ok := v.(float64)
+	if !ok {
+		return 0, fmt.Errorf("range 的参数必须是数字")
+	}
+	if f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+		return 0, fmt.Errorf("range 的参数必须是绝对值不超过 2^53 的整数: %v", f)
+	}
+	return int64(f), nil
+}
+
+func queryRange(env *queryEnv, in any, fromNode, toNode queryNode) ([]any, error) {
+	froms, err := fromNode.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+	tos, err := toNode.eval(env, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	for _, f := range froms {
+		for _, t := range tos {
+			from, err := rangeBound(f)
+			if err != nil {
+				return nil, err
+			}
+			to, err := rangeBound(t)
+			if err != nil {
+				return nil, err
+			}
+			if to-from > int64(maxRangeResults-len(out)) {
+				return nil, fmt.Errorf("range 的结果超过 %d 个", maxRangeResults)
+			}
+			for i := from; i < to; i++ {
+				out = append(out, float64(i))
+			}
+		}
+	}
+	return out, nil
+}
+
+// 按 keys 排序后的下标，相同的键保持原来的顺序
+func sortedIndexes(keys []any) []int {
+	idx := make([]int, len(keys))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		return compareQueryValues(keys[idx[a]], keys[idx[b]]) < 0
+	})
+	return idx
+}
+
+// 按键去重，结果按键排序
+func uniqueByKeys(arr, keys []any) []any {
+	out := []any{}
+	var last any
+	for n, j := range sortedIndexes(keys) {
+		if n > 0 && compareQueryValues(keys[j], last) == 0 {
+			continue
+		}
+		out = append(out, arr[j])
+		last = keys[j]
+	}
+	return out
+}
+
+// sign 为 -1 取最小值，为 1 取最大值，空数组返回 null
+func queryExtreme(in any, keys any, sign int) (any, error) {
+	arr, ok := in.([]any)
+	if !ok {
+		return nil, fmt.Errorf("输入必须是数组，实际是 %s", queryTypeName(in))
+	}
+	keyArr := keys.([]any)
+	if len(arr) == 0 {
+		return nil, nil
+	}
+	best := 0
+	for i := 1; i < len(arr); i++ {
+		c := compareQueryValues(keyArr[i], keyArr[best])
+		if c*sign > 0 || (c == 0 && sign > 0) {
+			best = i
+		}
+	}
+	return arr[best], nil
+}
+
+func queryContains(a, b any) (bool, error) {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		for k, v := range bv {
+			item, exists := av[k]
+			if !exists {
+				return false, nil
+			}
+			if ok, err := queryContains(item, v); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			break
+		}
+		for _, want := range bv {
+			found := false
+			for _, have := range av {
+				if ok, _ := queryContains(have, want); ok {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false, nil
+			}
+		}
+		return true, nil
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			break
+		}
+		return strings.Contains(av, bv), nil
+	default:
+		if queryTypeName(a) == queryTypeName(b) {
+			return compareQueryValues(a, b) == 0, nil
+		}
+	}
+	return false, fmt.Errorf("%s 和 %s 不能使用 contains", queryTypeName(a), queryTypeName(b))
+}
+
+func splitToQueryArray(s, sep string) []any {
+	if s == "" {
+		return []any{}
+	}
+	parts := strings.Split(s, sep)
+	out := make([]any, len(parts))
+	for i, p := range parts {
+		out[i] = p
+	}
+	return out
+}
+
+func slicesContainsQuery(arr []any, v any) bool {
+	for _, item := range arr {
+		if compareQueryValues(item, v) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ---------------------------------------------------------------------
+// 值的辅助函数
+
+func queryTruthy(v any) bool {
+	return !(v == nil || v == false)
+}
+
+func queryTypeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return "unknown"
+	}
+}
+
+// 字符串原样返回，其它值转换成紧凑的 JSON
+func queryToString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return compactJSON(v)
+}
+
+// jq 的排序规则: null < false < true < 数字 < 字符串 < 数组 < 对象
+func queryTypeRank(v any) int {
+	switch val := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if val {
+			return 2
+		}
+		return 1
+	case float64:
+		return 3
+	case string:
+		return 4
+	case []any:
+		return 5
+	default:
+		return 6
+	}
+}
+
+func compareQueryValues(a, b any) int {
+	ra, rb := queryTypeRank(a), queryTypeRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+
+	switch av := a.(type) {
+	case float64:
+		bv := b.(float64)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(av, b.(string))
+	case []any:
+		bv := b.([]any)
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if c := compareQueryValues(av[i], bv[i]); c != 0 {
+				return c
+			}
+		}
+		return len(av) - len(bv)
+	case map[string]any:
+		// 先比较排序后的键，键相同再逐个比较值
+		bv := b.(map[string]any)
+		ak, bk := sortedKeys(av), sortedKeys(bv)
+		keysA := make([]any, len(ak))
+		keysB := make([]any, len(bk))
+		for i, k := range ak {
+			keysA[i] = k
+		}
+		for i, k := range bk {
+			keysB[i] = k
+		}
+		if c := compareQueryValues(keysA, keysB); c != 0 {
+			return c
+		}
+		for _, k := range ak {
+			if c := compareQueryValues(av[k], bv[k]); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
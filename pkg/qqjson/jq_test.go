@@ -0,0 +1,211 @@
+package qqjson
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const jqTestDoc = `{
+	"user": {"name": "alice", "age": 30, "tags": ["a", "b"]},
+	"items": [
+		{"name": "pen", "price": 5, "qty": 2},
+		{"name": "book", "price": 20, "qty": 1},
+		{"name": "bag", "price": 15, "qty": null}
+	],
+	"host": "db1", "port": 5432,
+	"a.b": 1, "empty": [], "nothing": null
+}`
+
+// 每个结果按紧凑的 JSON 输出，多个结果用空格分隔
+func runQuery(t *testing.T, expr, input string) (string, error) {
+	t.Helper()
+	node, err := parseQuery(expr)
+	if err != nil {
+		return "", err
+	}
+	var doc any
+	if err := json.Unmarshal([]byte(input), &doc); err != nil {
+		t.Fatalf("无效的 JSON: %v", err)
+	}
+	outputs, err := node.eval(nil, doc)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(outputs))
+	for i, out := range outputs {
+		data, err := marshalJSON(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[i] = string(data)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		// 路径
+		{`.user.name`, `"alice"`},
+		{`."a.b"`, `1`},
+		{`.["a.b"]`, `1`},
+		{`.user.tags[0]`, `"a"`},
+		{`.user.tags[-1]`, `"b"`},
+		{`.items[1:].[].name`, `"book" "bag"`},
+		{`.items[].name`, `"pen" "book" "bag"`},
+		{`.missing`, `null`},
+		{`.missing.deeper`, `null`},
+		{`.host?`, `"db1"`},
+		{`.user.name[0]?`, ``},
+		{`[.. | numbers] | length`, `8`},
+
+		// 组合
+		{`.host, .port`, `"db1" 5432`},
+		{`.user | .age`, `30`},
+		{`.port as $p | .host + ":" + ($p | tostring)`, `"db1:5432"`},
+		{`"\(.host):\(.port)"`, `"db1:5432"`},
+
+		// 字面量和构造
+		{`[1, "a", null, true]`, `[1,"a",null,true]`},
+		{`{name: .user.name, n: 1}`, `{"n":1,"name":"alice"}`},
+		{`{host, port}`, `{"host":"db1","port":5432}`},
+		{`.user.name as $x | {$x}`, `{"x":"alice"}`},
+		{`{(.host): .port}`, `{"db1":5432}`},
+		{`[.items[].price]`, `[5,20,15]`},
+
+		// 运算
+		{`1 + 2 * 3`, `7`},
+		{`10 / 4`, `2.5`},
+		{`7 % 3`, `1`},
+		{`-(.port)`, `-5432`},
+		{`"ab" + "cd"`, `"abcd"`},
+		{`[1,2] + [3]`, `[1,2,3]`},
+		{`[1,2,2,3] - [2]`, `[1,3]`},
+		{`{"a":1} + {"b":2}`, `{"a":1,"b":2}`},
+		{`{"a":{"x":1}} * {"a":{"y":2}}`, `{"a":{"x":1,"y":2}}`},
+		{`null + 1`, `1`},
+		{`.port > 1000 and .host == "db1"`, `true`},
+		{`false or null`, `false`},
+		{`.nothing // "default"`, `"default"`},
+		{`.port // "default"`, `5432`},
+		{`1 == 1.0`, `true`},
+		{`[null, false, 0, "", [], {}] | sort`, `[null,false,0,"",[],{}]`},
+
+		// 条件
+		{`if .port > 1000 then "high" elif .port > 10 then "mid" else "low" end`, `"high"`},
+		{`if .nothing then 1 else 2 end`, `2`},
+		{`[.items[] | select(.price > 10) | .name]`, `["book","bag"]`},
+
+		// 函数
+		{`.user | keys`, `["age","name","tags"]`},
+		{`.user.tags | length`, `2`},
+		{`.user.name | length`, `5`},
+		{`.user | has("age")`, `true`},
+		{`.items | map(.price) | add`, `40`},
+		{`.items | map(.price) | min, max`, `5 20`},
+		{`.items | sort_by(.price) | map(.name)`, `["pen","bag","book"]`},
+		{`.items | max_by(.price) | .name`, `"book"`},
+		{`.items | group_by(.qty == null) | map(length)`, `[2,1]`},
+		{`[3,1,2,1] | unique`, `[1,2,3]`},
+		{`[[1,[2]],3] | flatten`, `[1,2,3]`},
+		{`[range(3)]`, `[0,1,2]`},
+		{`[range(-2;1)]`, `[-2,-1,0]`},
+		{`[range(3;1)]`, `[]`},
+		{`{"a":1,"b":2} | to_entries | map(.key)`, `["a","b"]`},
+		{`{"a":1} | with_entries({key: (.key + "x"), value})`, `{"ax":1}`},
+		{`[{"key":"x","value":1}] | from_entries`, `{"x":1}`},
+		{`.user | map_values(type)`, `{"age":"number","name":"string","tags":"array"}`},
+		{`.empty | first`, `null`},
+		{`[.items[].qty] | map(. == null) | any, all`, `true false`},
+		{`"a,b,c" | split(",")`, `["a","b","c"]`},
+		{`["a","b"] | join("-")`, `"a-b"`},
+		{`"Hello" | ascii_downcase, ascii_upcase`, `"hello" "HELLO"`},
+		{`"v1.x" | ltrimstr("v") | tonumber? // "bad"`, `"bad"`},
+		{`"42" | tonumber`, `42`},
+		{`"foobar" | startswith("foo"), endswith("baz")`, `true false`},
+		{`"abc123" | test("[0-9]+$")`, `true`},
+		{`{"a":[1,2]} | contains({"a":[1]})`, `true`},
+		{`3.7 | floor, ceil, round`, `3 4 4`},
+		{`-2 | abs`, `2`},
+		{`[1,2] | tojson`, `"[1,2]"`},
+		{`"[1,2]" | fromjson`, `[1,2]`},
+		{`.user.tags | reverse`, `["b","a"]`},
+		{`[empty]`, `[]`},
+		{`[error("x")?]`, `[]`},
+
+		// 格式
+		{`.user.tags | @csv`, `"\"a\",\"b\""`},
+		{`.user.tags | @tsv`, `"a\tb"`},
+		{`"it's" | @sh`, `"$'it\\'s'"`},
+		{`"hi" | @base64`, `"aGk="`},
+		{`"aGk=" | @base64d`, `"hi"`},
+		{`"a b&c/é~" | @uri`, `"a%20b%26c%2F%C3%A9~"`},
+		{`{"a":1} | @json`, `"{\"a\":1}"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := runQuery(t, tt.expr, jqTestDoc)
+			if err != nil {
+				t.Fatalf("查询出错: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("结果 = %s，期望 %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryIdentity(t *testing.T) {
+	got, err := runQuery(t, `.`, `{"b":[1,{"c":null}],"a":"x"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":"x","b":[1,{"c":null}]}`; got != want {
+		t.Errorf("结果 = %s，期望 %s", got, want)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		// 语法错误在解析时报告，其它在求值时报告
+		parseErr bool
+	}{
+		{"缺少右括号", `(.a`, true},
+		{"未结束的字符串", `"abc`, true},
+		{"if 缺少 end", `if . then 1 else 2`, true},
+		{"未知的函数", `nosuchfunc`, true},
+		{"多余的内容", `.a )`, true},
+		{"未定义的变量", `$nope`, false},
+		{"对象不能加数字", `{} + 1`, false},
+		{"字符串不能索引", `"abc" | .x`, false},
+		{"error", `error("boom")`, false},
+		{"除以零", `1 / 0`, false},
+		{"range 超过 2^53", `[range(1e16;1e16+4)]`, false},
+		{"range 不是整数", `[range(0.5)]`, false},
+		{"range 结果太多", `first(range(1e15))`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := parseQuery(tt.expr)
+			if tt.parseErr {
+				if err == nil {
+					t.Errorf("%s 应该是语法错误", tt.expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("不应该是语法错误: %v", err)
+			}
+			if _, err := node.eval(nil, map[string]any{}); err == nil {
+				t.Errorf("%s 应该在求值时出错", tt.expr)
+			}
+		})
+	}
+}
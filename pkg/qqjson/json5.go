@@ -0,0 +1,571 @@
+package qqjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// JSON5 输入，支持:
+//   // 和 /* */ 注释，对象和数组的结尾逗号
+//   单引号字符串，没有引号的键，十六进制数字，.5 和 5. 这样的小数，+ 号
+// 解析的结果是标准的 JSON，同时记录每个 token 在原文中的位置
+// 写回时修改在标准 JSON 上进行，再把修改的部分替换回原文，其它位置的注释和格式保持不变
+
+// 一个 token 在标准 JSON 中的位置 [jStart, jEnd) 和在原文中的位置 [oStart, oEnd)
+type json5Token struct {
+	jStart, jEnd int
+	oStart, oEnd int
+}
+
+type json5Doc struct {
+	json   []byte
+	tokens []json5Token
+}
+
+type json5Parser struct {
+	src    []byte
+	pos    int
+	out    bytes.Buffer
+	tokens []json5Token
+}
+
+func parseJSON5(src []byte) (*json5Doc, error) {
+	p := &json5Parser{src: src}
+	if err := p.skipSpace(); err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.src) {
+		if err := p.parseValue(); err != nil {
+			return nil, err
+		}
+		if err := p.skipSpace(); err != nil {
+			return nil, err
+		}
+		if p.pos < len(p.src) {
+			return nil, p.errorf("值后面有多余的内容")
+		}
+	}
+	return &json5Doc{json: p.out.Bytes(), tokens: p.tokens}, nil
+}
+
+func (p *json5Parser) errorf(format string, args ...any) error {
+	line := bytes.Count(p.src[:min(p.pos, len(p.src))], []byte("\n")) + 1
+	return fmt.Errorf("第 %d 行: %s", line, fmt.Sprintf(format, args...))
+}
+
+// 原文中 [oStart, p.pos) 对应标准 JSON 中的 text
+func (p *json5Parser) emit(oStart int, text string) {
+	jStart := p.out.Len()
+	p.out.WriteString(text)
+	p.tokens = append(p.tokens, json5Token{jStart: jStart, jEnd: p.out.Len(), oStart: oStart, oEnd: p.pos})
+}
+
+func (p *json5Parser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+// 跳过空白和注释
+func (p *json5Parser) skipSpace() error {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		case bytes.HasPrefix(p.src[p.pos:], []byte("\xef\xbb\xbf")):
+			p.pos += 3
+		case bytes.HasPrefix(p.src[p.pos:], []byte("//")):
+			end := bytes.IndexByte(p.src[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.src)
+			} else {
+				p.pos += end + 1
+			}
+		case bytes.HasPrefix(p.src[p.pos:], []byte("/*")):
+			end := bytes.Index(p.src[p.pos+2:], []byte("*/"))
+			if end < 0 {
+				return p.errorf("/* 注释没有结束")
+			}
+			p.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *json5Parser) parseValue() error {
+	switch c := p.peek(); {
+	case c == '{':
+		return p.parseContainer('{', '}', true)
+	case c == '[':
+		return p.parseContainer('[', ']', false)
+	case c == '"' || c == '\'':
+		start := p.pos
+		s, err := p.parseString()
+		if err != nil {
+			return err
+		}
+		p.emit(start, marshalString(s))
+		return nil
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case isJSON5IdentStart(c):
+		start := p.pos
+		ident := p.parseIdent()
+		switch ident {
+		case "true", "false", "null":
+			p.emit(start, ident)
+			return nil
+		case "Infinity", "NaN":
+			return p.errorf("JSON 不支持 %s", ident)
+		}
+		return p.errorf("无效的值: %s", ident)
+	case c == 0:
+		return p.errorf("内容不完整")
+	default:
+		return p.errorf("意外的字符 %q", c)
+	}
+}
+
+// 对象和数组，结尾的逗号不输出到标准 JSON 中
+func (p *json5Parser) parseContainer(open, close byte, isObject bool) error {
+	p.pos++
+	p.emit(p.pos-1, string(open))
+
+	for {
+		if err := p.skipSpace(); err != nil {
+			return err
+		}
+		if p.peek() == close {
+			p.pos++
+			p.emit(p.pos-1, string(close))
+			return nil
+		}
+
+		if isObject {
+			if err := p.parseKey(); err != nil {
+				return err
+			}
+			if err := p.skipSpace(); err != nil {
+				return err
+			}
+			if p.peek() != ':' {
+				return p.errorf("键后面缺少 :")
+			}
+			p.pos++
+			p.emit(p.pos-1, ":")
+			if err := p.skipSpace(); err != nil {
+				return err
+			}
+		}
+		if err := p.parseValue(); err != nil {
+			return err
+		}
+
+		if err := p.skipSpace(); err != nil {
+			return err
+		}
+		switch p.peek() {
+		case ',':
+			comma := p.pos
+			p.pos++
+			if err := p.skipSpace(); err != nil {
+				return err
+			}
+			if p.peek() != close {
+				end := p.pos
+				p.pos = comma + 1
+				p.emit(comma, ",")
+				p.pos = end
+			}
+		case close:
+		default:
+			return p.errorf("期望 , 或者 %c", close)
+		}
+	}
+}
+
+func (p *json5Parser) parseKey() error {
+	start := p.pos
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		s, err := p.parseString()
+		if err != nil {
+			return err
+		}
+		p.emit(start, marshalString(s))
+	case isJSON5IdentStart(c):
+		p.emit(start, marshalString(p.parseIdent()))
+	default:
+		return p.errorf("无效的键")
+	}
+	return nil
+}
+
+func isJSON5IdentStart(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func (p *json5Parser) parseIdent() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if !isJSON5IdentStart(c) && !(c >= '0' && c <= '9') {
+			break
+		}
+		p.pos++
+	}
+	return string(p.src[start:p.pos])
+}
+
+var json5Escapes = map[byte]string{
+	'b': "\b", 'f': "\f", 'n': "\n", 'r': "\r", 't': "\t", 'v': "\v",
+	'0': "\x00", '\\': "\\", '/': "/", '"': "\"", '\'': "'",
+	'\n': "", '\r': "",
+}
+
+func (p *json5Parser) parseString() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return sb.String(), nil
+		case c == '\n':
+			return "", p.errorf("字符串中不能直接换行")
+		case c != '\\':
+			sb.WriteByte(c)
+			p.pos++
+			continue
+		}
+
+		p.pos++
+		if p.pos >= len(p.src) {
+			break
+		}
+		e := p.src[p.pos]
+		p.pos++
+		if s, ok := json5Escapes[e]; ok {
+			sb.WriteString(s)
+			// \ 加上 \r\n 的续行
+			if e == '\r' && p.peek() == '\n' {
+				p.pos++
+			}
+			continue
+		}
+		switch e {
+		case 'x':
+			n, err := p.parseHex(2)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteRune(rune(n))
+		case 'u':
+			n, err := p.parseHex(4)
+			if err != nil {
+				return "", err
+			}
+			r := rune(n)
+			// 代理对
+			if utf16.IsSurrogate(r) && bytes.HasPrefix(p.src[p.pos:], []byte(`\u`)) {
+				p.pos += 2
+				low, err := p.parseHex(4)
+				if err != nil {
+					return "", err
+				}
+				r = utf16.DecodeRune(r, rune(low))
+			}
+			sb.WriteRune(r)
+		default:
+			// 其它字符转义后是它本身
+			r, size := utf8.DecodeRune(p.src[p.pos-1:])
+			sb.WriteRune(r)
+			p.pos += size - 1
+		}
+	}
+	return "", p.errorf("字符串没有结束")
+}
+
+func (p *json5Parser) parseHex(digits int) (uint64, error) {
+	if p.pos+digits > len(p.src) {
+		return 0, p.errorf("无效的转义")
+	}
+	n, err := strconv.ParseUint(string(p.src[p.pos:p.pos+digits]), 16, 32)
+	if err != nil {
+		return 0, p.errorf("无效的转义: %s", p.src[p.pos:p.pos+digits])
+	}
+	p.pos += digits
+	return n, nil
+}
+
+// 转换成 JSON 的数字写法: 去掉 + 号，十六进制转换成十进制，.5 -> 0.5，5. -> 5
+func (p *json5Parser) parseNumber() error {
+	start := p.pos
+	sign := ""
+	if c := p.peek(); c == '+' || c == '-' {
+		if c == '-' {
+			sign = "-"
+		}
+		p.pos++
+	}
+
+	if isJSON5IdentStart(p.peek()) {
+		ident := p.parseIdent()
+		return p.errorf("JSON 不支持 %s%s", sign, ident)
+	}
+
+	if bytes.HasPrefix(p.src[p.pos:], []byte("0x")) || bytes.HasPrefix(p.src[p.pos:], []byte("0X")) {
+		p.pos += 2
+		digitsStart := p.pos
+		for p.pos < len(p.src) && isHexRune(rune(p.src[p.pos])) {
+			p.pos++
+		}
+		n, err := strconv.ParseUint(string(p.src[digitsStart:p.pos]), 16, 64)
+		if err != nil {
+			return p.errorf("无效的十六进制数字: %s", p.src[start:p.pos])
+		}
+		p.emit(start, sign+strconv.FormatUint(n, 10))
+		return nil
+	}
+
+	numStart := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c >= '0' && c <= '9' || c == '.' || c == 'e' || c == 'E' ||
+			((c == '+' || c == '-') && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E')) {
+			p.pos++
+			continue
+		}
+		break
+	}
+
+	text := string(p.src[numStart:p.pos])
+	if strings.HasPrefix(text, ".") {
+		text = "0" + text
+	}
+	text = strings.Replace(text, ".e", "e", 1)
+	text = strings.Replace(text, ".E", "E", 1)
+	text = strings.TrimSuffix(text, ".")
+	text = sign + text
+	if !json.Valid([]byte(text)) {
+		return p.errorf("无效的数字: %s", p.src[start:p.pos])
+	}
+	p.emit(start, text)
+	return nil
+}
+
+func isHexRune(r rune) bool {
+	return r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F'
+}
+
+// edited 是在 d.json 上修改后的结果，把修改的部分替换回原文
+// 按 token 比较两边相同的开头和结尾，中间不同的 token 在原文中的范围替换成 edited 中对应的内容
+// 纯删除和纯插入单独处理，不影响相邻成员的注释和换行(见 deletionRange / insertionText)
+func (d *json5Doc) splice(orig, edited []byte) ([]byte, error) {
+	e, err := parseJSON5(edited)
+	if err != nil {
+		return nil, err
+	}
+	n, m := len(d.tokens), len(e.tokens)
+	if n == 0 || m == 0 {
+		return edited, nil
+	}
+
+	same := func(i, j int) bool {
+		a, b := d.tokens[i], e.tokens[j]
+		return bytes.Equal(d.json[a.jStart:a.jEnd], e.json[b.jStart:b.jEnd])
+	}
+	prefix := 0
+	for prefix < n && prefix < m && same(prefix, prefix) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < n-prefix && suffix < m-prefix && same(n-1-suffix, m-1-suffix) {
+		suffix++
+	}
+	if prefix == n && n == m {
+		return orig, nil
+	}
+
+	oStart, oEnd := d.tokenRange(prefix, n-suffix)
+	eStart, eEnd := e.tokenRange(prefix, m-suffix)
+	text := edited[eStart:eEnd]
+	switch {
+	case prefix == m-suffix:
+		oStart, oEnd = d.deletionRange(orig, prefix, n-suffix)
+		text = nil
+	case prefix == n-suffix:
+		text = d.insertionText(orig, prefix, text)
+	}
+
+	out := make([]byte, 0, len(orig)-(oEnd-oStart)+len(text))
+	out = append(out, orig[:oStart]...)
+	out = append(out, text...)
+	return append(out, orig[oEnd:]...), nil
+}
+
+// 第 first 到 end-1 个 token 在原文中的范围，没有 token 的时候是前一个 token 之后的位置
+func (d *json5Doc) tokenRange(first, end int) (int, int) {
+	switch {
+	case first < end:
+		return d.tokens[first].oStart, d.tokens[end-1].oEnd
+	case first > 0:
+		return d.tokens[first-1].oEnd, d.tokens[first-1].oEnd
+	default:
+		return d.tokens[0].oStart, d.tokens[0].oStart
+	}
+}
+
+func (d *json5Doc) tokenText(i int) string {
+	return string(d.json[d.tokens[i].jStart:d.tokens[i].jEnd])
+}
+
+// 删除第 first 到 end-1 个 token(完整的成员和一个逗号)时在原文中删除的范围
+// 删除最后的成员时，前面的逗号和成员之间有换行或者注释就保留逗号(JSON5 允许结尾逗号)，
+// 避免删掉前一个成员所在行的注释；成员后面原来的结尾逗号一起删除
+// 成员单独占据若干行时整行删除，包括同一行末尾属于它的 // 注释
+func (d *json5Doc) deletionRange(orig []byte, first, end int) (int, int) {
+	start, stop := d.tokens[first].oStart, d.tokens[end-1].oEnd
+	if d.tokenText(first) == "," && first+1 < end {
+		gap := orig[d.tokens[first].oEnd:d.tokens[first+1].oStart]
+		if bytes.ContainsAny(gap, "\n/") {
+			start = d.tokens[first+1].oStart
+		}
+	}
+	if d.tokenText(end-1) != "," || start != d.tokens[first].oStart {
+		i := stop
+		for i < len(orig) && (orig[i] == ' ' || orig[i] == '\t') {
+			i++
+		}
+		if d.tokenText(end-1) != "," && i < len(orig) && orig[i] == ',' {
+			stop = i + 1
+		}
+	}
+
+	lineStart := start
+	for lineStart > 0 && (orig[lineStart-1] == ' ' || orig[lineStart-1] == '\t') {
+		lineStart--
+	}
+	if lineStart > 0 && orig[lineStart-1] != '\n' {
+		// 同一行中间的成员，逗号后面的空格一起删除
+		for orig[stop-1] == ',' && stop < len(orig) && (orig[stop] == ' ' || orig[stop] == '\t') {
+			stop++
+		}
+		return start, stop
+	}
+	lineEnd := stop
+	for lineEnd < len(orig) && (orig[lineEnd] == ' ' || orig[lineEnd] == '\t' || orig[lineEnd] == '\r') {
+		lineEnd++
+	}
+	if bytes.HasPrefix(orig[lineEnd:], []byte("//")) {
+		if i := bytes.IndexByte(orig[lineEnd:], '\n'); i >= 0 {
+			lineEnd += i
+		} else {
+			lineEnd = len(orig)
+		}
+	}
+	switch {
+	case lineEnd == len(orig):
+		return lineStart, lineEnd
+	case orig[lineEnd] == '\n':
+		return lineStart, lineEnd + 1
+	}
+	return start, stop
+}
+
+// 插入到第 at 个 token 之前的内容，所在的对象或者数组每个成员一行时，
+// 新的成员也单独一行，缩进和第一个成员相同
+func (d *json5Doc) insertionText(orig []byte, at int, text []byte) []byte {
+	open, depth := -1, 0
+	for i := at - 1; i >= 0 && open < 0; i-- {
+		switch d.tokenText(i) {
+		case "}", "]":
+			depth++
+		case "{", "[":
+			if depth == 0 {
+				open = i
+			}
+			depth--
+		}
+	}
+	if open < 0 || open+1 >= len(d.tokens) {
+		return text
+	}
+	firstTok := d.tokens[open+1]
+	if t := d.tokenText(open + 1); t == "}" || t == "]" {
+		return text
+	}
+	if !bytes.Contains(orig[d.tokens[open].oEnd:firstTok.oStart], []byte("\n")) {
+		// 同一行的成员之间使用和原来的逗号后面相同的空格
+		if bytes.HasPrefix(text, []byte(",")) {
+			if space := d.spaceAfterComma(orig, open, at); space != nil {
+				return append(append([]byte{','}, space...), text[1:]...)
+			}
+		}
+		return text
+	}
+
+	lineStart := bytes.LastIndexByte(orig[:firstTok.oStart], '\n') + 1
+	indent := orig[lineStart:firstTok.oStart]
+	if i := bytes.IndexFunc(indent, func(r rune) bool { return r != ' ' && r != '\t' }); i >= 0 {
+		indent = indent[:i]
+	}
+
+	var out []byte
+	if bytes.HasPrefix(text, []byte(",")) {
+		out = append(out, ',')
+		text = text[1:]
+	}
+	out = append(out, '\n')
+	out = append(out, indent...)
+	return append(out, text...)
+}
+
+// 第 open 个 token 开始的对象或者数组中，at 之前最后一个逗号后面的空格，没有时返回 nil
+func (d *json5Doc) spaceAfterComma(orig []byte, open, at int) []byte {
+	depth := 0
+	for i := at - 1; i > open; i-- {
+		switch d.tokenText(i) {
+		case "}", "]":
+			depth++
+		case "{", "[":
+			depth--
+		case ",":
+			if depth != 0 || i+1 >= len(d.tokens) {
+				continue
+			}
+			space := orig[d.tokens[i].oEnd:d.tokens[i+1].oStart]
+			if len(bytes.Trim(space, " \t")) == 0 {
+				return space
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// 把 operation 包装成在 JSON5 原文上执行的操作，用于 modifyJSON
+func preserveJSON5(operation func([]byte, string, any) ([]byte, error)) func([]byte, string, any) ([]byte, error) {
+	return func(text []byte, path string, value any) ([]byte, error) {
+		doc, err := parseJSON5(text)
+		if err != nil {
+			return nil, err
+		}
+		edited, err := operation(doc.json, path, value)
+		if err != nil {
+			return nil, err
+		}
+		return doc.splice(text, edited)
+	}
+}
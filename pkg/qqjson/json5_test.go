@@ -0,0 +1,170 @@
+package qqjson
+
+import (
+	"testing"
+
+	"github.com/tidwall/sjson"
+)
+
+func TestParseJSON5(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"注释", "// 开头\n{/* 键前 */\"a\": 1 // 行尾\n}", `{"a":1}`},
+		{"结尾逗号", `{"a": [1, 2,], "b": {"c": 3,},}`, `{"a":[1,2],"b":{"c":3}}`},
+		{"十六进制和 + 号", `[0x10, -0XfF, +1, +.5, 5., 1.e3]`, `[16,-255,1,0.5,5,1e3]`},
+		{"单引号和没有引号的键", `{key: 'it\'s "x"', $k_1: "\x41é"}`, `{"key":"it's \"x\"","$k_1":"Aé"}`},
+		{"续行", "'a\\\nb'", `"ab"`},
+		{"空文档", " // 只有注释\n", ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseJSON5([]byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(doc.json) != tt.want {
+				t.Errorf("结果 = %s，期望 %s", doc.json, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSON5Errors(t *testing.T) {
+	for _, src := range []string{
+		`{"a": 1`,
+		`{"a" 1}`,
+		`[1 2]`,
+		`/* 没有结束`,
+		`"abc`,
+		"'a\nb'",
+		`[Infinity]`,
+		`[-NaN]`,
+		`[0xZZ]`,
+		`[1.2.3]`,
+		`{"a": 1} x`,
+		`[,]`,
+	} {
+		if doc, err := parseJSON5([]byte(src)); err == nil {
+			t.Errorf("%q 应该报错，得到 %s", src, doc.json)
+		}
+	}
+}
+
+func TestJSON5Splice(t *testing.T) {
+	const src = `{
+  // 设备列表
+  "nested": {
+    "x": 0x10, // hex
+    "y": +1,
+  },
+  arr: [1, 2, 3],
+  /* 结尾 */
+}
+`
+	set := func(data []byte, path string, value any) ([]byte, error) {
+		return sjson.SetBytes(data, path, value)
+	}
+	del := func(data []byte, path string, _ any) ([]byte, error) {
+		return sjson.DeleteBytes(data, path)
+	}
+
+	tests := []struct {
+		name      string
+		operation func([]byte, string, any) ([]byte, error)
+		path      string
+		value     any
+		want      string
+	}{
+		{"替换", set, "nested.y", 2, `{
+  // 设备列表
+  "nested": {
+    "x": 0x10, // hex
+    "y": 2,
+  },
+  arr: [1, 2, 3],
+  /* 结尾 */
+}
+`},
+		{"删除最后的成员保留前一行的注释", del, "nested.y", nil, `{
+  // 设备列表
+  "nested": {
+    "x": 0x10, // hex
+  },
+  arr: [1, 2, 3],
+  /* 结尾 */
+}
+`},
+		{"删除整行和它的注释", del, "nested.x", nil, `{
+  // 设备列表
+  "nested": {
+    "y": +1,
+  },
+  arr: [1, 2, 3],
+  /* 结尾 */
+}
+`},
+		{"删除同一行中的元素", del, "arr.1", nil, `{
+  // 设备列表
+  "nested": {
+    "x": 0x10, // hex
+    "y": +1,
+  },
+  arr: [1, 3],
+  /* 结尾 */
+}
+`},
+		{"插入到新的一行", set, "nested.z", "new", `{
+  // 设备列表
+  "nested": {
+    "x": 0x10, // hex
+    "y": +1,
+    "z":"new",
+  },
+  arr: [1, 2, 3],
+  /* 结尾 */
+}
+`},
+		{"同一行的数组追加", set, "arr.-1", 4, `{
+  // 设备列表
+  "nested": {
+    "x": 0x10, // hex
+    "y": +1,
+  },
+  arr: [1, 2, 3, 4],
+  /* 结尾 */
+}
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := preserveJSON5(tt.operation)([]byte(src), tt.path, tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("结果 =\n%s\n期望\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSON5SpliceNoTrailingComma(t *testing.T) {
+	const src = "{\n  \"a\": 1, // a\n  \"b\": 2\n}"
+	got, err := preserveJSON5(func(data []byte, path string, _ any) ([]byte, error) {
+		return sjson.DeleteBytes(data, path)
+	})([]byte(src), "b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 逗号和注释之间不能断开，留下 JSON5 允许的结尾逗号
+	if want := "{\n  \"a\": 1, // a\n}"; string(got) != want {
+		t.Errorf("结果 = %q，期望 %q", got, want)
+	}
+	if _, err := parseJSON5(got); err != nil {
+		t.Errorf("结果不是有效的 JSON5: %v", err)
+	}
+}
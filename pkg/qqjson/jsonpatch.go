@@ -0,0 +1,691 @@
+package qqjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 结构化 diff 和 RFC 6902 JSON Patch / RFC 7386 JSON Merge Patch
+// 文档统一用 UseNumber 解码，数字按原始文本保留，避免大整数丢精度
+
+const (
+	DiffOpAdd     = "add"
+	DiffOpRemove  = "remove"
+	DiffOpReplace = "replace"
+)
+
+// 两个文档之间的一处差异，Path 是未转义的路径片段
+type diffChange struct {
+	Op   string
+	Path []string
+	Old  any
+	New  any
+}
+
+// RFC 6902 中的一条操作
+type patchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+// 输出用的 patchOp，remove 不带 value，add/replace/test 的 value 为 null 时也要输出
+type patchOpOut struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	Value *json.RawMessage `json:"value,omitempty"`
+}
+
+// 和 json.Marshal 相同，但是不转义 < > &
+func marshalJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+func decodeJSONDocument(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("JSON 后面有多余的内容")
+	}
+	return v, nil
+}
+
+// 比较 a 和 b，base 是它们在整个文档中的路径片段
+// 对象按键比较，数组按下标比较，多出的元素是 add，缺少的元素从后往前 remove
+func diffJSON(a, b any, base []string) []diffChange {
+	var changes []diffChange
+	diffValue(a, b, base, &changes)
+	return changes
+}
+
+func diffValue(a, b any, path []string, changes *[]diffChange) {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		for _, k := range sortedKeys(av) {
+			child := appendPath(path, k)
+			if bval, exists := bv[k]; exists {
+				diffValue(av[k], bval, child, changes)
+			} else {
+				*changes = append(*changes, diffChange{Op: DiffOpRemove, Path: child, Old: av[k]})
+			}
+		}
+		for _, k := range sortedKeys(bv) {
+			if _, exists := av[k]; !exists {
+				*changes = append(*changes, diffChange{Op: DiffOpAdd, Path: appendPath(path, k), New: bv[k]})
+			}
+		}
+		return
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			break
+		}
+		common := min(len(av), len(bv))
+		for i := 0; i < common; i++ {
+			diffValue(av[i], bv[i], appendPath(path, strconv.Itoa(i)), changes)
+		}
+		for i := common; i < len(bv); i++ {
+			*changes = append(*changes, diffChange{Op: DiffOpAdd, Path: appendPath(path, strconv.Itoa(i)), New: bv[i]})
+		}
+		for i := len(av) - 1; i >= common; i-- {
+			*changes = append(*changes, diffChange{Op: DiffOpRemove, Path: appendPath(path, strconv.Itoa(i)), Old: av[i]})
+		}
+		return
+	}
+
+	if !jsonEqual(a, b) {
+		*changes = append(*changes, diffChange{Op: DiffOpReplace, Path: path, Old: a, New: b})
+	}
+}
+
+// 复制一份再追加，防止多个子路径共用同一个底层数组
+func appendPath(path []string, seg string) []string {
+	out := make([]string, len(path)+1)
+	copy(out, path)
+	out[len(path)] = seg
+	return out
+}
+
+func jsonPointer(segments []string) string {
+	var b strings.Builder
+	for _, seg := range segments {
+		b.WriteByte('/')
+		b.WriteString(escapeJSONPointer(seg))
+	}
+	return b.String()
+}
+
+// 把 diff 转换成 RFC 6902 的操作列表
+func diffToPatch(changes []diffChange) ([]byte, error) {
+	ops := make([]patchOpOut, 0, len(changes))
+	for _, c := range changes {
+		op := patchOpOut{Op: c.Op, Path: jsonPointer(c.Path)}
+		if c.Op != DiffOpRemove {
+			raw, err := marshalJSON(c.New)
+			if err != nil {
+				return nil, err
+			}
+			msg := json.RawMessage(raw)
+			op.Value = &msg
+		}
+		ops = append(ops, op)
+	}
+	return marshalJSON(ops)
+}
+
+// 根据补丁的形状选择算法: 数组是 RFC 6902，其它是 RFC 7386
+func applyPatch(doc any, patchData []byte) (any, error) {
+	patch, err := decodeJSONDocument(patchData)
+	if err != nil {
+		return nil, fmt.Errorf("补丁不是有效的 JSON: %w", err)
+	}
+
+	if _, isArray := patch.([]any); !isArray {
+		return mergePatch(doc, patch), nil
+	}
+
+	ops, values, err := decodePatchOps(patchData)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		doc, err = applyPatchOp(doc, op, values[i] != nil)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 条操作 %s %q 失败: %w", i+1, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+// 解析 RFC 6902 的操作列表，values 是每条操作原始的 value，缺失时为 nil
+// value 字段缺失和 value 为 null 需要区分
+func decodePatchOps(patchData []byte) ([]patchOp, []json.RawMessage, error) {
+	var ops []patchOp
+	dec := json.NewDecoder(bytes.NewReader(patchData))
+	dec.UseNumber()
+	if err := dec.Decode(&ops); err != nil {
+		return nil, nil, fmt.Errorf("无效的 JSON Patch: %w", err)
+	}
+	var rawOps []map[string]json.RawMessage
+	if err := json.Unmarshal(patchData, &rawOps); err != nil {
+		return nil, nil, fmt.Errorf("无效的 JSON Patch: %w", err)
+	}
+
+	values := make([]json.RawMessage, len(ops))
+	for i := range ops {
+		if raw, ok := rawOps[i]["value"]; ok {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, raw); err != nil {
+				return nil, nil, fmt.Errorf("无效的 JSON Patch: %w", err)
+			}
+			values[i] = buf.Bytes()
+		}
+	}
+	return ops, values, nil
+}
+
+// 和 applyPatch 相同，但是直接修改 JSON 文本，没有修改的部分保持原来的键顺序和格式
+// 每条操作先在解码后的文档上执行，检查通过后再用 sjson 修改文本
+func applyPatchRaw(data, patchData []byte) ([]byte, error) {
+	doc, err := decodeJSONDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decodeJSONDocument(patchData); err != nil {
+		return nil, fmt.Errorf("补丁不是有效的 JSON: %w", err)
+	}
+
+	patch := gjson.ParseBytes(patchData)
+	if !patch.IsArray() {
+		return mergePatchRaw(data, "", patch)
+	}
+
+	ops, values, err := decodePatchOps(patchData)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		doc, err = applyPatchOp(doc, op, values[i] != nil)
+		if err == nil {
+			data, err = applyPatchOpRaw(data, op, values[i])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 条操作 %s %q 失败: %w", i+1, op.Op, op.Path, err)
+		}
+	}
+	return data, nil
+}
+
+// 在 JSON 文本上执行一条已经检查过的操作
+func applyPatchOpRaw(data []byte, op patchOp, value []byte) ([]byte, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		return rawPointerAdd(data, path, value)
+	case "remove":
+		return rawPointerRemove(data, path)
+	case "replace":
+		if len(path) == 0 {
+			return value, nil
+		}
+		return sjson.SetRawBytes(data, qJsonEscapeAndJoin(path), value)
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		val := []byte(rawGet(data, qJsonEscapeAndJoin(from)).Raw)
+		if op.Op == "move" {
+			if data, err = rawPointerRemove(data, from); err != nil {
+				return nil, err
+			}
+		}
+		return rawPointerAdd(data, path, val)
+	default:
+		// test 不修改文档
+		return data, nil
+	}
+}
+
+// 和 gjson.GetBytes 相同，path 为 "" 时是整个文档，Index 都是在 data 中的偏移
+func rawGet(data []byte, path string) gjson.Result {
+	if path != "" {
+		return gjson.GetBytes(data, path)
+	}
+	res := gjson.ParseBytes(data)
+	res.Index = len(data) - len(bytes.TrimLeft(data, " \t\r\n"))
+	return res
+}
+
+func joinRawPath(parent, seg string) string {
+	if parent == "" {
+		return seg
+	}
+	return parent + "." + seg
+}
+
+// 对象中的键直接设置(已经存在时保持原来的位置)，数组中的元素插入到指定下标之前
+func rawPointerAdd(data []byte, path []string, value []byte) ([]byte, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parentPath, last := qJsonEscapeAndJoin(path[:len(path)-1]), path[len(path)-1]
+	parent := rawGet(data, parentPath)
+	if !parent.IsArray() {
+		return rawSetKey(data, parentPath, last, value)
+	}
+
+	elems := parent.Array()
+	idx := len(elems)
+	if last != "-" {
+		idx, _ = strconv.Atoi(last)
+	}
+	if idx == len(elems) {
+		return rawAppend(data, parentPath, value)
+	}
+
+	// 插入到原来的元素前面，使用和它相同的前导空白，多行数组插入后仍然每行一个元素
+	at := rawGet(data, joinRawPath(parentPath, strconv.Itoa(idx))).Index
+	return insertBytes(data, at, value, []byte(","), leadingSpace(data, at)), nil
+}
+
+func rawPointerRemove(data []byte, path []string) ([]byte, error) {
+	if len(path) == 0 {
+		return []byte("null"), nil
+	}
+	return sjson.DeleteBytes(data, qJsonEscapeAndJoin(path))
+}
+
+// 设置对象 parentPath 中的键，键已经存在时替换值，不存在时追加到最后
+func rawSetKey(data []byte, parentPath, key string, value []byte) ([]byte, error) {
+	child := joinRawPath(parentPath, qJsonEscape(key))
+	if gjson.GetBytes(data, child).Exists() {
+		return sjson.SetRawBytes(data, child, value)
+	}
+	return rawAppend(data, parentPath, value, key)
+}
+
+// 在对象或者数组的最后一个成员后面追加，换行和缩进和最后一个成员相同
+// 对象需要传入键，空的容器交给 sjson 处理
+func rawAppend(data []byte, parentPath string, value []byte, key ...string) ([]byte, error) {
+	parent := rawGet(data, parentPath)
+	var lastKey, lastValue gjson.Result
+	parent.ForEach(func(k, v gjson.Result) bool {
+		lastKey, lastValue = k, v
+		return true
+	})
+	if !lastValue.Exists() || lastValue.Index == 0 {
+		if len(key) > 0 {
+			return sjson.SetRawBytes(data, joinRawPath(parentPath, qJsonEscape(key[0])), value)
+		}
+		return sjson.SetRawBytes(data, joinRawPath(parentPath, "-1"), value)
+	}
+
+	start := lastValue.Index
+	member := value
+	if len(key) > 0 {
+		start = lastKey.Index
+		name, err := marshalJSON(key[0])
+		if err != nil {
+			return nil, err
+		}
+		// 键和值之间的分隔和最后一个成员相同，比如 ": "
+		sep := data[lastKey.Index+len(lastKey.Raw) : lastValue.Index]
+		member = append(append(name, sep...), value...)
+	}
+	end := lastValue.Index + len(lastValue.Raw)
+	return insertBytes(data, end, []byte(","), leadingSpace(data, start), member), nil
+}
+
+// data[at] 前面的空白
+func leadingSpace(data []byte, at int) []byte {
+	start := at
+	for start > 0 && strings.IndexByte(" \t\r\n", data[start-1]) >= 0 {
+		start--
+	}
+	return data[start:at]
+}
+
+func insertBytes(data []byte, at int, parts ...[]byte) []byte {
+	var out bytes.Buffer
+	out.Write(data[:at])
+	for _, p := range parts {
+		out.Write(p)
+	}
+	out.Write(data[at:])
+	return out.Bytes()
+}
+
+// RFC 7386 应用到 JSON 文本上，path 是 gjson 路径，新增的键按补丁中的顺序追加
+func mergePatchRaw(data []byte, path string, patch gjson.Result) ([]byte, error) {
+	if !patch.IsObject() {
+		if path == "" {
+			return []byte(patch.Raw), nil
+		}
+		return sjson.SetRawBytes(data, path, []byte(patch.Raw))
+	}
+	if !rawGet(data, path).IsObject() {
+		if path == "" {
+			data = []byte("{}")
+		} else {
+			var err error
+			if data, err = sjson.SetRawBytes(data, path, []byte("{}")); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var err error
+	patch.ForEach(func(key, value gjson.Result) bool {
+		child := joinRawPath(path, qJsonEscape(key.String()))
+		switch {
+		case value.Type == gjson.Null:
+			if gjson.GetBytes(data, child).Exists() {
+				data, err = sjson.DeleteBytes(data, child)
+			}
+		case !gjson.GetBytes(data, child).Exists():
+			// 新的键先追加一个空值，再递归设置，嵌套对象中的 null 会被去掉
+			if data, err = rawSetKey(data, path, key.String(), []byte("null")); err == nil {
+				data, err = mergePatchRaw(data, child, value)
+			}
+		default:
+			data, err = mergePatchRaw(data, child, value)
+		}
+		return err == nil
+	})
+	return data, err
+}
+
+// 错误类型，test 操作不通过时返回，用于区分补丁本身有问题的情况
+type patchTestError struct {
+	path string
+}
+
+func (e *patchTestError) Error() string {
+	return fmt.Sprintf("test 不通过: %s", e.path)
+}
+
+func applyPatchOp(doc any, op patchOp, hasValue bool) (any, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	needValue := op.Op == "add" || op.Op == "replace" || op.Op == "test"
+	if needValue && !hasValue {
+		return nil, fmt.Errorf("缺少 value")
+	}
+
+	switch op.Op {
+	case "add":
+		return pointerAdd(doc, path, op.Value)
+	case "remove":
+		doc, _, err = pointerRemove(doc, path)
+		return doc, err
+	case "replace":
+		if _, err := pointerGet(doc, path); err != nil {
+			return nil, err
+		}
+		doc, _, err = pointerRemove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, op.Value)
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if isPointerPrefix(from, path) && len(from) < len(path) {
+				return nil, fmt.Errorf("不能把 %q 移动到它自己的子路径下", op.From)
+			}
+			var val any
+			doc, val, err = pointerRemove(doc, from)
+			if err != nil {
+				return nil, err
+			}
+			return pointerAdd(doc, path, val)
+		}
+		val, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, deepCopyJSON(val))
+	case "test":
+		val, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(val, op.Value) {
+			return nil, &patchTestError{path: op.Path}
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("未知的操作: %q", op.Op)
+	}
+}
+
+// RFC 7386: 补丁中的 null 表示删除，对象递归合并，其它值直接替换
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+func parseJSONPointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("无效的 JSON Pointer: %q", ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = unescapeJSONPointer(t)
+	}
+	return tokens, nil
+}
+
+func isPointerPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 数组下标，allowEnd 为 true 时允许 - 和 len（表示追加）
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("无效的数组下标: %q", token)
+	}
+	limit := length - 1
+	if allowEnd {
+		limit = length
+	}
+	if idx > limit {
+		return 0, fmt.Errorf("数组下标越界: %d", idx)
+	}
+	return idx, nil
+}
+
+func pointerGet(doc any, path []string) (any, error) {
+	cur := doc
+	for _, token := range path {
+		switch node := cur.(type) {
+		case map[string]any:
+			next, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("路径不存在: %s", jsonPointer(path))
+			}
+			cur = next
+		case []any:
+			idx, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			cur = node[idx]
+		default:
+			return nil, fmt.Errorf("路径不存在: %s", jsonPointer(path))
+		}
+	}
+	return cur, nil
+}
+
+// 找到 path 的父容器并用 fn 修改，返回修改后的文档
+// 数组插入删除会产生新的切片，所以每一层都要把子节点写回父节点
+func pointerUpdate(doc any, path []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	token := path[0]
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("父路径不存在: %q", token)
+		}
+		updated, err := pointerUpdate(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = updated
+		return node, nil
+	case []any:
+		idx, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := pointerUpdate(node[idx], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[idx] = updated
+		return node, nil
+	default:
+		return nil, fmt.Errorf("父路径 %q 不是对象或数组", token)
+	}
+}
+
+func pointerAdd(doc any, path []string, val any) (any, error) {
+	if len(path) == 0 {
+		return val, nil
+	}
+	return pointerUpdate(doc, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			node[token] = val
+			return node, nil
+		case []any:
+			idx, err := arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[idx+1:], node[idx:])
+			node[idx] = val
+			return node, nil
+		default:
+			return nil, fmt.Errorf("父节点不是对象或数组")
+		}
+	})
+}
+
+func pointerRemove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	var removed any
+	updated, err := pointerUpdate(doc, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			val, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("路径不存在: %s", jsonPointer(path))
+			}
+			removed = val
+			delete(node, token)
+			return node, nil
+		case []any:
+			idx, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[idx]
+			return append(node[:idx], node[idx+1:]...), nil
+		default:
+			return nil, fmt.Errorf("父节点不是对象或数组")
+		}
+	})
+	return updated, removed, err
+}
+
+func deepCopyJSON(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			out[k] = deepCopyJSON(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = deepCopyJSON(item)
+		}
+		return out
+	default:
+		return val
+	}
+}
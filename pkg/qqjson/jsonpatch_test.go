@@ -0,0 +1,128 @@
+package qqjson
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  string
+		patch string
+	}{
+		{"相同", `{"a":1,"b":[1,2]}`, `{"b":[1,2],"a":1}`, `[]`},
+		{"1 和 1.0 相等", `{"a":1}`, `{"a":1.0}`, `[]`},
+		{"大整数", `{"sn":12345678901234567890}`, `{"sn":12345678901234567891}`,
+			`[{"op":"replace","path":"/sn","value":12345678901234567891}]`},
+		{"增加和删除", `{"a":1,"x":[1,2,3]}`, `{"b":2,"x":[1]}`,
+			`[{"op":"remove","path":"/a"},{"op":"remove","path":"/x/2"},{"op":"remove","path":"/x/1"},{"op":"add","path":"/b","value":2}]`},
+		{"根的类型不同", `1`, `[1]`, `[{"op":"replace","path":"","value":[1]}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := decodeJSONDocument([]byte(tt.a))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := decodeJSONDocument([]byte(tt.b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			patch, err := diffToPatch(diffJSON(a, b, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(patch) != tt.patch {
+				t.Errorf("patch = %s\n期望    %s", patch, tt.patch)
+			}
+
+			// 补丁应用到 a 上应该得到 b
+			patched, err := applyPatch(a, patch)
+			if err != nil {
+				t.Fatalf("应用补丁失败: %v", err)
+			}
+			if !jsonEqual(patched, b) {
+				t.Errorf("应用补丁后 = %s，期望 %s", compactJSON(patched), tt.b)
+			}
+		})
+	}
+}
+
+func TestApplyPatchRaw(t *testing.T) {
+	const doc = `{
+  "z": 1,
+  "b": {"y": 1, "a": 2},
+  "list": [
+    "x",
+    "y"
+  ],
+  "a": 3
+}`
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{"replace 只修改一个值", `[{"op":"replace","path":"/a","value":4}]`,
+			strings.Replace(doc, `"a": 3`, `"a": 4`, 1)},
+		{"add 已有的键保持位置", `[{"op":"add","path":"/b/y","value":{"k":1,"c":2}}]`,
+			strings.Replace(doc, `"y": 1,`, `"y": {"k":1,"c":2},`, 1)},
+		{"数组中间插入", `[{"op":"add","path":"/list/1","value":"new"}]`,
+			strings.Replace(doc, `"x",`, "\"x\",\n    \"new\",", 1)},
+		{"数组追加", `[{"op":"add","path":"/list/-","value":"end"}]`,
+			strings.Replace(doc, "\"y\"\n", "\"y\",\n    \"end\"\n", 1)},
+		{"remove 和 test", `[{"op":"test","path":"/z","value":1},{"op":"remove","path":"/b/a"}]`,
+			strings.Replace(doc, `{"y": 1, "a": 2}`, `{"y": 1}`, 1)},
+		{"move", `[{"op":"move","from":"/z","path":"/c"}]`,
+			strings.Replace(strings.Replace(doc, "\n  \"z\": 1,", "", 1), "\"a\": 3\n", "\"a\": 3,\n  \"c\": 1\n", 1)},
+		{"merge patch", `{"b":{"a":null,"n":{"q":null,"r":1}},"z":5}`,
+			strings.Replace(strings.Replace(doc, `"z": 1`, `"z": 5`, 1), `{"y": 1, "a": 2}`, `{"y": 1,"n": {"r":1}}`, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyPatchRaw([]byte(doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("结果 = %s\n期望   %s", got, tt.want)
+			}
+
+			// 和在解码后的文档上应用的结果相同
+			decoded, err := decodeJSONDocument([]byte(doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := applyPatch(decoded, []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotDoc, err := decodeJSONDocument(got)
+			if err != nil {
+				t.Fatalf("结果不是有效的 JSON: %v", err)
+			}
+			if !jsonEqual(gotDoc, want) {
+				t.Errorf("结果 = %s，期望 %s", compactJSON(gotDoc), compactJSON(want))
+			}
+		})
+	}
+}
+
+func TestApplyPatchRawErrors(t *testing.T) {
+	const doc = `{"a":[1]}`
+	for _, patch := range []string{
+		`[{"op":"replace","path":"/x","value":1}]`,
+		`[{"op":"add","path":"/a/5","value":1}]`,
+		`[{"op":"add","path":"/a/0"}]`,
+		`[{"op":"move","from":"/a","path":"/a/0"}]`,
+		`[{"op":"test","path":"/a/0","value":2}]`,
+		`[{"op":"copy","from":"/a","path":"/b"},{"op":"remove","path":"/nope"}]`,
+	} {
+		if got, err := applyPatchRaw([]byte(doc), []byte(patch)); err == nil {
+			t.Errorf("%s 应该失败，得到 %s", patch, got)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package qqjson
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"common_tool/pkg/errorutil"
+
+	"github.com/tidwall/gjson"
+)
+
+// JSON Lines / NDJSON 模式，输入逐行读取，每一行是一个独立的文档
+// 输出也是逐行写出，不会把整个输入读入内存
+
+// 按 --lines 处理输入，只支持 r / w / d / a 模式
+func (opts *CLIOptions) runLines() error {
+	if opts.inFormat() != DataFormatJSON || opts.outFormat() != DataFormatJSON {
+		return fmt.Errorf("--lines 只支持 JSON 格式的输入输出")
+	}
+
+	switch opts.Mode {
+	case "r":
+		return opts.readLines()
+	case "w":
+		return opts.modifyLines(opts.Input, setValue)
+	case "d":
+		return opts.modifyLines(nil, deleteValue)
+	case "a":
+		operation, err := opts.arrayOperation()
+		if err != nil {
+			return err
+		}
+		return opts.modifyLines(opts.Input, operation)
+	default:
+		return fmt.Errorf("--lines 只支持 r / w / d / a 模式: %q", opts.Mode)
+	}
+}
+
+// 逐行读取，空行跳过，fn 收到的行不包含结尾的换行符
+// 不用 bufio.Scanner，因为它对单行的长度有上限
+func eachLine(r io.Reader, fn func(lineNo int, line []byte) error) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	lineNo := 0
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			lineNo++
+			line = bytes.TrimRight(line, "\r\n")
+			if len(bytes.TrimSpace(line)) > 0 {
+				if errFn := fn(lineNo, line); errFn != nil {
+					return errFn
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取失败: %w", err)
+		}
+	}
+}
+
+// 所有的 --filter 条件都满足时返回 true
+func (opts *CLIOptions) matchFilters(line []byte) bool {
+	if len(opts.Filters) == 0 {
+		return true
+	}
+
+	for _, f := range opts.Filters {
+		if !matchCondition(line, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// doc 是否满足 gjson 的查询条件，把 doc 包装成单元素数组后用 #(...) 判断
+func matchCondition(doc []byte, cond string) bool {
+	wrapped := make([]byte, 0, len(doc)+2)
+	wrapped = append(wrapped, '[')
+	wrapped = append(wrapped, doc...)
+	wrapped = append(wrapped, ']')
+	return gjson.GetBytes(wrapped, "#("+cond+")").Exists()
+}
+
+func invalidLineError(lineNo int) error {
+	return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData,
+		fmt.Sprintf("第 %d 行不是有效的 JSON", lineNo),
+		fmt.Errorf("第 %d 行不是有效的 JSON", lineNo))
+}
+
+// 每条满足条件的记录按 -t 输出一行，-p 不存在的记录跳过
+func (opts *CLIOptions) readLines() error {
+	formatter, err := opts.formatter()
+	if err != nil {
+		return err
+	}
+
+	reader, err := opts.openInput()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	out := bufio.NewWriter(os.Stdout)
+	err = eachLine(reader, func(lineNo int, line []byte) error {
+		if !gjson.ValidBytes(line) {
+			return invalidLineError(lineNo)
+		}
+		if !opts.matchFilters(line) {
+			return nil
+		}
+
+		result := gjson.ParseBytes(line)
+		if opts.Path != "" {
+			result = gjson.GetBytes(line, opts.Path)
+			if !result.Exists() {
+				return nil
+			}
+		}
+		return opts.writeLineResult(out, formatter, result)
+	})
+	if errFlush := out.Flush(); err == nil && errFlush != nil {
+		err = errorutil.NewExitError(errorutil.CodeIOError, errFlush)
+	}
+	return err
+}
+
+// 每个结果后面只输出一个换行，type 格式直接打印类型码，-m b / -m q 的读取也使用这里
+func (opts *CLIOptions) writeLineResult(w io.Writer, formatter OutputFormatter, res gjson.Result) error {
+	switch formatter.(type) {
+	case BashFormatter:
+		writeBash(w, res)
+	case BashTreeFormatter:
+		writeBashTree(w, res, formatter.(BashTreeFormatter).Prefix)
+		return nil
+	case TypeFormatter:
+		fmt.Fprint(w, outputType(res).CmdExitCode)
+	default:
+		formatted := formatJSON([]byte(res.Raw), opts.JSONFormat, opts.TrieSeparator)
+		if _, err := w.Write(bytes.TrimRight(formatted, "\n")); err != nil {
+			return errorutil.NewExitError(errorutil.CodeIOError, err)
+		}
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// 对每条满足条件的记录应用修改，不满足条件的记录原样输出
+// 文件的情况流式写入临时文件后替换，其它情况输出到标准输出
+func (opts *CLIOptions) modifyLines(
+	value any,
+	operation func([]byte, string, any) ([]byte, error)) error {
+
+	process := func(r io.Reader, w io.Writer) error {
+		return eachLine(r, func(lineNo int, line []byte) error {
+			if !gjson.ValidBytes(line) {
+				return invalidLineError(lineNo)
+			}
+
+			updated := line
+			if opts.matchFilters(line) {
+				var err error
+				updated, err = opts.applyOperation(line, value, operation)
+				if err != nil {
+					return fmt.Errorf("第 %d 行处理失败: %w", lineNo, err)
+				}
+				updated = bytes.TrimRight(formatJSON(updated, opts.JSONFormat, opts.TrieSeparator), "\n")
+			}
+
+			if _, err := w.Write(updated); err != nil {
+				return err
+			}
+			_, err := io.WriteString(w, "\n")
+			return err
+		})
+	}
+
+	if opts.Kind != "file" {
+		reader, err := opts.openInput()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		out := bufio.NewWriter(os.Stdout)
+		err = process(reader, out)
+		if errFlush := out.Flush(); err == nil && errFlush != nil {
+			err = errorutil.NewExitError(errorutil.CodeIOError, errFlush)
+		}
+		return err
+	}
+
+	unlock, err := opts.lockTarget()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if opts.Backup {
+		if err := copyFileAtomic(opts.InArg, opts.InArg+backupSuffix); err != nil {
+			return fmt.Errorf("备份文件失败: %w", err)
+		}
+	}
+
+	f, err := os.Open(opts.InArg)
+	if err != nil {
+		return fmt.Errorf("无法打开文件: %w", err)
+	}
+	defer f.Close()
+
+	return writeFileAtomicFunc(opts.InArg, 0644, func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		if err := process(f, bw); err != nil {
+			return err
+		}
+		return bw.Flush()
+	})
+}
+
+// 流式复制文件，用于大文件的 --backup
+func copyFileAtomic(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return writeFileAtomicFunc(dst, 0644, func(w io.Writer) error {
+		_, err := io.Copy(w, f)
+		return err
+	})
+}
@@ -0,0 +1,164 @@
+package qqjson
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"common_tool/pkg/errorutil"
+)
+
+const testLines = "{\"a\":1,\"t\":\"x\"}\r\n\n   \n{\"b\":2,\"t\":\"y\"}\n{\"a\":{\"c\":3},\"t\":\"x\"}"
+
+func TestEachLine(t *testing.T) {
+	var got []string
+	err := eachLine(strings.NewReader(testLines), func(lineNo int, line []byte) error {
+		got = append(got, fmt.Sprintf("%d:%s", lineNo, line))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 空行不回调但是计入行号，\r\n 去掉，最后一行没有换行也要读到
+	want := []string{`1:{"a":1,"t":"x"}`, `4:{"b":2,"t":"y"}`, `5:{"a":{"c":3},"t":"x"}`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("eachLine = %q，期望 %q", got, want)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = eachLine(strings.NewReader(testLines), func(int, []byte) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("回调返回错误时应该立即停止: err=%v calls=%d", err, calls)
+	}
+}
+
+func TestMatchFilters(t *testing.T) {
+	line := []byte(`{"a":1,"t":"x","tags":["p","q"]}`)
+	tests := []struct {
+		filters []string
+		want    bool
+	}{
+		{nil, true},
+		{[]string{`t=="x"`}, true},
+		{[]string{`t=="y"`}, false},
+		{[]string{`a>0`, `t=="x"`}, true},
+		{[]string{`a>0`, `t=="y"`}, false},
+		{[]string{`missing=="x"`}, false},
+		{[]string{`tags.#==2`}, true},
+		{[]string{`t%"x*"`}, true},
+	}
+	for _, tt := range tests {
+		opts := &CLIOptions{Filters: tt.filters}
+		if got := opts.matchFilters(line); got != tt.want {
+			t.Errorf("matchFilters(%q) = %v，期望 %v", tt.filters, got, tt.want)
+		}
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	tests := []struct {
+		path    string
+		filters []string
+		format  string
+		want    string
+	}{
+		{"", nil, "txt", "{\"a\":1,\"t\":\"x\"}\n{\"b\":2,\"t\":\"y\"}\n{\"a\":{\"c\":3},\"t\":\"x\"}\n"},
+		// 没有 -p 的记录跳过，不输出空行
+		{"a", nil, "txt", "1\n{\"c\":3}\n"},
+		{"a.c", nil, "txt", "3\n"},
+		{"t", []string{`a==1`}, "txt", "\"x\"\n"},
+		{"b", []string{`t=="x"`}, "txt", ""},
+		{"a", nil, "type", "4\n7\n"},
+	}
+	for _, tt := range tests {
+		opts := &CLIOptions{Kind: "str", InArg: testLines, Mode: "r", Path: tt.path,
+			Filters: tt.filters, Format: tt.format, JSONFormat: JSONFormatRaw}
+		if got := captureStdout(t, opts.runLines); got != tt.want {
+			t.Errorf("-p %q --filter %q -t %s = %q，期望 %q", tt.path, tt.filters, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestReadLinesInvalid(t *testing.T) {
+	opts := &CLIOptions{Kind: "str", InArg: "{\"a\":1}\n\n{bad\n", Mode: "r", Format: "txt", JSONFormat: JSONFormatRaw}
+	var err error
+	captureStdout(t, func() error {
+		err = opts.runLines()
+		return nil
+	})
+	var exitErr *errorutil.ExitErrorWithCode
+	if !errors.As(err, &exitErr) || exitErr.Code != errorutil.CodeInvalidData || !strings.Contains(exitErr.Message, "第 3 行") {
+		t.Errorf("无效的行应该返回第 3 行的 CodeInvalidData，得到 %v", err)
+	}
+
+	for _, o := range []*CLIOptions{
+		{Kind: "str", InArg: "{}", Mode: "v"},
+		{Kind: "str", InArg: "{}", Mode: "r", InFormat: DataFormatYAML},
+	} {
+		if err := o.runLines(); err == nil {
+			t.Errorf("-m %s --in-format %q 应该返回错误", o.Mode, o.InFormat)
+		}
+	}
+}
+
+func TestModifyLines(t *testing.T) {
+	tests := []struct {
+		mode    string
+		path    string
+		input   any
+		filters []string
+		want    string
+	}{
+		// 没有路径的记录删除时原样输出
+		{"d", "a", nil, nil, "{\"t\":\"x\"}\n{\"b\":2,\"t\":\"y\"}\n{\"t\":\"x\"}\n"},
+		{"w", "n", "v", []string{`t=="x"`}, "{\"a\":1,\"t\":\"x\",\"n\":\"v\"}\n{\"b\":2,\"t\":\"y\"}\n{\"a\":{\"c\":3},\"t\":\"x\",\"n\":\"v\"}\n"},
+		{"d", "b", nil, []string{`t=="x"`}, "{\"a\":1,\"t\":\"x\"}\n{\"b\":2,\"t\":\"y\"}\n{\"a\":{\"c\":3},\"t\":\"x\"}\n"},
+	}
+	for _, tt := range tests {
+		opts := &CLIOptions{Kind: "str", InArg: testLines, Mode: tt.mode, Path: tt.path, Input: tt.input,
+			Filters: tt.filters, JSONFormat: JSONFormatRaw}
+		if got := captureStdout(t, opts.runLines); got != tt.want {
+			t.Errorf("-m %s -p %s --filter %q = %q，期望 %q", tt.mode, tt.path, tt.filters, got, tt.want)
+		}
+	}
+}
+
+// 文件的情况写回原文件，处理失败时原文件不变
+func TestModifyLinesFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "log.jsonl")
+	if err := os.WriteFile(file, []byte(testLines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &CLIOptions{Kind: "file", InArg: file, Mode: "w", Path: "t", Input: "z",
+		Filters: []string{`t=="y"`}, JSONFormat: JSONFormatRaw}
+	if err := opts.runLines(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\"a\":1,\"t\":\"x\"}\n{\"b\":2,\"t\":\"z\"}\n{\"a\":{\"c\":3},\"t\":\"x\"}\n"
+	if string(got) != want {
+		t.Errorf("写回的内容 = %q，期望 %q", got, want)
+	}
+
+	if err := os.WriteFile(file, []byte(want+"{bad\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	opts = &CLIOptions{Kind: "file", InArg: file, Mode: "d", Path: "a", JSONFormat: JSONFormatRaw}
+	if err := opts.runLines(); err == nil {
+		t.Fatal("无效的行应该返回错误")
+	}
+	if got, _ := os.ReadFile(file); string(got) != want+"{bad\n" {
+		t.Errorf("失败时原文件被修改: %q", got)
+	}
+}
@@ -0,0 +1,392 @@
+package qqjson
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"common_tool/pkg/errorutil"
+
+	"github.com/tidwall/gjson"
+)
+
+// 合并策略
+// replace : 后面的值整体替换前面的值
+// deep    : 对象按键递归合并，其它类型替换(默认)
+// concat  : 数组首尾连接，其它类型替换
+// union   : 数组按值去重合并，union:key 时对象元素按 key 字段合并
+// error   : 两边的值不同时报错
+const (
+	MergeReplace = "replace"
+	MergeDeep    = "deep"
+	MergeConcat  = "concat"
+	MergeUnion   = "union"
+	MergeError   = "error"
+)
+
+type mergeStrategy struct {
+	name string
+	// union 的键字段，为空时按整个值去重
+	key string
+}
+
+// --rule 指定的某个路径的策略，路径中的 * 匹配任意一段
+type mergeRule struct {
+	path     []string
+	strategy mergeStrategy
+}
+
+func parseMergeStrategy(s string) (mergeStrategy, error) {
+	name, key, _ := strings.Cut(s, ":")
+	switch name {
+	case MergeReplace, MergeDeep, MergeConcat, MergeError:
+		if key != "" {
+			return mergeStrategy{}, fmt.Errorf("策略 %s 不支持参数: %q", name, s)
+		}
+	case MergeUnion:
+	default:
+		return mergeStrategy{}, fmt.Errorf("未知的合并策略: %q，请使用 replace / deep / concat / union[:key] / error", s)
+	}
+	return mergeStrategy{name: name, key: key}, nil
+}
+
+// path=strategy，路径和 -p 参数的格式相同
+func parseMergeRule(s string) (mergeRule, error) {
+	eq := strings.LastIndex(s, "=")
+	if eq < 0 {
+		return mergeRule{}, fmt.Errorf("规则缺少 =: %q", s)
+	}
+	strategy, err := parseMergeStrategy(s[eq+1:])
+	if err != nil {
+		return mergeRule{}, err
+	}
+	return mergeRule{path: splitGJSONPath(s[:eq]), strategy: strategy}, nil
+}
+
+func (r mergeRule) match(path []string) bool {
+	if len(r.path) != len(path) {
+		return false
+	}
+	for i, seg := range r.path {
+		if seg != "*" && seg != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 合并过程中的节点，保留键的顺序并记录每个值来自哪个输入
+type mergeNode struct {
+	res    gjson.Result
+	keys   []string
+	fields map[string]*mergeNode
+	items  []*mergeNode
+	source string
+}
+
+func newMergeNode(res gjson.Result, source string) *mergeNode {
+	n := &mergeNode{res: res, source: source}
+	switch {
+	case res.IsObject():
+		n.fields = map[string]*mergeNode{}
+		res.ForEach(func(k, v gjson.Result) bool {
+			key := k.String()
+			if _, exists := n.fields[key]; !exists {
+				n.keys = append(n.keys, key)
+			}
+			n.fields[key] = newMergeNode(v, source)
+			return true
+		})
+	case res.IsArray():
+		n.items = []*mergeNode{}
+		res.ForEach(func(_, v gjson.Result) bool {
+			n.items = append(n.items, newMergeNode(v, source))
+			return true
+		})
+	}
+	return n
+}
+
+func (n *mergeNode) isObject() bool { return n.fields != nil }
+func (n *mergeNode) isArray() bool  { return n.items != nil }
+
+// 按原来的键顺序输出
+func (n *mergeNode) writeJSON(buf *bytes.Buffer) {
+	switch {
+	case n.isObject():
+		buf.WriteByte('{')
+		for i, k := range n.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(marshalString(k))
+			buf.WriteByte(':')
+			n.fields[k].writeJSON(buf)
+		}
+		buf.WriteByte('}')
+	case n.isArray():
+		buf.WriteByte('[')
+		for i, item := range n.items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			item.writeJSON(buf)
+		}
+		buf.WriteByte(']')
+	default:
+		buf.WriteString(n.res.Raw)
+	}
+}
+
+func (n *mergeNode) json() []byte {
+	var buf bytes.Buffer
+	n.writeJSON(&buf)
+	return buf.Bytes()
+}
+
+func (n *mergeNode) equal(other *mergeNode) bool {
+	a, errA := decodeJSONDocument(n.json())
+	b, errB := decodeJSONDocument(other.json())
+	return errA == nil && errB == nil && jsonEqual(a, b)
+}
+
+// 按路径取出子树，不存在时返回 nil
+func (n *mergeNode) lookup(path []string) *mergeNode {
+	for _, seg := range path {
+		switch {
+		case n.isObject():
+			n = n.fields[seg]
+		case n.isArray():
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(n.items) {
+				return nil
+			}
+			n = n.items[i]
+		default:
+			return nil
+		}
+		if n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// 每个叶子(标量、空对象、空数组)的路径和来源，按文档顺序
+func (n *mergeNode) provenance(path []string, fn func(path []string, source string)) {
+	switch {
+	case n.isObject() && len(n.keys) > 0:
+		for _, k := range n.keys {
+			n.fields[k].provenance(appendPath(path, k), fn)
+		}
+	case n.isArray() && len(n.items) > 0:
+		for i, item := range n.items {
+			item.provenance(appendPath(path, strconv.Itoa(i)), fn)
+		}
+	default:
+		fn(path, n.source)
+	}
+}
+
+type merger struct {
+	strategy mergeStrategy
+	rules    []mergeRule
+}
+
+// 最后一条匹配的规则生效，没有匹配的规则时使用 --strategy
+func (m *merger) strategyFor(path []string) mergeStrategy {
+	strategy := m.strategy
+	for _, r := range m.rules {
+		if r.match(path) {
+			strategy = r.strategy
+		}
+	}
+	return strategy
+}
+
+func (m *merger) merge(dst, src *mergeNode, path []string) (*mergeNode, error) {
+	strategy := m.strategyFor(path)
+	switch strategy.name {
+	case MergeReplace:
+		return src, nil
+	case MergeError:
+		// 对象继续按键比较，只有两边都有而且值不同的叶子才算冲突
+		if dst.isObject() && src.isObject() {
+			return m.mergeFields(dst, src, path)
+		}
+		if !dst.equal(src) {
+			return nil, fmt.Errorf("路径 %q 的值冲突: %s 中是 %s，%s 中是 %s",
+				qJsonEscapeAndJoin(path), dst.source, dst.json(), src.source, src.json())
+		}
+		return dst, nil
+	case MergeConcat:
+		if dst.isArray() && src.isArray() {
+			items := append(append([]*mergeNode{}, dst.items...), src.items...)
+			return &mergeNode{items: items, source: src.source}, nil
+		}
+		return src, nil
+	case MergeUnion:
+		if dst.isArray() && src.isArray() {
+			return m.union(dst, src, path, strategy.key)
+		}
+		return src, nil
+	default:
+		if !dst.isObject() || !src.isObject() {
+			return src, nil
+		}
+		return m.mergeFields(dst, src, path)
+	}
+}
+
+// 两个对象按键合并，dst 中没有的键直接加入，都有的键按规则继续合并
+func (m *merger) mergeFields(dst, src *mergeNode, path []string) (*mergeNode, error) {
+	for _, k := range src.keys {
+		old, exists := dst.fields[k]
+		if !exists {
+			dst.keys = append(dst.keys, k)
+			dst.fields[k] = src.fields[k]
+			continue
+		}
+		merged, err := m.merge(old, src.fields[k], appendPath(path, k))
+		if err != nil {
+			return nil, err
+		}
+		dst.fields[k] = merged
+	}
+	return dst, nil
+}
+
+// 没有 key 时追加 dst 中没有的元素
+// 有 key 时 key 字段相同的对象元素继续按规则合并，其它元素追加
+func (m *merger) union(dst, src *mergeNode, path []string, key string) (*mergeNode, error) {
+	items := append([]*mergeNode{}, dst.items...)
+	for _, item := range src.items {
+		matched := -1
+		for i, have := range items {
+			if key == "" {
+				if have.equal(item) {
+					matched = i
+					break
+				}
+				continue
+			}
+			hk, ik := have.fields[key], item.fields[key]
+			if hk != nil && ik != nil && hk.equal(ik) {
+				matched = i
+				break
+			}
+		}
+
+		switch {
+		case matched < 0:
+			items = append(items, item)
+		case key != "":
+			merged, err := m.merge(items[matched], item, appendPath(path, strconv.Itoa(matched)))
+			if err != nil {
+				return nil, err
+			}
+			items[matched] = merged
+		}
+	}
+	return &mergeNode{items: items, source: src.source}, nil
+}
+
+// 按顺序合并输入和所有的 --with 文件，后面的覆盖前面的
+func (opts *CLIOptions) mergeJSON() error {
+	formatter, err := opts.formatter()
+	if err != nil {
+		return err
+	}
+	if len(opts.MergeFiles) == 0 {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeMissingInput, "缺少 --with 参数", fmt.Errorf("merge 模式需要至少一个合并的文件"))
+	}
+
+	m := &merger{}
+	if m.strategy, err = parseMergeStrategy(opts.MergeStrategy); err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage, "无效的 --strategy", err)
+	}
+	for _, r := range opts.MergeRules {
+		rule, err := parseMergeRule(r)
+		if err != nil {
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage, "无效的 --rule", err)
+		}
+		m.rules = append(m.rules, rule)
+	}
+
+	raw, err := opts.readDocument()
+	if err != nil {
+		return err
+	}
+	if !gjson.ValidBytes(raw) {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "输入内容不是有效的 JSON", fmt.Errorf("%s 不是有效的 JSON", opts.inputName()))
+	}
+	result := newMergeNode(gjson.ParseBytes(raw), opts.inputName())
+
+	for _, file := range opts.MergeFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("无法读取文件 %s: %w", file, err)
+		}
+		format := opts.InFormat
+		if format == "" {
+			format = formatOfFile(file)
+		}
+		if data, err = convertToJSON(data, format); err != nil {
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "无法转换输入格式", err)
+		}
+		if !gjson.ValidBytes(data) {
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "输入内容不是有效的 JSON", fmt.Errorf("%s 不是有效的 JSON", file))
+		}
+
+		if result, err = m.merge(result, newMergeNode(gjson.ParseBytes(data), file), nil); err != nil {
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeAssertionFailed, "合并冲突", err)
+		}
+	}
+
+	if opts.Provenance {
+		// -p/-P 只报告这个子树中的叶子，路径仍然从根开始
+		base := opts.ArgPath
+		if !opts.UseArgPath {
+			base = splitGJSONPath(opts.Path)
+		}
+		sub := result.lookup(base)
+		if sub == nil {
+			err := fmt.Errorf("字段 %q 不存在", qJsonEscapeAndJoin(base))
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, err.Error(), err)
+		}
+		return opts.formatPath(formatter, provenanceJSON(sub, base), "")
+	}
+	return opts.formatPath(formatter, result.json(), opts.Path)
+}
+
+// 来源报告是一个对象，键是叶子的路径(和 -p 参数的格式相同)，值是文件名
+func provenanceJSON(n *mergeNode, base []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	first := true
+	n.provenance(base, func(path []string, source string) {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		buf.WriteString(marshalString(qJsonEscapeAndJoin(path)))
+		buf.WriteByte(':')
+		buf.WriteString(marshalString(source))
+	})
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// 输入在报告中的名字
+func (opts *CLIOptions) inputName() string {
+	switch opts.Kind {
+	case "file":
+		return opts.InArg
+	case "str":
+		return "<str>"
+	default:
+		return "<stdin>"
+	}
+}
@@ -0,0 +1,86 @@
+package qqjson
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		rules    []string
+		dst, src string
+		// 为空表示期望合并冲突
+		want string
+	}{
+		{"deep", MergeDeep, nil, `{"a":{"x":1,"y":2},"l":[1]}`, `{"a":{"y":3,"z":4},"l":[2]}`, `{"a":{"x":1,"y":3,"z":4},"l":[2]}`},
+		{"replace", MergeReplace, nil, `{"a":{"x":1}}`, `{"a":{"y":2}}`, `{"a":{"y":2}}`},
+		{"concat", MergeConcat, nil, `[1,2]`, `[2,3]`, `[1,2,2,3]`},
+		{"union", MergeUnion, nil, `[1,{"a":1}]`, `[1.0,{"a":1},3]`, `[1,{"a":1},3]`},
+		{"union:key", MergeDeep, []string{"s=union:name"},
+			`{"s":[{"name":"a","v":1},{"name":"b"}]}`, `{"s":[{"name":"a","w":2},{"name":"c"}]}`,
+			`{"s":[{"name":"a","v":1,"w":2},{"name":"b"},{"name":"c"}]}`},
+		{"error 不同的键合并", MergeError, nil, `{"db":{"host":"a","port":1}}`, `{"db":{"user":"x","port":1.0}}`, `{"db":{"host":"a","port":1,"user":"x"}}`},
+		{"error 叶子冲突", MergeError, nil, `{"db":{"port":1}}`, `{"db":{"port":2}}`, ``},
+		{"error 数组整体比较", MergeError, nil, `{"l":[1,2]}`, `{"l":[1]}`, ``},
+		{"error 类型不同", MergeError, nil, `{"a":{}}`, `{"a":1}`, ``},
+		{"规则中的通配符", MergeDeep, []string{"*.v=error"}, `{"x":{"v":1}}`, `{"x":{"v":2}}`, ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &merger{}
+			var err error
+			if m.strategy, err = parseMergeStrategy(tt.strategy); err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range tt.rules {
+				rule, err := parseMergeRule(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				m.rules = append(m.rules, rule)
+			}
+
+			got, err := m.merge(newMergeNode(gjson.Parse(tt.dst), "dst"), newMergeNode(gjson.Parse(tt.src), "src"), nil)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("应该冲突，合并结果 = %s", got.json())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("合并失败: %v", err)
+			}
+			if string(got.json()) != tt.want {
+				t.Errorf("合并结果 = %s，期望 %s", got.json(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeProvenance(t *testing.T) {
+	m := &merger{strategy: mergeStrategy{name: MergeDeep}}
+	result, err := m.merge(
+		newMergeNode(gjson.Parse(`{"db":{"host":"a","port":1},"v":1}`), "d.json"),
+		newMergeNode(gjson.Parse(`{"db":{"port":2}}`), "h.json"),
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(provenanceJSON(result, nil)), `{"db.host":"d.json","db.port":"h.json","v":"d.json"}`; got != want {
+		t.Errorf("来源 = %s，期望 %s", got, want)
+	}
+
+	base := []string{"db"}
+	if got, want := string(provenanceJSON(result.lookup(base), base)), `{"db.host":"d.json","db.port":"h.json"}`; got != want {
+		t.Errorf("子树的来源 = %s，期望 %s", got, want)
+	}
+	if result.lookup([]string{"db", "nope"}) != nil {
+		t.Errorf("不存在的路径应该返回 nil")
+	}
+}
@@ -1,6 +1,7 @@
 package qqjson
 
 import (
+	"bytes"
 	"common_tool/pkg/errorutil"
 	"encoding/json"
 	"fmt"
@@ -22,8 +23,6 @@ var (
 	QqjsonVersion string = "v1.0.2"
 )
 
-// 数组和字典指定写入可以不在这个工具中做
-// 在bash中自己处理
 type CLIOptions struct {
 	// 从文件或者标准输入中来
 	Kind string
@@ -43,6 +42,54 @@ type CLIOptions struct {
 	Mode          string
 	JSONFormat    JSONFormat
 	TrieSeparator string
+	// 批处理模式的脚本文件，- 表示标准输入
+	ScriptFile string
+	// 写回文件前把旧内容保存到 <文件名>.bak
+	Backup bool
+	// validate 模式使用的 JSON Schema 文件
+	SchemaFile string
+	// diff 模式中和输入比较的另一个 JSON 文件
+	OtherFile string
+	// patch 模式的补丁文件，- 表示标准输入
+	PatchFile string
+	// 输入输出的文件格式，内部统一转换成 JSON 处理
+	InFormat  DataFormat
+	OutFormat DataFormat
+	// JSON Lines 模式，每一行是一个独立的文档
+	Lines bool
+	// JSON Lines 模式中保留记录的条件，多个条件需要同时满足
+	Filters []string
+	// q 模式的 jq 查询表达式
+	Query string
+	// -t shtree 生成的变量名前缀
+	VarPrefix string
+	// inflate 模式输入的扁平格式(trie / props)
+	FlatFormat string
+	// merge 模式按顺序合并的文件、默认策略和按路径指定的策略
+	MergeFiles    []string
+	MergeStrategy string
+	MergeRules    []string
+	// merge 模式输出每个叶子的来源而不是合并的结果
+	Provenance bool
+	// a 模式的数组操作，insert 的下标，sort 是否降序
+	ArrayOp    string
+	ArrayIndex int
+	Descending bool
+
+	// 按 JSON5 读取输入，等同于 --in-format json5
+	JSON5 bool
+	// 写入时加密值，读取时解密所有的加密字段，rekey 模式使用的新密钥
+	Encrypt    bool
+	Decrypt    bool
+	KeyFile    string
+	NewKeyFile string
+
+	// 修改前的原始内容，用于 --backup 和 JSON5 的保留格式修改
+	original []byte
+	// 文件是这次新建的，--backup 时没有需要备份的内容
+	created bool
+	// 写回的内容是修改后的 JSON5 原文，不再格式化
+	keepText bool
 }
 
 type JSONFormat string
@@ -53,6 +100,8 @@ const (
 	JSONFormatRaw   JSONFormat = "raw"
 	JSONFormatHuman JSONFormat = "human"
 	JSONFormatTrie  JSONFormat = "trie"
+	// RFC 8785 规范化格式，键排序、数字规范化、没有空白
+	JSONFormatCanonical JSONFormat = "canonical"
 
 	JSONTypeNull    = 1
 	JSONTypeTrue    = 2
@@ -75,7 +124,8 @@ func (f *JSONFormat) Set(val string) error {
 		string(JSONFormatOne),
 		string(JSONFormatRaw),
 		string(JSONFormatTrie),
-		string(JSONFormatHuman):
+		string(JSONFormatHuman),
+		string(JSONFormatCanonical):
 		*f = JSONFormat(val)
 		return nil
 	default:
@@ -95,6 +145,7 @@ func (JSONFormat) Values() []string {
 		string(JSONFormatRaw),
 		string(JSONFormatTrie),
 		string(JSONFormatHuman),
+		string(JSONFormatCanonical),
 	}
 }
 
@@ -331,6 +382,15 @@ gobolt json -m w -k file -i demo.json -p key1.key2.3.specialkey\\.\\[\\].4 -j '{
 
 gobolt json -m w -k file -i demo.json -s "" -M -- ":ke.:y1" "s:value1" ":key2.:key3" 'j:null'
 
+(7). 并发写入和备份
+
+写文件时会先写入同目录下的临时文件再 rename 替换，中途崩溃不会留下截断的文件。
+整个 读取-修改-写回 期间对 <文件名>.lock 加建议锁(flock)，并行的多个 gobolt 写同一
+个文件会排队执行，不会丢失更新。
+
+加上 --backup 会把修改前的内容保存到 <文件名>.bak
+gobolt json -m w -k file -i demo.json --backup -p key1 -s "value1"
+
 
 4. 删除
 
@@ -360,6 +420,355 @@ printf "%s" "str" | ./gobolt json -m s -k stdin
 
 printf "%s" "$str" | ./gobolt json -m e -k stdin
 转换结果会在标准输出中打印出来。
+
+7. 批处理
+
+一次读入 JSON，按顺序执行脚本中的所有操作，最后只写入一次。脚本可以来自文件
+(--script)或者标准输入(--script -，此时 JSON 不能也来自标准输入)。
+
+(1). 按行的脚本格式，每行按 Bash 的规则拆分单词(支持 '' "" $'' 引号)，路径片段
+和 -P 参数一样不需要转义，空行和 # 开头的行会被忽略
+
+set      <字符串值> <路径片段>...
+set-json <JSON值>   <路径片段>...
+delete   <路径片段>...
+read     [路径片段]...
+
+cat > ops.txt <<'EOS'
+set value1 key1 :3 key4
+set-json '[1, null]' key1 "ke.y2"
+delete key1 old
+read key1
+EOS
+./gobolt json -m b -k file -i demo.json -t sh --script ops.txt
+
+(2). JSON 数组格式的脚本
+
+[
+    {"op": "set", "path": ["key1", "key4"], "value": "value1"},
+    {"op": "set-json", "path": ["key1", "ke.y2"], "value": [1, null]},
+    {"op": "delete", "path": ["key1", "old"]},
+    {"op": "read", "path": ["key1"]}
+]
+
+每个 read 的结果按 -t 指定的格式输出，后面跟一个换行，-t type 时直接打印类型码。
+有写入或删除操作时，文件按 -F 指定的格式写回；str/stdin 的情况下修改后的 JSON
+在所有读取结果之后输出到标准输出。
+
+8. JSON Schema 校验
+
+用 --schema 指定的 JSON Schema 校验输入(file/str/stdin 和读取模式相同)，加上 -p/-P
+时只校验对应的子树。支持 draft-07/2020-12 的常用关键字，$ref 只支持文档内引用。
+
+gobolt json -m validate -k file -i demo.json --schema demo.schema.json
+gobolt json -m validate -k file -i demo.json --schema key2.schema.json -P -- key1 key2
+
+-t txt 输出违反约束的列表，路径是 JSON Pointer 格式(相对于整个文档，根是 "")
+[{"path": "/key1/key2/0", "message": "类型错误: 期望 object，实际是 null"}]
+
+-t sh 输出关联数组，同一路径的多条消息用换行连接，根的键是 (root)
+declare -A errs=()
+eval -- errs=($(gobolt json -m validate -t sh -k file -i demo.json --schema demo.schema.json))
+
+校验通过时退出码为 0，不通过时退出码为 66(CodeInvalidData)。
+
+9. 结构化 diff
+
+比较输入(旧)和 --other 指定的文件(新)，加上 -p/-P 时只比较对应的子树。对象按键比较，
+数组按下标比较，数字按数值比较(1 和 1.0 相同)。
+
+gobolt json -m diff -k file -i old.json --other new.json
+
+-t txt 每行一处差异，路径和 -p 参数的格式相同
++ key1.key2\.x: "value1"
+- key1.key3.2: null
+~ key1.num: 1 -> 2
+
+-t sh 输出关联数组，值是 add / remove / replace
+declare -A changes=()
+eval -- changes=($(gobolt json -m diff -t sh -k file -i old.json --other new.json))
+
+-t patch 输出 RFC 6902 JSON Patch(按 -F 格式化)，可以直接交给 -m patch 使用
+gobolt json -m diff -t patch -F one -k file -i old.json --other new.json > change.patch
+
+没有差异时退出码为 0，有差异时退出码为 68(CodeAssertionFailed)。
+
+10. 应用补丁
+
+--patch 指定的补丁(- 表示标准输入)是数组时按 RFC 6902 JSON Patch 处理(支持 add
+remove replace move copy test)，是对象时按 RFC 7386 JSON Merge Patch 处理。写回的方式
+和 -m w 相同(文件加锁、原子替换、--backup、-F 格式)。
+
+gobolt json -m patch -k file -i demo.json --patch change.patch
+gobolt json -m patch -k file -i demo.json --patch merge.json --backup
+
+任何一条操作失败都不会修改文件，test 操作不通过时退出码为 68(CodeAssertionFailed)。
+
+11. YAML / TOML / INI
+
+--in-format 指定输入的格式(json|yaml|toml|ini)，不指定时按文件扩展名判断(.yaml .yml
+.toml .ini)，其它情况都按 JSON 处理。输入会先转换成 JSON，所有的读取、写入、删除、批处理、
+补丁等模式以及 sh / trie 格式都和 JSON 完全一样使用。
+
+gobolt json -m r -t sh -k file -i config.yaml -P -- server ports
+gobolt json -m w -k file -i config.toml -s "value1" -P -- server name
+
+写回时默认使用和输入相同的格式(此时 -F 不起作用)，--out-format 可以指定其它格式，
+比如把 YAML 转换成 JSON:
+
+gobolt json -m w -k str -i "$yaml_str" --in-format yaml --out-format json -F one -P -- key1 -s "value1"
+
+注意:
+	1). 注释和键的顺序不会保留，写回时键按字母排序
+	2). TOML 不能表示 null，null 值在写回时会被丢掉
+	3). INI 只支持两层(顶层的键和 [section] 中的键)，读取到的值都是字符串
+	4). YAML / TOML 中的时间转换成 RFC 3339 格式的字符串
+
+12. JSON Lines / NDJSON
+
+加上 --lines 后输入的每一行是一个独立的文档，输入逐行流式读取，不会整个读入内存，
+适合处理很大的日志文件。空行会被跳过，任何一行不是合法的 JSON 时退出码为 66。
+只支持 r / w / d 三种模式，没有指定 -F 时默认 -F one，每条记录输出一行。
+
+--filter 是 gjson 的查询条件(也就是 #(...) 括号中的部分)，可以重复指定，所有条件都
+满足的记录才会被处理:
+
+gobolt json --lines -m r -k file -i app.log --filter 'level=="error"' --filter 'code>=500' -p msg
+
+(1). 读取
+每条满足条件的记录按 -t 输出一行，-p/-P 指定的路径不存在的记录会被跳过，-t type
+的时候每行打印一个类型码。
+
+(2). 写入和删除
+满足条件的记录应用修改，其它记录原样输出。文件的情况修改后的内容流式写入临时文件再
+替换原文件(同样支持加锁和 --backup)，str/stdin 的情况输出到标准输出。
+
+zcat app.log.gz | gobolt json --lines -m w --filter 'host=="node1"' -s "lab" -P -- site
+gobolt json --lines -m d -k file -i app.log -P -- debug
+
+13. jq 查询
+
+-q/--query 指定的 jq 表达式对输入(或者 -p/-P 指定的子树)求值，结果按 -t 格式输出。
+和批处理中的读取一样，每个结果后面输出一个换行(-t type 打印类型码而不是通过退出码
+返回)，没有结果时什么也不输出。不管有几个结果，成功时退出码都是 0。
+
+gobolt json -m q -k file -i demo.json -q '.items[] | select(.price > 10) | .name'
+gobolt json -m q -t sh -k file -i demo.json -q '{name: .user.name, tags: (.tags | map(ascii_upcase))}'
+gobolt json -m q -k file -i demo.json -q '"\(.host):\(.port)"'
+
+支持的语法(jq 的子集):
+	1). 路径: . .foo ."foo" .[0] .[-1] .[1:3] .[] .. 以及后缀 ? (忽略错误)
+	2). 组合: | , ( ) 表达式 as $x | 表达式
+	3). 字面量: 数字 字符串("\(表达式)" 插值) true false null [ ... ] { ... }
+	    对象的简写 {a, $x, "b": 1, (.k): .v}
+	4). 运算: + - * / % == != < <= > >= and or // 以及 if A then B elif C then D else E end
+	5). 格式: @json @text @csv @tsv @sh @base64 @base64d @uri
+	6). 函数: empty error not length keys keys_unsorted values type has select map
+	    map_values to_entries from_entries with_entries add any all flatten range
+	    sort sort_by group_by unique unique_by min max min_by max_by reverse first last
+	    tostring tonumber tojson fromjson ascii_downcase ascii_upcase ltrimstr rtrimstr
+	    startswith endswith split join test contains inside floor ceil round sqrt abs
+	    nulls booleans numbers strings arrays objects iterables scalars
+
+注意:
+	1). 数字按 float64 处理，超过 2^53 的整数会丢失精度
+	2). 对象的键没有顺序，.[] keys to_entries 等都按键排序后输出
+	3). @sh 和 -t sh 一样使用 $'...' 引用
+	4). 表达式语法错误时退出码为 64，执行出错(比如类型不匹配)时退出码为 66
+	5). 所有结果一次算出来，range 的参数必须是整数，一次最多产生 1048576 个结果
+
+14. 嵌套文档一次导入 bash (-t shtree)
+
+-t sh 只展开一层，-t shtree 把整个子树输出为多条 declare 语句，一次 eval 就可以在
+bash 中得到整个文档。每个对象/数组对应一个变量，变量名是 --var-prefix(默认 J)加上
+转义后的路径，路径的各段之间用 __ 连接，段中字母和数字以外的字节(包括 _)转换成 _xx
+十六进制形式。值的类型前缀和 -t sh 相同，对象和数组的值是 o:/a: 加上子变量的名字。
+
+gobolt json -m r -t shtree --var-prefix cfg -k file -i demo.json -P -- key1
+
+declare -A cfg=([$'key2']=$'o:cfg__key2')
+declare -A cfg__key2=([$'key3']=$'a:cfg__key2__key3')
+declare -a cfg__key2__key3=($'n:null' $'n:null' $'o:cfg__key2__key3__2')
+declare -A cfg__key2__key3__2=([$'other1']=$'s:xx' [$'other2']=$'i:2' ...)
+
+eval -- "$(gobolt json -m r -t shtree --var-prefix cfg -k file -i demo.json -P -- key1)"
+declare -n node=${cfg[key2]#o:}
+echo "${node[key3]}"
+
+在函数中 eval 时所有变量都是局部变量。退出码和 -t sh 一样是子树的类型码，-t shtree
+也可以用于 -m q / -m b / --lines，每个结果输出一组 declare 语句。
+注意 bash 的关联数组不支持空字符串的键，和 -t sh 一样这样的键在 eval 时会报错。
+
+15. 从扁平格式重建 JSON (-m inflate)
+
+-F trie 的逆操作，读取扁平的键值对(-k/-i 和读取模式相同)，组装成 JSON 后按 -F 格式
+输出到标准输出，--out-format 可以输出为其它格式。
+
+(1). --flat trie(默认)
+可以直接使用 -F trie 的输出，也可以是每行一个 路径<SEP>值(比如在 bash 中遍历关联数组
+输出)，分隔符由 -x 指定。值后面带分隔符的是数字/true/false/null/[]/{}，否则是字符串。
+
+declare -A T=()
+eval -- T=($(gobolt json -m r -F trie -k file -i demo.json))
+T[$'{key1}\034{name}\034']='new name'
+for k in "${!T[@]}"; do printf '%s%s\n' "$k" "${T[$k]}"; done | gobolt json -m inflate
+
+(2). --flat props
+每行一个 key.path=value，路径和 -p 参数的格式相同(包括 : 强制创建对象的规则)，
+# 开头的行是注释，键中的 = 写成 \=。值可以带上和 -t sh 相同的类型前缀(s: i: t: f:
+n: o: a:)，没有类型前缀的值都是字符串。
+
+key1.name=s:Alice
+key1.age=i:30
+key1.tags.0=dev
+key1.:2024.ok=t:true
+
+gobolt json -m inflate --flat props -k file -i demo.properties -F mul
+
+注意:
+	1). 每行一个的格式中字符串的值不能包含换行，键不能包含分隔符
+	2). 行格式中 {}<SEP> 结尾的行按空对象处理(而不是空字符串键的空字符串)
+	3). 同一个路径出现多次时后面的覆盖前面的
+
+16. 合并多个文档 (-m merge)
+
+把 --with 指定的文件按顺序合并到输入上，后面的覆盖前面的，适合 默认/站点/主机 这样
+分层的配置。每个文件的格式按扩展名判断(或者都使用 --in-format)，结果按 -t/-F 输出，
+-p/-P 可以只输出合并结果中的一个子树。
+
+gobolt json -m merge -k file -i default.json --with site.yaml --with host.json -F mul
+
+--strategy 指定默认的策略，--rule path=strategy 指定某个路径的策略(可以重复，路径
+和 -p 参数的格式相同，* 匹配任意一段，有多条规则匹配时最后一条生效):
+	replace     后面的值整体替换前面的值
+	deep        对象按键递归合并，其它类型替换(默认)
+	concat      数组首尾连接，其它类型替换
+	union       数组合并，和已有元素相同的元素不再追加
+	union:key   数组中 key 字段相同的对象元素继续按规则合并，其它元素追加
+	error       对象继续按键合并，两边都有的叶子(标量或数组)值不同时报错，
+	            退出码为 68(CodeAssertionFailed)
+
+gobolt json -m merge -k file -i default.json --with host.json \
+	--rule 'servers=union:name' --rule 'plugins=concat' --rule 'version=error' \
+	--rule 'servers.*.env=replace'
+
+--provenance 输出每个叶子(标量、空对象、空数组)来自哪个文件，而不是合并的结果，
+结果是一个以路径为键、文件名为值的对象，同样按 -t/-F 输出。指定 -p/-P 时只输出
+这个子树中的叶子:
+
+gobolt json -m merge -k file -i default.json --with host.json --provenance -F mul
+{
+    "server.port": "host.json",
+    "server.name": "default.json"
+}
+
+注意 union:key 合并后的元素路径中的下标是合并后的下标。
+
+17. 规范化和哈希
+
+-F canonical 按 RFC 8785 (JCS) 输出规范化的 JSON: 没有空白，对象的键按 UTF-16 编码
+排序，数字按 ECMAScript 的规则输出(1.0 -> 1，1e2 -> 100，1e21 -> 1e+21)，字符串只
+转义 " \ 和控制字符。内容相同的文档输出的字节完全相同，可以用于缓存和变更检测。
+
+gobolt json -m r -F canonical -k file -i demo.json
+
+-m hash 输出规范化之后的 SHA-256(十六进制)，-p/-P 指定时只计算对应的子树，键的顺序、
+空白、数字的写法都不影响结果:
+
+gobolt json -m hash -k file -i demo.json
+gobolt json -m hash -k file -i config.yaml -P -- server
+
+注意数字按双精度浮点数处理，超过 2^53 的整数会丢失精度(这是 RFC 8785 的规定)。
+
+18. 数组操作 (-m a)
+
+--op 指定对 -p/-P 路径上的数组执行的操作，写回的方式和 -m w 相同(文件加锁、原子替换、
+--backup、-F 格式)，-M 多路径时每个路径使用各自的值(s: / j: 前缀)，--lines 时对每条
+满足条件的记录执行。路径不存在时按空数组创建，存在但不是数组时报错。
+
+	append      在末尾追加值(-s/-j/-f/-o 指定)
+	prepend     在开头插入值
+	insert      在 --index 指定的位置插入值，负数从末尾计算，-1 表示末尾
+	remove      删除和值相等的所有元素，按规范化的 JSON 比较(1 和 1.0 相等)
+	remove-if   删除满足条件的元素，值是 gjson 的查询条件(也就是 #(...) 括号中的部分)
+	dedupe      去掉重复的元素，保留第一次出现的
+	sort        按值指定的子路径排序(值为空时按元素本身)，--desc 降序，顺序规则和
+	            -m q 相同: null < false < true < 数字 < 字符串 < 数组 < 对象
+
+gobolt json -m a --op append -k file -i demo.json -j '{"name": "s3"}' -P -- servers
+gobolt json -m a --op insert --index 0 -k file -i demo.json -s "first" -P -- key1 list
+gobolt json -m a --op remove-if -k file -i demo.json -s 'port>=8000' -P -- servers
+gobolt json -m a --op sort --desc -k file -i demo.json -s "meta.priority" -P -- servers
+gobolt json -m a --op dedupe -k file -i demo.json -M -- tags "s:" ":key1.list" "s:"
+gobolt json -m a --op remove -k file -i demo.json -M -- tags "s:old" nums "j:3"
+
+没有改动的元素保持原来的写法，append 在确认目标是数组之后使用 sjson 的 -1 下标，
+不会在对象上误写入名为 -1 的键。
+
+19. JSON5 / 带注释的 JSON (--json5)
+
+--json5(等同于 --in-format json5，.json5 和 .jsonc 文件会自动识别)按 JSON5 读取输入:
+	// 行注释 和 /* 块注释 */
+	对象和数组的结尾逗号
+	单引号字符串，没有引号的键(字母、数字、_、$)
+	十六进制数字 0x1F，.5 / 5. 这样的小数，+1
+所有读取模式(r / q / diff / hash / merge 等)看到的都是转换后的标准 JSON。
+
+-m w / d / a 写回 JSON5 时直接在原文上修改: 只替换改动的值所在的位置，其它位置的注释、
+空白、引号和键的顺序都保持不变，-F 不起作用。新增的键和元素以紧凑的 JSON 写法插入，
+每个成员一行的对象和数组中新的成员单独一行，缩进和其它成员相同。
+
+gobolt json -m w --json5 -k file -i tsconfig.json -s es2022 -P -- compilerOptions target
+gobolt json -m d -k file -i settings.jsonc -P -- editor.fontSize
+
+注意:
+	1). Infinity 和 NaN 不能转换成 JSON，会报错
+	2). --out-format json 可以转换成标准的 JSON(注释会丢失)
+	3). 被删除或者替换的值内部的注释会一起被删除，删除单独一行的成员时同一行末尾的 // 注释也会删除
+	4). patch / b 等其它写入模式按标准 JSON 输出，不保留注释
+
+20. 加密字段 (--encrypt / --decrypt / -m rekey)
+
+密码等敏感的值可以加密后保存在 JSON 中，配置仓库中不会出现明文。密钥是 32 字节的随机数，
+以十六进制或者 base64 文本保存在 --key-file 指定的文件中，或者放在环境变量 GOBOLT_JSON_KEY 中:
+
+head -c 32 /dev/urandom | base64 > ~/.gobolt.key
+
+-m w --encrypt 把值(任意类型)加密后写入，-M 时每个值分别加密:
+
+gobolt json -m w --encrypt --key-file ~/.gobolt.key -k file -i dev.json -s 'p@ss' -P -- devices r1 password
+
+写入的是一个信封对象，data 是原来的值的 JSON 使用 AES-256-GCM 加密后的结果，kid 是密钥
+SHA-256 的前 4 个字节(十六进制)，用于发现用错了密钥:
+
+{"$encrypted":"v1","alg":"aes-256-gcm","kid":"1a2b3c4d","iv":"...","data":"..."}
+
+--decrypt 在读取时解密文档中所有的加密字段，r / q / diff / hash / merge 等读取模式都可以使用，
+-t sh 输出的和没有加密时一样:
+
+eval -- "$(gobolt json -m r --decrypt -t sh -k file -i dev.json -P -- devices r1)"
+
+-m rekey 用旧密钥解密整个文件中的加密字段，再用新密钥(--new-key-file 或者环境变量
+GOBOLT_JSON_NEW_KEY)重新加密，写回的方式和 -m w 相同(加锁、原子替换、--backup):
+
+gobolt json -m rekey --key-file old.key --new-key-file new.key -k file -i dev.json
+
+注意:
+	1). 没有密钥时退出码为 65，密钥格式错误时为 64，解密失败(密钥错误、内容被修改)时为 66
+	2). 加密字段可以整体移动到其它路径，密文没有和路径绑定
+	3). 不使用 --decrypt 时加密字段按普通的对象读取
+
+21. 在 Go 代码中使用
+
+qqjson.Document 提供和命令行相同的读写规则(路径格式、: 强制创建对象、-M 的 s:/j: 值、
+类型码、-t sh / -t shtree / -F 的输出)，命令行的各个模式(r / w / d / a / b / q 等)都通过它读写:
+
+doc, err := qqjson.NewDocument(data)     // 或者 qqjson.ParseDocument(data, qqjson.DataFormatYAML)
+err = doc.Set(qqjson.JoinPath("ke.y1", "key2"), 22)
+err = doc.SetMulti("key1.:3.name", "s:r1", "key1.:3.ok", "j:true")
+err = doc.Delete("key1.old")
+v, err := doc.Get("key1")                // v.Type 是类型码，v.Bash() 是 -t sh 的输出
+out := doc.Format(qqjson.JSONFormatMul)
 		`,
 
 		// 如果子命令还想嵌套子命令可以下面这么干
@@ -373,6 +782,10 @@ printf "%s" "$str" | ./gobolt json -m e -k stdin
 			//	         1.876 可以直接写入浮点值
 			// 最后写入的是数字0而不是字符串0
 
+			if opts.JSON5 && opts.InFormat == "" {
+				opts.InFormat = DataFormatJSON5
+			}
+
 			// 解析剩下来的参数
 			if opts.UseArgPath {
 				opts.ArgPath = args
@@ -405,40 +818,75 @@ printf "%s" "$str" | ./gobolt json -m e -k stdin
 
 			// 处理Path
 
+			if opts.Lines {
+				// 按行输出的时候默认每条记录一行
+				if !cmd.Flags().Changed("jsonformat") {
+					opts.JSONFormat = JSONFormatOne
+				}
+				return opts.runLines()
+			}
+
 			switch opts.Mode {
 			case "r":
 				return opts.readValueFromJSON()
 			case "w":
-				return opts.modifyJSON(opts.Input, func(jsonData []byte, path string, val any) ([]byte, error) {
-					return sjson.SetBytes(jsonData, path, val)
-				})
+				if opts.Encrypt {
+					key, err := loadSecretKey(opts.KeyFile, KeyEnv)
+					if err != nil {
+						return err
+					}
+					return opts.modifyJSON(opts.Input, encryptOperation(key, setValue))
+				}
+				return opts.modifyJSON(opts.Input, setValue)
 			case "d":
-				return opts.modifyJSON(nil, func(jsonData []byte, path string, _ any) ([]byte, error) {
-					return sjson.DeleteBytes(jsonData, path)
-				})
+				return opts.modifyJSON(nil, deleteValue)
+			case "a":
+				operation, err := opts.arrayOperation()
+				if err != nil {
+					return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage, "无效的 --op", err)
+				}
+				return opts.modifyJSON(opts.Input, operation)
 			case "s":
 				return opts.strToJsonStr()
 			case "e":
 				return opts.strToEscapeStr()
+			case "b":
+				return opts.runBatch()
+			case "validate":
+				return opts.validateJSON()
+			case "diff":
+				return opts.diffJSONDocuments()
+			case "patch":
+				return opts.patchJSON()
+			case "q":
+				return opts.queryJSON()
+			case "inflate":
+				return opts.inflateJSON()
+			case "merge":
+				return opts.mergeJSON()
+			case "rekey":
+				return opts.rekeyJSON()
+			case "hash":
+				return opts.hashJSON()
 			case "v":
 				return opts.printVer()
 			case "t":
 				return opts.printTypeCode()
 			default:
-				return fmt.Errorf("未知模式: %q，请使用 r / w / d", opts.Mode)
+				return fmt.Errorf("未知模式: %q，请使用 r / w / d / a / b / validate / diff / patch / q / inflate / merge / hash / rekey", opts.Mode)
 			}
 		},
 	}
 
 	// flag 定义
 	// :TODO: 是否需要做参数互斥检查？
-	cmd.Flags().StringVarP(&opts.Mode, "mode", "m", "", "r / w / d / s / e / v / t 操作模式")
+	cmd.Flags().StringVarP(&opts.Mode, "mode", "m", "", "r / w / d / a / s / e / v / t / b / validate / diff / patch / q / inflate / merge / hash / rekey 操作模式")
 	cmd.Flags().StringVarP(&opts.Path, "path", "p", "", "gjson / sjson 原始路径，保留原始格式，但是并不建议使用，原因见范例")
 	cmd.Flags().BoolVarP(&opts.UseArgPath, "argpath", "P", false, "从命令行中读取路径（需置于最后，空格分隔，强烈建议都用这种格式）")
 	cmd.Flags().BoolVarP(&opts.UseMultiPath, "multipath", "M", false, "从命令行中读取多个合法的sjson路径（需置于最后，空格分隔）")
 	cmd.Flags().StringVarP(&opts.Kind, "kind", "k", "", "json来源类别（默认 stdin / file / str）")
 	cmd.Flags().StringVarP(&opts.InArg, "inarg", "i", "", "json来源的值")
-	cmd.Flags().StringVarP(&opts.Format, "format", "t", "txt", "输出格式：txt/sh/type")
+	cmd.Flags().StringVarP(&opts.Format, "format", "t", "txt", "输出格式：txt/sh/shtree/type")
 	cmd.Flags().StringVarP(&opts.StrInput, "strinput", "s", "", "写入的字符串值")
 	cmd.Flags().StringVarP(&opts.JSONInput, "jsoninput", "j", "", "写入的 JSON 字符串")
 	cmd.Flags().StringVarP(&opts.TrieSeparator, "trieseparator", "x", DefaultSep, "trie转换使用的分隔符")
@@ -446,9 +894,33 @@ printf "%s" "$str" | ./gobolt json -m e -k stdin
 	// 并且文件中只能放JSON格式数据
 	cmd.Flags().StringVarP(&opts.FileInput, "fileinput", "f", "", "写入的 JSON 文件")
 	cmd.Flags().StringVarP(&opts.RawFileInput, "rawfileinput", "o", "", "写入的 原始字符串 文件")
+	cmd.Flags().StringVar(&opts.ScriptFile, "script", "-", "批处理模式的脚本文件（- 表示标准输入）")
+	cmd.Flags().BoolVar(&opts.Backup, "backup", false, "写回文件前把旧内容保存到 <文件名>.bak")
+	cmd.Flags().StringVar(&opts.SchemaFile, "schema", "", "validate 模式使用的 JSON Schema 文件")
+	cmd.Flags().StringVar(&opts.OtherFile, "other", "", "diff 模式中和输入比较的另一个 JSON 文件")
+	cmd.Flags().StringVar(&opts.PatchFile, "patch", "-", "patch 模式的补丁文件（- 表示标准输入）")
+	cmd.Flags().Var(&opts.InFormat, "in-format", "输入的格式(json|yaml|toml|ini|json5)，默认按文件扩展名判断")
+	cmd.Flags().BoolVar(&opts.Encrypt, "encrypt", false, "w 模式加密写入的值(AES-256-GCM)")
+	cmd.Flags().BoolVar(&opts.Decrypt, "decrypt", false, "读取时解密所有的加密字段")
+	cmd.Flags().StringVar(&opts.KeyFile, "key-file", "", "加密使用的密钥文件，默认读取环境变量 "+KeyEnv)
+	cmd.Flags().StringVar(&opts.NewKeyFile, "new-key-file", "", "rekey 模式的新密钥文件，默认读取环境变量 "+NewKeyEnv)
+	cmd.Flags().BoolVar(&opts.JSON5, "json5", false, "按 JSON5 读取输入（注释、结尾逗号、单引号等），写回时保留注释和键的顺序")
+	cmd.Flags().BoolVar(&opts.Lines, "lines", false, "JSON Lines / NDJSON 模式，每一行是一个独立的文档，流式处理")
+	cmd.Flags().StringArrayVar(&opts.Filters, "filter", nil, "JSON Lines 模式中保留记录的 gjson 查询条件（可以重复，需要同时满足）")
+	cmd.Flags().StringVarP(&opts.Query, "query", "q", "", "q 模式的 jq 查询表达式")
+	cmd.Flags().StringVar(&opts.VarPrefix, "var-prefix", "J", "-t shtree 生成的变量名前缀")
+	cmd.Flags().StringVar(&opts.FlatFormat, "flat", FlatFormatTrie, "inflate 模式输入的扁平格式(trie|props)")
+	cmd.Flags().StringArrayVar(&opts.MergeFiles, "with", nil, "merge 模式按顺序合并到输入上的文件（可以重复）")
+	cmd.Flags().StringVar(&opts.MergeStrategy, "strategy", MergeDeep, "merge 模式的默认策略(replace|deep|concat|union[:key]|error)")
+	cmd.Flags().StringArrayVar(&opts.MergeRules, "rule", nil, "merge 模式中指定路径的策略，格式为 path=strategy（可以重复）")
+	cmd.Flags().BoolVar(&opts.Provenance, "provenance", false, "merge 模式输出每个叶子来自哪个文件")
+	cmd.Flags().StringVar(&opts.ArrayOp, "op", "", "a 模式的数组操作(append|prepend|insert|remove|remove-if|dedupe|sort)")
+	cmd.Flags().IntVar(&opts.ArrayIndex, "index", -1, "a 模式 insert 操作的下标（负数从末尾计算，-1 表示末尾）")
+	cmd.Flags().BoolVar(&opts.Descending, "desc", false, "a 模式 sort 操作按降序排序")
+	cmd.Flags().Var(&opts.OutFormat, "out-format", "写回的格式(json|yaml|toml|ini|json5)，默认和输入格式相同")
 	// 输出的JSON文件的格式 (一行/多行美化打印)
 	opts.JSONFormat = JSONFormatMul
-	cmd.Flags().VarP(&opts.JSONFormat, "jsonformat", "F", "输出的 JSON 的格式(mul|one|raw|human|trie)，代表多行/一行/原始格式/人类可读/bash字典树输出")
+	cmd.Flags().VarP(&opts.JSONFormat, "jsonformat", "F", "输出的 JSON 的格式(mul|one|raw|human|trie|canonical)，代表多行/一行/原始格式/人类可读/bash字典树/RFC 8785 规范化输出")
 
 	cmd.MarkFlagRequired("mode")
 
@@ -505,67 +977,90 @@ func (opts *CLIOptions) strToJsonStr() error {
 }
 
 func (opts *CLIOptions) readInput() ([]byte, error) {
-	var reader io.Reader
+	reader, err := opts.openInput()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
 
+	raw, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("读取失败: %w", err)
+	}
+	return raw, nil
+}
+
+// 按 -k 打开输入，调用者负责关闭
+func (opts *CLIOptions) openInput() (io.ReadCloser, error) {
 	switch opts.Kind {
 	case "file":
 		f, err := os.Open(opts.InArg)
 		if err != nil {
 			return nil, fmt.Errorf("无法打开文件: %w", err)
 		}
-		defer f.Close()
-		reader = f
+		return f, nil
 	case "str":
-		reader = strings.NewReader(opts.InArg)
+		return io.NopCloser(strings.NewReader(opts.InArg)), nil
 	default:
-		reader = os.Stdin
+		return io.NopCloser(os.Stdin), nil
 	}
+}
 
-	raw, err := io.ReadAll(reader)
+func (opts *CLIOptions) readValueFromJSON() error {
+	formatter, err := opts.formatter()
 	if err != nil {
-		return nil, fmt.Errorf("读取失败: %w", err)
+		return err
 	}
-	return raw, nil
-}
 
-func (opts *CLIOptions) readValueFromJSON() error {
-	formatter, ok := formatters[opts.Format]
-	if !ok {
-		return fmt.Errorf("不支持的格式: %s", opts.Format)
+	raw, err := opts.readDocument()
+	if err != nil {
+		return err
 	}
 
-	var err error
+	return opts.formatPath(formatter, raw, opts.Path)
+}
 
-	raw, err := opts.readInput()
+// 读取 path 对应的值并用 formatter 输出，path 为空时输出整个 JSON
+func (opts *CLIOptions) formatPath(formatter OutputFormatter, raw []byte, path string) error {
+	value, err := opts.document(raw).Get(path)
 	if err != nil {
 		return err
 	}
 
+	errFormat := formatter.Format(value.res, opts.JSONFormat, opts.TrieSeparator)
+	if errFormat.Code == errorutil.CodeSuccess &&
+		errFormat.CmdExitCode == errorutil.CodeSuccess {
+		return nil
+	} else {
+		return errFormat
+	}
+}
+
+// 校验 JSON 并取出 path 对应的值，path 为空时返回整个 JSON
+func lookupPath(raw []byte, path string) (gjson.Result, error) {
 	// 校验 JSON 格式
 	if !gjson.ValidBytes(raw) {
-		err = fmt.Errorf("输入内容不是有效的 JSON")
-		return err
+		return gjson.Result{}, fmt.Errorf("输入内容不是有效的 JSON")
 	}
 
-	var result gjson.Result
-	if strings.TrimSpace(opts.Path) == "" {
+	if strings.TrimSpace(path) == "" {
 		// 解析整个JOSN，作为顶级映射返回
-		result = gjson.ParseBytes(raw)
-	} else {
-		result = gjson.GetBytes(raw, opts.Path)
-		if !result.Exists() {
-			err = fmt.Errorf("字段 %q 不存在", opts.Path)
-			return err
-		}
+		return gjson.ParseBytes(raw), nil
 	}
 
-	errFormat := formatter.Format(result, opts.JSONFormat, opts.TrieSeparator)
-	if errFormat.Code == errorutil.CodeSuccess &&
-		errFormat.CmdExitCode == errorutil.CodeSuccess {
-		return nil
-	} else {
-		return errFormat
+	result := gjson.GetBytes(raw, path)
+	if !result.Exists() {
+		return result, fmt.Errorf("字段 %q 不存在", path)
 	}
+	return result, nil
+}
+
+func setValue(jsonData []byte, path string, val any) ([]byte, error) {
+	return sjson.SetBytes(jsonData, path, val)
+}
+
+func deleteValue(jsonData []byte, path string, _ any) ([]byte, error) {
+	return sjson.DeleteBytes(jsonData, path)
 }
 
 func parseTypedValue(raw string) (any, error) {
@@ -598,70 +1093,149 @@ func (opts *CLIOptions) modifyJSON(
 	value any,
 	operation func([]byte, string, any) ([]byte, error)) error {
 
-	var jsonData []byte
+	unlock, err := opts.lockTarget()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	jsonData, err := opts.loadTarget()
+	if err != nil {
+		return err
+	}
+
+	// JSON5 写回 JSON5 的时候直接在原文上修改，没有改动的部分(包括注释)保持不变
+	if opts.inFormat() == DataFormatJSON5 && opts.outFormat() == DataFormatJSON5 &&
+		len(bytes.TrimSpace(opts.original)) > 0 {
+		jsonData, operation = opts.original, preserveJSON5(operation)
+		opts.keepText = true
+	}
+
+	jsonData, err = opts.applyOperation(jsonData, value, operation)
+	if err != nil {
+		return err
+	}
+
+	return opts.storeTarget(jsonData)
+}
+
+// 应用传入的操作函数（设置或删除），-M 的时候对每一对 路径+值 依次应用
+func (opts *CLIOptions) applyOperation(
+	jsonData []byte,
+	value any,
+	operation func([]byte, string, any) ([]byte, error)) ([]byte, error) {
+
+	doc := opts.document(jsonData)
 	var err error
+	if !opts.UseMultiPath || len(opts.MultiPaths) == 0 {
+		err = doc.apply(opts.Path, value, operation)
+	} else {
+		err = doc.applyPairs(opts.MultiPaths, operation)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.Bytes(), nil
+}
+
+// 命令行的各个模式通过 Document 读写，和库接口使用相同的规则
+// 这里不校验 data，JSON5 原文修改时传入的是 JSON5 文本
+func (opts *CLIOptions) document(data []byte) *Document {
+	return &Document{data: data, TrieSeparator: opts.TrieSeparator}
+}
+
+// pairs 是 路径, 带 s: / j: 前缀的值, 路径, 值 ... 按顺序依次应用
+func applyPairs(
+	jsonData []byte,
+	pairs []string,
+	operation func([]byte, string, any) ([]byte, error)) ([]byte, error) {
+
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("多路径模式下参数必须成对出现: 路径 + 值")
+	}
+
+	updated := jsonData
+
+	for i := 0; i < len(pairs); i += 2 {
+		path := pairs[i]
+		rawValue := pairs[i+1]
+
+		value, err := parseTypedValue(rawValue)
+		if err != nil {
+			return nil, fmt.Errorf("解析值 %q 时出错: %w", rawValue, err)
+		}
+
+		updated, err = operation(updated, path, value)
+		if err != nil {
+			return nil, fmt.Errorf("处理路径 %q 时出错: %w", path, err)
+		}
+	}
 
+	return updated, nil
+}
+
+// 文件的 读取-修改-写回 期间持有建议锁，防止并发的 gobolt 互相覆盖
+// 非文件的情况返回空函数
+func (opts *CLIOptions) lockTarget() (func(), error) {
+	if opts.Kind != "file" {
+		return func() {}, nil
+	}
+	return lockPath(opts.InArg)
+}
+
+// 读取需要修改的 JSON，文件不存在的时候先创建一个空文件
+func (opts *CLIOptions) loadTarget() ([]byte, error) {
+	var data []byte
 	switch opts.Kind {
 	case "file":
 		if _, err := os.Stat(opts.InArg); os.IsNotExist(err) {
 			f, err := os.Create(opts.InArg)
 			if err != nil {
-				return fmt.Errorf("无法创建文件: %w", err)
+				return nil, fmt.Errorf("无法创建文件: %w", err)
 			}
-			defer f.Close()
+			f.Close()
+			opts.created = true
 		}
-		jsonData, err = os.ReadFile(opts.InArg)
-		if err != nil {
-			return err
+		var err error
+		if data, err = os.ReadFile(opts.InArg); err != nil {
+			return nil, err
 		}
 	case "str":
-		jsonData = []byte(opts.InArg)
+		data = []byte(opts.InArg)
 	// 没有任何参数的情况 或者 stdin 的情况
 	default:
-		jsonData, err = io.ReadAll(os.Stdin)
-		if err != nil {
-			return err
+		var err error
+		if data, err = io.ReadAll(os.Stdin); err != nil {
+			return nil, err
 		}
 	}
+	opts.original = data
+	return convertToJSON(data, opts.inFormat())
+}
 
-	// 应用传入的操作函数（设置或删除）
-	if opts.UseMultiPath && len(opts.MultiPaths) > 0 {
-		if len(opts.MultiPaths)%2 != 0 {
-			return fmt.Errorf("多路径模式下参数必须成对出现: 路径 + 值")
-		}
-
-		updated := jsonData
-
-		for i := 0; i < len(opts.MultiPaths); i += 2 {
-			path := opts.MultiPaths[i]
-			rawValue := opts.MultiPaths[i+1]
-
-			value, err := parseTypedValue(rawValue)
-			if err != nil {
-				return fmt.Errorf("解析值 %q 时出错: %w", rawValue, err)
-			}
-
-			updated, err = operation(updated, path, value)
-			if err != nil {
-				return fmt.Errorf("处理路径 %q 时出错: %w", path, err)
-			}
-		}
-
-		jsonData = updated
-	} else {
-		updatedJSON, err := operation(jsonData, opts.Path, value)
+// 格式化后写回文件，字符串和标准输入的情况输出到标准输出
+// 输出格式不是 JSON 的时候按 --out-format 转换，-F 不起作用
+func (opts *CLIOptions) storeTarget(jsonData []byte) error {
+	formatted := formatJSON(jsonData, opts.JSONFormat, opts.TrieSeparator)
+	if opts.keepText {
+		formatted = jsonData
+	} else if format := opts.outFormat(); format != DataFormatJSON && format != DataFormatJSON5 {
+		converted, err := convertFromJSON(jsonData, format, collectTimes(opts.original, opts.inFormat()))
 		if err != nil {
-			return err
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "无法转换输出格式", err)
 		}
-		jsonData = updatedJSON
+		formatted = converted
 	}
 
-	formatted := formatJSON(jsonData, opts.JSONFormat, opts.TrieSeparator)
-
 	if opts.Kind == "file" {
-		return os.WriteFile(opts.InArg, formatted, 0644)
+		// 新建的文件没有旧内容，不生成空的备份
+		if opts.Backup && !opts.created {
+			if err := writeFileAtomic(opts.InArg+backupSuffix, opts.original, 0644); err != nil {
+				return fmt.Errorf("备份文件失败: %w", err)
+			}
+		}
+		return writeFileAtomic(opts.InArg, formatted, 0644)
 	}
-	// 字符串的情况和 str 的情况都输出到标准输出
-	_, err = os.Stdout.Write(formatted)
+	_, err := os.Stdout.Write(formatted)
 	return err
 }
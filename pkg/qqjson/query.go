@@ -0,0 +1,56 @@
+package qqjson
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"common_tool/pkg/errorutil"
+)
+
+// 用 --query 指定的 jq 表达式查询输入，-p/-P 指定时只查询对应的子树
+// 结果是一个流，不管有几个结果都和批处理中的读取一样，每个结果后面输出一个换行，
+// -t type 打印类型码，成功时退出码总是 0(结果的个数不影响退出码)
+func (opts *CLIOptions) queryJSON() error {
+	formatter, err := opts.formatter()
+	if err != nil {
+		return err
+	}
+	if opts.Query == "" {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage, "缺少 --query 参数", fmt.Errorf("q 模式需要指定查询表达式"))
+	}
+
+	node, err := parseQuery(opts.Query)
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage, "查询表达式语法错误", err)
+	}
+
+	raw, err := opts.readDocument()
+	if err != nil {
+		return err
+	}
+	value, err := opts.document(raw).Get(opts.Path)
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, err.Error(), err)
+	}
+
+	var doc any
+	if err := json.Unmarshal([]byte(value.Raw), &doc); err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "输入内容不是有效的 JSON", err)
+	}
+
+	outputs, err := node.eval(nil, doc)
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "查询执行失败", err)
+	}
+
+	for _, out := range outputs {
+		data, err := marshalJSON(out)
+		if err != nil {
+			return errorutil.NewExitError(errorutil.CodeInternalErr, err)
+		}
+		if err := opts.batchRead(formatter, data, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,583 @@
+package qqjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSON Schema 的一个子集校验器（draft-07 / 2020-12 的常用关键字）
+// 支持:
+//   type enum const
+//   properties required additionalProperties patternProperties propertyNames
+//   minProperties maxProperties dependentRequired
+//   items prefixItems additionalItems contains minItems maxItems uniqueItems
+//   minLength maxLength pattern
+//   minimum maximum exclusiveMinimum exclusiveMaximum multipleOf
+//   allOf anyOf oneOf not if/then/else
+//   $ref（只支持文档内的 # 开头的 JSON Pointer，$defs/definitions 都可以引用）
+// format 等注解类关键字会被忽略
+
+// 防止 $ref 循环引用导致的无限递归
+const maxSchemaDepth = 256
+
+type SchemaViolation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+type schemaValidator struct {
+	root       any
+	violations []SchemaViolation
+	regexps    map[string]*regexp.Regexp
+}
+
+// 用 schema 校验 doc，返回所有违反的约束，basePointer 是 doc 在整个文档中的 JSON Pointer
+func validateSchema(schema, doc any, basePointer string) ([]SchemaViolation, error) {
+	v := &schemaValidator{root: schema, regexps: map[string]*regexp.Regexp{}}
+	if err := v.validate(schema, doc, basePointer, 0); err != nil {
+		return nil, err
+	}
+	return v.violations, nil
+}
+
+// ptr 是 JSON Pointer，根是空字符串 ""("/" 表示键为空字符串的属性)
+func (v *schemaValidator) addf(ptr string, format string, args ...any) {
+	v.violations = append(v.violations, SchemaViolation{Path: ptr, Message: fmt.Sprintf(format, args...)})
+}
+
+// 在独立的校验器里校验，用于 anyOf/oneOf/not/if 这类只关心是否通过的关键字
+func (v *schemaValidator) passes(schema, doc any, ptr string, depth int) (bool, error) {
+	sub := &schemaValidator{root: v.root, regexps: v.regexps}
+	if err := sub.validate(schema, doc, ptr, depth); err != nil {
+		return false, err
+	}
+	return len(sub.violations) == 0, nil
+}
+
+func (v *schemaValidator) validate(schema, doc any, ptr string, depth int) error {
+	if depth > maxSchemaDepth {
+		return fmt.Errorf("schema 嵌套过深，可能存在循环引用: %s", ptr)
+	}
+
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			v.addf(ptr, "schema 为 false，不允许任何值")
+		}
+		return nil
+	case map[string]any:
+		return v.validateObjectSchema(s, doc, ptr, depth)
+	default:
+		return fmt.Errorf("无效的 schema（必须是对象或者布尔值）: %v", schema)
+	}
+}
+
+func (v *schemaValidator) validateObjectSchema(s map[string]any, doc any, ptr string, depth int) error {
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := resolveSchemaRef(v.root, ref)
+		if err != nil {
+			return err
+		}
+		if err := v.validate(target, doc, ptr, depth+1); err != nil {
+			return err
+		}
+	}
+
+	if t, ok := s["type"]; ok {
+		v.checkType(t, doc, ptr)
+	}
+
+	if enum, ok := s["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, doc) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.addf(ptr, "值不在 enum 允许的范围内")
+		}
+	}
+
+	if c, ok := s["const"]; ok && !jsonEqual(c, doc) {
+		v.addf(ptr, "值必须等于 const %s", compactJSON(c))
+	}
+
+	switch val := doc.(type) {
+	case map[string]any:
+		if err := v.validateObject(s, val, ptr, depth); err != nil {
+			return err
+		}
+	case []any:
+		if err := v.validateArray(s, val, ptr, depth); err != nil {
+			return err
+		}
+	case string:
+		if err := v.validateString(s, val, ptr); err != nil {
+			return err
+		}
+	case float64:
+		v.validateNumber(s, val, ptr)
+	}
+
+	return v.validateCombinators(s, doc, ptr, depth)
+}
+
+func (v *schemaValidator) checkType(t any, doc any, ptr string) {
+	actual := schemaTypeOf(doc)
+	var allowed []string
+	switch tv := t.(type) {
+	case string:
+		allowed = []string{tv}
+	case []any:
+		for _, x := range tv {
+			if xs, ok := x.(string); ok {
+				allowed = append(allowed, xs)
+			}
+		}
+	}
+
+	for _, a := range allowed {
+		if a == actual || (a == "number" && actual == "integer") {
+			return
+		}
+	}
+	v.addf(ptr, "类型错误: 期望 %s，实际是 %s", strings.Join(allowed, "|"), actual)
+}
+
+func (v *schemaValidator) validateObject(s map[string]any, obj map[string]any, ptr string, depth int) error {
+	if req, ok := s["required"].([]any); ok {
+		for _, r := range req {
+			name, _ := r.(string)
+			if _, exists := obj[name]; !exists {
+				v.addf(ptr, "缺少必需的属性 %q", name)
+			}
+		}
+	}
+
+	if n, ok := schemaNumber(s, "minProperties"); ok && float64(len(obj)) < n {
+		v.addf(ptr, "属性个数 %d 少于 minProperties %v", len(obj), n)
+	}
+	if n, ok := schemaNumber(s, "maxProperties"); ok && float64(len(obj)) > n {
+		v.addf(ptr, "属性个数 %d 多于 maxProperties %v", len(obj), n)
+	}
+
+	if deps, ok := s["dependentRequired"].(map[string]any); ok {
+		for _, name := range sortedKeys(deps) {
+			if _, exists := obj[name]; !exists {
+				continue
+			}
+			list, _ := deps[name].([]any)
+			for _, d := range list {
+				dn, _ := d.(string)
+				if _, exists := obj[dn]; !exists {
+					v.addf(ptr, "存在属性 %q 时必须同时存在 %q", name, dn)
+				}
+			}
+		}
+	}
+
+	props, _ := s["properties"].(map[string]any)
+	patterns, _ := s["patternProperties"].(map[string]any)
+	additional, hasAdditional := s["additionalProperties"]
+	propertyNames, hasPropertyNames := s["propertyNames"]
+
+	for _, key := range sortedKeys(obj) {
+		childPtr := ptr + "/" + escapeJSONPointer(key)
+		value := obj[key]
+
+		if hasPropertyNames {
+			if err := v.validate(propertyNames, key, childPtr, depth+1); err != nil {
+				return err
+			}
+		}
+
+		matched := false
+		if sub, ok := props[key]; ok {
+			matched = true
+			if err := v.validate(sub, value, childPtr, depth+1); err != nil {
+				return err
+			}
+		}
+
+		for _, pattern := range sortedKeys(patterns) {
+			re, err := v.regexp(pattern)
+			if err != nil {
+				return err
+			}
+			if re.MatchString(key) {
+				matched = true
+				if err := v.validate(patterns[pattern], value, childPtr, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+
+		if !matched && hasAdditional {
+			if b, ok := additional.(bool); ok && !b {
+				v.addf(childPtr, "不允许额外的属性 %q", key)
+			} else if err := v.validate(additional, value, childPtr, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateArray(s map[string]any, arr []any, ptr string, depth int) error {
+	if n, ok := schemaNumber(s, "minItems"); ok && float64(len(arr)) < n {
+		v.addf(ptr, "元素个数 %d 少于 minItems %v", len(arr), n)
+	}
+	if n, ok := schemaNumber(s, "maxItems"); ok && float64(len(arr)) > n {
+		v.addf(ptr, "元素个数 %d 多于 maxItems %v", len(arr), n)
+	}
+
+	if unique, _ := s["uniqueItems"].(bool); unique {
+		for i := 0; i < len(arr); i++ {
+			for j := i + 1; j < len(arr); j++ {
+				if jsonEqual(arr[i], arr[j]) {
+					v.addf(ptr, "元素 %d 和 %d 重复，违反 uniqueItems", i, j)
+				}
+			}
+		}
+	}
+
+	// 位置相关的元素: 2020-12 的 prefixItems 或者 draft-07 的数组形式 items
+	var tuple []any
+	var rest any
+	hasRest := false
+	if p, ok := s["prefixItems"].([]any); ok {
+		tuple = p
+		rest, hasRest = s["items"]
+	} else if p, ok := s["items"].([]any); ok {
+		tuple = p
+		rest, hasRest = s["additionalItems"]
+	} else {
+		rest, hasRest = s["items"]
+	}
+
+	for i, item := range arr {
+		childPtr := ptr + "/" + strconv.Itoa(i)
+		if i < len(tuple) {
+			if err := v.validate(tuple[i], item, childPtr, depth+1); err != nil {
+				return err
+			}
+		} else if hasRest {
+			if b, ok := rest.(bool); ok && !b {
+				v.addf(childPtr, "不允许额外的数组元素")
+			} else if err := v.validate(rest, item, childPtr, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	if contains, ok := s["contains"]; ok {
+		count := 0
+		for i, item := range arr {
+			pass, err := v.passes(contains, item, ptr+"/"+strconv.Itoa(i), depth+1)
+			if err != nil {
+				return err
+			}
+			if pass {
+				count++
+			}
+		}
+
+		minContains := 1.0
+		if n, ok := schemaNumber(s, "minContains"); ok {
+			minContains = n
+		}
+		if float64(count) < minContains {
+			v.addf(ptr, "满足 contains 的元素个数 %d 少于 %v", count, minContains)
+		}
+		if n, ok := schemaNumber(s, "maxContains"); ok && float64(count) > n {
+			v.addf(ptr, "满足 contains 的元素个数 %d 多于 maxContains %v", count, n)
+		}
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateString(s map[string]any, str string, ptr string) error {
+	length := utf8.RuneCountInString(str)
+	if n, ok := schemaNumber(s, "minLength"); ok && float64(length) < n {
+		v.addf(ptr, "字符串长度 %d 小于 minLength %v", length, n)
+	}
+	if n, ok := schemaNumber(s, "maxLength"); ok && float64(length) > n {
+		v.addf(ptr, "字符串长度 %d 大于 maxLength %v", length, n)
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		re, err := v.regexp(pattern)
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(str) {
+			v.addf(ptr, "字符串不匹配 pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateNumber(s map[string]any, num float64, ptr string) {
+	if n, ok := schemaNumber(s, "minimum"); ok {
+		// draft-04 中 exclusiveMinimum 是布尔值
+		if excl, _ := s["exclusiveMinimum"].(bool); excl && num <= n {
+			v.addf(ptr, "数值 %v 必须大于 %v", num, n)
+		} else if num < n {
+			v.addf(ptr, "数值 %v 小于 minimum %v", num, n)
+		}
+	}
+	if n, ok := schemaNumber(s, "maximum"); ok {
+		if excl, _ := s["exclusiveMaximum"].(bool); excl && num >= n {
+			v.addf(ptr, "数值 %v 必须小于 %v", num, n)
+		} else if num > n {
+			v.addf(ptr, "数值 %v 大于 maximum %v", num, n)
+		}
+	}
+	if n, ok := schemaNumber(s, "exclusiveMinimum"); ok && num <= n {
+		v.addf(ptr, "数值 %v 必须大于 exclusiveMinimum %v", num, n)
+	}
+	if n, ok := schemaNumber(s, "exclusiveMaximum"); ok && num >= n {
+		v.addf(ptr, "数值 %v 必须小于 exclusiveMaximum %v", num, n)
+	}
+	if n, ok := schemaNumber(s, "multipleOf"); ok && n > 0 {
+		q := num / n
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			v.addf(ptr, "数值 %v 不是 %v 的整数倍", num, n)
+		}
+	}
+}
+
+func (v *schemaValidator) validateCombinators(s map[string]any, doc any, ptr string, depth int) error {
+	if all, ok := s["allOf"].([]any); ok {
+		for _, sub := range all {
+			if err := v.validate(sub, doc, ptr, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	if anyOf, ok := s["anyOf"].([]any); ok {
+		matched := false
+		for _, sub := range anyOf {
+			pass, err := v.passes(sub, doc, ptr, depth+1)
+			if err != nil {
+				return err
+			}
+			if pass {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.addf(ptr, "不满足 anyOf 中的任何一个 schema")
+		}
+	}
+
+	if oneOf, ok := s["oneOf"].([]any); ok {
+		count := 0
+		for _, sub := range oneOf {
+			pass, err := v.passes(sub, doc, ptr, depth+1)
+			if err != nil {
+				return err
+			}
+			if pass {
+				count++
+			}
+		}
+		if count != 1 {
+			v.addf(ptr, "必须恰好满足 oneOf 中的一个 schema，实际满足 %d 个", count)
+		}
+	}
+
+	if not, ok := s["not"]; ok {
+		pass, err := v.passes(not, doc, ptr, depth+1)
+		if err != nil {
+			return err
+		}
+		if pass {
+			v.addf(ptr, "不能满足 not 中的 schema")
+		}
+	}
+
+	if cond, ok := s["if"]; ok {
+		pass, err := v.passes(cond, doc, ptr, depth+1)
+		if err != nil {
+			return err
+		}
+		branch, hasBranch := s["else"]
+		if pass {
+			branch, hasBranch = s["then"]
+		}
+		if hasBranch {
+			if err := v.validate(branch, doc, ptr, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *schemaValidator) regexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := v.regexps[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("schema 中的正则表达式无效 %q: %w", pattern, err)
+	}
+	v.regexps[pattern] = re
+	return re, nil
+}
+
+// 只支持文档内部的引用，比如 #/$defs/port
+func resolveSchemaRef(root any, ref string) (any, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("不支持外部 $ref: %s", ref)
+	}
+
+	cur := root
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer == "" {
+		return cur, nil
+	}
+
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = unescapeJSONPointer(token)
+		switch node := cur.(type) {
+		case map[string]any:
+			next, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("$ref 指向的位置不存在: %s", ref)
+			}
+			cur = next
+		case []any:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, fmt.Errorf("$ref 指向的位置不存在: %s", ref)
+			}
+			cur = node[idx]
+		default:
+			return nil, fmt.Errorf("$ref 指向的位置不存在: %s", ref)
+		}
+	}
+	return cur, nil
+}
+
+func schemaTypeOf(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		if val == math.Trunc(val) && !math.IsInf(val, 0) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return "unknown"
+	}
+}
+
+func schemaNumber(s map[string]any, key string) (float64, bool) {
+	n, ok := s[key].(float64)
+	return n, ok
+}
+
+// JSON 语义上的相等，数字按数值比较(1 和 1.0 相等)，对象不区分键的顺序
+func jsonEqual(a, b any) bool {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			other, exists := bv[k]
+			if !exists || !jsonEqual(v, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if eq, ok := numbersEqual(a, b); ok {
+		return eq
+	}
+	return a == b
+}
+
+// a 和 b 都是数字(float64 或 json.Number)时按精确的数值比较，
+// json.Number 转换成有理数，大整数不会因为转换成 float64 而丢精度
+func numbersEqual(a, b any) (equal, isNumber bool) {
+	ra, okA := numberRat(a)
+	rb, okB := numberRat(b)
+	if !okA || !okB {
+		return false, false
+	}
+	return ra.Cmp(rb) == 0, true
+}
+
+func numberRat(v any) (*big.Rat, bool) {
+	switch n := v.(type) {
+	case float64:
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(n), true
+	case json.Number:
+		return new(big.Rat).SetString(n.String())
+	}
+	return nil, false
+}
+
+func compactJSON(v any) string {
+	data, err := marshalJSON(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+func escapeJSONPointer(s string) string {
+	s = strings.ReplaceAll(s, "~", "~0")
+	return strings.ReplaceAll(s, "/", "~1")
+}
+
+func unescapeJSONPointer(s string) string {
+	s = strings.ReplaceAll(s, "~1", "/")
+	return strings.ReplaceAll(s, "~0", "~")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
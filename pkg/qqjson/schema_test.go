@@ -0,0 +1,90 @@
+package qqjson
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func mustUnmarshal(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("无效的 JSON %q: %v", s, err)
+	}
+	return v
+}
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		doc    string
+		base   string
+		// 期望违反约束的路径，nil 表示校验通过
+		paths []string
+	}{
+		{"根的类型错误", `{"type":"object"}`, `[]`, "", []string{""}},
+		{"空键的属性", `{"properties":{"":{"type":"string"}}}`, `{"":1}`, "", []string{"/"}},
+		{"子树的根", `{"type":"string"}`, `1`, "/key1/key2", []string{"/key1/key2"}},
+		{"required", `{"required":["a","b"]}`, `{"a":1}`, "", []string{""}},
+		{"嵌套属性", `{"properties":{"a":{"properties":{"b~/":{"type":"integer"}}}}}`, `{"a":{"b~/":1.5}}`, "", []string{"/a/b~0~1"}},
+		{"additionalProperties", `{"properties":{"a":{}},"additionalProperties":false}`, `{"a":1,"x":2}`, "", []string{"/x"}},
+		{"integer 接受 1.0", `{"type":"integer"}`, `1.0`, "", nil},
+		{"enum 数值相等", `{"enum":[1,"a"]}`, `1.0`, "", nil},
+		{"enum 不匹配", `{"enum":[1,"a"]}`, `2`, "", []string{""}},
+		{"const 对象不区分键的顺序", `{"const":{"a":1,"b":[1,2]}}`, `{"b":[1.0,2],"a":1}`, "", nil},
+		{"const 数组顺序不同", `{"const":[1,2]}`, `[2,1]`, "", []string{""}},
+		{"uniqueItems", `{"uniqueItems":true}`, `[{"a":1},{"a":1.0}]`, "", []string{""}},
+		{"minimum 和 maxLength", `{"properties":{"n":{"minimum":3},"s":{"maxLength":2}}}`, `{"n":2,"s":"abc"}`, "", []string{"/n", "/s"}},
+		{"pattern", `{"pattern":"^[a-z]+$"}`, `"ab1"`, "", []string{""}},
+		{"items 和 prefixItems", `{"prefixItems":[{"type":"string"}],"items":{"type":"number"}}`, `["a",1,"x"]`, "", []string{"/2"}},
+		{"oneOf 满足两个", `{"oneOf":[{"type":"number"},{"minimum":0}]}`, `1`, "", []string{""}},
+		{"if/then", `{"if":{"properties":{"t":{"const":"a"}}},"then":{"required":["x"]}}`, `{"t":"a"}`, "", []string{""}},
+		{"$ref", `{"$defs":{"port":{"type":"integer","maximum":65535}},"properties":{"p":{"$ref":"#/$defs/port"}}}`, `{"p":70000}`, "", []string{"/p"}},
+		{"schema 为 false", `{"properties":{"a":false}}`, `{"a":null}`, "", []string{"/a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := validateSchema(mustUnmarshal(t, tt.schema), mustUnmarshal(t, tt.doc), tt.base)
+			if err != nil {
+				t.Fatalf("校验出错: %v", err)
+			}
+			var paths []string
+			for _, v := range violations {
+				paths = append(paths, v.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.paths) {
+				t.Errorf("违反约束的路径 = %q，期望 %q\n%v", paths, tt.paths, violations)
+			}
+		})
+	}
+}
+
+func TestValidateSchemaRefLoop(t *testing.T) {
+	schema := mustUnmarshal(t, `{"$ref":"#"}`)
+	if _, err := validateSchema(schema, 1.0, ""); err == nil {
+		t.Errorf("循环引用应该返回错误")
+	}
+}
+
+func TestJSONEqualNumbers(t *testing.T) {
+	tests := []struct {
+		a, b any
+		want bool
+	}{
+		{1.0, json.Number("1"), true},
+		{json.Number("1.0"), json.Number("1e0"), true},
+		{json.Number("12345678901234567890"), json.Number("12345678901234567891"), false},
+		{json.Number("12345678901234567890"), json.Number("12345678901234567890.0"), true},
+		{json.Number("1"), "1", false},
+		{nil, nil, true},
+		{false, nil, false},
+	}
+	for _, tt := range tests {
+		if got := jsonEqual(tt.a, tt.b); got != tt.want {
+			t.Errorf("jsonEqual(%#v, %#v) = %v，期望 %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
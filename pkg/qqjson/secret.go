@@ -0,0 +1,257 @@
+package qqjson
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"common_tool/pkg/errorutil"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 加密字段，值被替换成一个信封对象:
+// {"$encrypted":"v1","alg":"aes-256-gcm","kid":"1a2b3c4d","iv":"...","data":"..."}
+// data 是原来的值的 JSON 加密后的结果，所以数字、对象等类型在解密后保持不变
+// kid 是密钥 SHA-256 的前 4 个字节，用于在解密前发现用错了密钥
+
+const (
+	encryptedMarker  = "$encrypted"
+	encryptedVersion = "v1"
+	encryptedAlg     = "aes-256-gcm"
+
+	// 没有 --key-file / --new-key-file 时从这两个环境变量读取密钥
+	KeyEnv    = "GOBOLT_JSON_KEY"
+	NewKeyEnv = "GOBOLT_JSON_NEW_KEY"
+)
+
+type secretEnvelope struct {
+	Encrypted string `json:"$encrypted"`
+	Alg       string `json:"alg"`
+	Kid       string `json:"kid"`
+	IV        string `json:"iv"`
+	Data      string `json:"data"`
+}
+
+type secretKey struct {
+	aead cipher.AEAD
+	kid  string
+}
+
+// 密钥是 32 字节，以十六进制或者 base64 的文本形式保存在文件或者环境变量中
+func parseSecretKey(text string) (*secretKey, error) {
+	text = strings.TrimSpace(text)
+	key, err := hex.DecodeString(text)
+	if err != nil || len(key) != 32 {
+		if key, err = base64.StdEncoding.DecodeString(text); err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("密钥必须是 32 字节的十六进制或者 base64 文本")
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &secretKey{aead: aead, kid: hex.EncodeToString(sum[:4])}, nil
+}
+
+// 优先使用文件，文件为空时读取环境变量
+func loadSecretKey(file, env string) (*secretKey, error) {
+	var text string
+	switch {
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeMissingInput, "无法读取密钥文件", err)
+		}
+		text = string(data)
+	case os.Getenv(env) != "":
+		text = os.Getenv(env)
+	default:
+		return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeMissingInput, "缺少密钥",
+			fmt.Errorf("需要通过密钥文件参数或者环境变量 %s 指定密钥", env))
+	}
+
+	key, err := parseSecretKey(text)
+	if err != nil {
+		return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage, "无效的密钥", err)
+	}
+	return key, nil
+}
+
+func (k *secretKey) encrypt(plain []byte) ([]byte, error) {
+	iv := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	return json.Marshal(secretEnvelope{
+		Encrypted: encryptedVersion,
+		Alg:       encryptedAlg,
+		Kid:       k.kid,
+		IV:        base64.StdEncoding.EncodeToString(iv),
+		Data:      base64.StdEncoding.EncodeToString(k.aead.Seal(nil, iv, plain, nil)),
+	})
+}
+
+func (k *secretKey) decrypt(raw string) ([]byte, error) {
+	var env secretEnvelope
+	if err := json.Unmarshal([]byte(raw), &env); err != nil {
+		return nil, fmt.Errorf("无效的加密字段: %w", err)
+	}
+	if env.Encrypted != encryptedVersion || env.Alg != encryptedAlg {
+		return nil, fmt.Errorf("不支持的加密字段: %s / %s", env.Encrypted, env.Alg)
+	}
+	if env.Kid != k.kid {
+		return nil, fmt.Errorf("字段使用的密钥是 %s，当前密钥是 %s", env.Kid, k.kid)
+	}
+	iv, err := base64.StdEncoding.DecodeString(env.IV)
+	if err != nil || len(iv) != k.aead.NonceSize() {
+		return nil, fmt.Errorf("无效的 iv")
+	}
+	data, err := base64.StdEncoding.DecodeString(env.Data)
+	if err != nil {
+		return nil, fmt.Errorf("无效的密文: %w", err)
+	}
+	plain, err := k.aead.Open(nil, iv, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("解密失败，密钥错误或者内容被修改")
+	}
+	if !gjson.ValidBytes(plain) {
+		return nil, fmt.Errorf("解密后的内容不是有效的 JSON")
+	}
+	return plain, nil
+}
+
+func isEnvelope(res gjson.Result) bool {
+	return res.IsObject() && res.Get(qJsonEscape(encryptedMarker)).Exists()
+}
+
+// 文档中所有加密字段的路径(sjson 格式)，根节点本身是加密字段时路径为空
+func envelopePaths(res gjson.Result, path []string, fn func(path []string, raw string)) {
+	if isEnvelope(res) {
+		fn(path, res.Raw)
+		return
+	}
+	if res.IsObject() || res.IsArray() {
+		i := 0
+		res.ForEach(func(k, v gjson.Result) bool {
+			seg := k.String()
+			if res.IsArray() {
+				seg = fmt.Sprint(i)
+				i++
+			}
+			envelopePaths(v, appendPath(path, seg), fn)
+			return true
+		})
+	}
+}
+
+// 把文档中的每个加密字段替换成 fn 的返回值
+func replaceEnvelopes(jsonData []byte, fn func(raw string) ([]byte, error)) ([]byte, error) {
+	type replacement struct {
+		path string
+		raw  []byte
+	}
+	var (
+		replacements []replacement
+		failed       error
+	)
+	envelopePaths(gjson.ParseBytes(jsonData), nil, func(path []string, raw string) {
+		if failed != nil {
+			return
+		}
+		out, err := fn(raw)
+		if err != nil {
+			failed = fmt.Errorf("路径 %q: %w", qJsonEscapeAndJoin(path), err)
+			return
+		}
+		replacements = append(replacements, replacement{path: qJsonEscapeAndJoin(path), raw: out})
+	})
+	if failed != nil {
+		return nil, failed
+	}
+
+	for _, r := range replacements {
+		if r.path == "" {
+			return r.raw, nil
+		}
+		var err error
+		if jsonData, err = sjson.SetRawBytes(jsonData, r.path, r.raw); err != nil {
+			return nil, err
+		}
+	}
+	return jsonData, nil
+}
+
+// 把写入的值加密后再写入，-M 时每个值分别加密
+func encryptOperation(key *secretKey, operation func([]byte, string, any) ([]byte, error)) func([]byte, string, any) ([]byte, error) {
+	return func(jsonData []byte, path string, value any) ([]byte, error) {
+		plain, err := marshalJSON(rawValue(value))
+		if err != nil {
+			return nil, fmt.Errorf("无法编码写入的值: %w", err)
+		}
+		envelope, err := key.encrypt(plain)
+		if err != nil {
+			return nil, err
+		}
+		return operation(jsonData, path, json.RawMessage(envelope))
+	}
+}
+
+// 读取时解密所有的加密字段，用于 --decrypt
+func (opts *CLIOptions) decryptDocument(jsonData []byte) ([]byte, error) {
+	key, err := loadSecretKey(opts.KeyFile, KeyEnv)
+	if err != nil {
+		return nil, err
+	}
+	if !gjson.ValidBytes(jsonData) {
+		return jsonData, nil
+	}
+	out, err := replaceEnvelopes(jsonData, key.decrypt)
+	if err != nil {
+		return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "无法解密", err)
+	}
+	return out, nil
+}
+
+// -m rekey: 用旧密钥解密整个文件中的加密字段，再用新密钥重新加密
+// 写回的方式和 -m w 相同
+func (opts *CLIOptions) rekeyJSON() error {
+	oldKey, err := loadSecretKey(opts.KeyFile, KeyEnv)
+	if err != nil {
+		return err
+	}
+	newKey, err := loadSecretKey(opts.NewKeyFile, NewKeyEnv)
+	if err != nil {
+		return err
+	}
+
+	// 整个文档一次处理，忽略 -p/-P/-M
+	opts.Path, opts.UseMultiPath = "", false
+	return opts.modifyJSON(nil, func(jsonData []byte, _ string, _ any) ([]byte, error) {
+		out, err := replaceEnvelopes(jsonData, func(raw string) ([]byte, error) {
+			plain, err := oldKey.decrypt(raw)
+			if err != nil {
+				return nil, err
+			}
+			return newKey.encrypt(plain)
+		})
+		if err != nil {
+			return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "无法更换密钥", err)
+		}
+		return out, nil
+	})
+}
@@ -0,0 +1,54 @@
+package qqjson
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key, err := parseSecretKey(strings.Repeat("ab", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := parseSecretKey(strings.Repeat("cd", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		// -o 读入的文件内容按字符串加密
+		{"文件内容", []byte("pw\n"), `"pw\n"`},
+		{"字符串", "secret", `"secret"`},
+		{"对象", map[string]any{"u": "x", "n": 1.0}, `{"n":1,"u":"x"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := encryptOperation(key, setValue)([]byte(`{"db":{}}`), "db.pw", tt.value)
+			if err != nil {
+				t.Fatalf("加密失败: %v", err)
+			}
+			if strings.Contains(string(encrypted), "pw\\n") || strings.Contains(string(encrypted), "secret") {
+				t.Errorf("加密后仍然包含明文: %s", encrypted)
+			}
+
+			decrypted, err := replaceEnvelopes(encrypted, key.decrypt)
+			if err != nil {
+				t.Fatalf("解密失败: %v", err)
+			}
+			if got := gjson.GetBytes(decrypted, "db.pw").Raw; got != tt.want {
+				t.Errorf("解密后 = %s，期望 %s", got, tt.want)
+			}
+
+			if _, err := replaceEnvelopes(encrypted, other.decrypt); err == nil {
+				t.Errorf("使用错误的密钥解密应该失败")
+			}
+		})
+	}
+}
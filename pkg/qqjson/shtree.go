@@ -0,0 +1,111 @@
+package qqjson
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"common_tool/pkg/errorutil"
+	"common_tool/pkg/sh"
+
+	"github.com/tidwall/gjson"
+)
+
+// 整个子树一次输出为多条 declare 语句，每个对象/数组对应一个变量
+// 值的类型前缀和 -t sh 相同，对象和数组的值是子变量的名字
+//
+// {"name": "Alice", "profile": {"email": "a@b.c"}, "tags": ["dev", "ops"]}
+// 使用前缀 J 时输出:
+// declare -A J=([$'name']=$'s:Alice' [$'profile']=$'o:J__profile' [$'tags']=$'a:J__tags')
+// declare -A J__profile=([$'email']=$'s:a@b.c')
+// declare -a J__tags=($'s:dev' $'s:ops')
+type BashTreeFormatter struct {
+	Prefix string
+}
+
+func (f BashTreeFormatter) Format(res gjson.Result, _ JSONFormat, _ string) *errorutil.ExitErrorWithCode {
+	writeBashTree(os.Stdout, res, f.Prefix)
+	return outputType(res)
+}
+
+// 按先序输出，父变量总是在子变量之前
+func writeBashTree(w io.Writer, res gjson.Result, name string) {
+	type child struct {
+		name string
+		res  gjson.Result
+	}
+	var children []child
+
+	// 对象和数组的值记录子变量的名字，其它值和 -t sh 一样带类型前缀
+	valueOf := func(segment string, v gjson.Result) string {
+		switch {
+		case v.IsObject():
+			childName := name + "__" + bashVarEscape(segment)
+			children = append(children, child{childName, v})
+			return sh.BashANSIQuote("o:" + childName)
+		case v.IsArray():
+			childName := name + "__" + bashVarEscape(segment)
+			children = append(children, child{childName, v})
+			return sh.BashANSIQuote("a:" + childName)
+		default:
+			return sh.BashANSIQuote(prefixValue(v))
+		}
+	}
+
+	parts := make([]string, 0, res.Get("#").Int())
+	switch {
+	case res.IsObject():
+		res.ForEach(func(k, v gjson.Result) bool {
+			parts = append(parts, fmt.Sprintf("[%s]=%s", sh.BashANSIQuote(k.String()), valueOf(k.String(), v)))
+			return true
+		})
+		fmt.Fprintf(w, "declare -A %s=(%s)\n", name, strings.Join(parts, " "))
+	case res.IsArray():
+		i := 0
+		res.ForEach(func(_, v gjson.Result) bool {
+			parts = append(parts, valueOf(fmt.Sprint(i), v))
+			i++
+			return true
+		})
+		fmt.Fprintf(w, "declare -a %s=(%s)\n", name, strings.Join(parts, " "))
+	default:
+		fmt.Fprintf(w, "declare %s=%s\n", name, sh.BashANSIQuote(prefixValue(res)))
+	}
+
+	for _, c := range children {
+		writeBashTree(w, c.res, c.name)
+	}
+}
+
+// 把路径中的一段转换成变量名中可以使用的字符，段之间用 __ 连接
+// 字母和数字保持不变，其它字节(包括 _)转换成 _xx 的十六进制形式
+// 转换后的段中 _ 后面总是跟着十六进制数字，所以 __ 不会在段内出现，不同的路径不会冲突
+func bashVarEscape(segment string) string {
+	var sb strings.Builder
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "_%02x", c)
+		}
+	}
+	return sb.String()
+}
+
+func isBashIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package qqjson
+
+import (
+	"bytes"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestBashVarEscape(t *testing.T) {
+	tests := []struct {
+		segment string
+		want    string
+	}{
+		{"name", "name"},
+		{"Key9", "Key9"},
+		{"0", "0"},
+		{"", ""},
+		{"a_b", "a_5fb"},
+		{"a__b", "a_5f_5fb"},
+		{"_", "_5f"},
+		{"a.b-c d", "a_2eb_2dc_20d"},
+		{"中", "_e4_b8_ad"},
+	}
+	for _, tt := range tests {
+		if got := bashVarEscape(tt.segment); got != tt.want {
+			t.Errorf("bashVarEscape(%q) = %q，期望 %q", tt.segment, got, tt.want)
+		}
+	}
+}
+
+func TestIsBashIdentifier(t *testing.T) {
+	for _, s := range []string{"J", "_", "_a1", "abc_DEF", "x9"} {
+		if !isBashIdentifier(s) {
+			t.Errorf("isBashIdentifier(%q) = false", s)
+		}
+	}
+	for _, s := range []string{"", "1a", "a-b", "a b", "a.b", "中"} {
+		if isBashIdentifier(s) {
+			t.Errorf("isBashIdentifier(%q) = true", s)
+		}
+	}
+}
+
+func TestWriteBashTree(t *testing.T) {
+	doc := `{"name":"Alice","profile":{"email":"a@b.c","age":3},"tags":["dev",["x"],{}],"ok":true,"none":null}`
+	var buf bytes.Buffer
+	writeBashTree(&buf, gjson.Parse(doc), "J")
+
+	want := `declare -A J=([$'name']=$'s:Alice' [$'profile']=$'o:J__profile' [$'tags']=$'a:J__tags' [$'ok']=$'t:true' [$'none']=$'n:null')
+declare -A J__profile=([$'email']=$'s:a@b.c' [$'age']=$'i:3')
+declare -a J__tags=($'s:dev' $'a:J__tags__1' $'o:J__tags__2')
+declare -a J__tags__1=($'s:x')
+declare -A J__tags__2=()
+`
+	if got := buf.String(); got != want {
+		t.Errorf("writeBashTree =\n%s\n期望\n%s", got, want)
+	}
+
+	buf.Reset()
+	writeBashTree(&buf, gjson.Parse(`"it's"`), "V")
+	if got := buf.String(); got != "declare V=$'s:it\\'s'\n" {
+		t.Errorf("标量的输出 = %q", got)
+	}
+}
+
+// 容易混淆的键生成的变量名都不相同，而且都是合法的变量名
+func TestWriteBashTreeNoCollision(t *testing.T) {
+	doc := `{
+		"a_b": {"x": {}},
+		"a": {"b": {"x": {}}, "_b": {}, "": {"b": {}}},
+		"a__b": {},
+		"a.b": {},
+		"a b": {},
+		"a_5fb": {},
+		"0": [{}, [[]]],
+		"_": {"_": {}},
+		"__": {}
+	}`
+	var buf bytes.Buffer
+	writeBashTree(&buf, gjson.Parse(doc), "J")
+
+	declRe := regexp.MustCompile(`^declare -[aA] (\S+)=\(`)
+	seen := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		m := declRe.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("无法解析的行: %s", line)
+		}
+		if !isBashIdentifier(m[1]) {
+			t.Errorf("无效的变量名: %s", m[1])
+		}
+		if seen[m[1]] {
+			t.Errorf("变量名冲突: %s", m[1])
+		}
+		seen[m[1]] = true
+	}
+	if want := 20; len(seen) != want {
+		t.Errorf("共 %d 个变量，期望 %d 个\n%s", len(seen), want, buf.String())
+	}
+}
+
+// 在 bash 中执行输出，按变量名逐级取回原来的值
+func TestWriteBashTreeEval(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("没有 bash")
+	}
+
+	var buf bytes.Buffer
+	writeBashTree(&buf, gjson.Parse(`{"a_b":{"k":"v1"},"a":{"b":{"k":"v2"}},"l":[1,{"k":"v3"}]}`), "J")
+	script := buf.String() + `
+ref=${J[a_b]#o:}; declare -n m=$ref; echo "${m[k]}"; unset -n m
+ref=${J[a]#o:}; declare -n m=$ref; ref=${m[b]#o:}; unset -n m; declare -n m=$ref; echo "${m[k]}"; unset -n m
+ref=${J[l]#a:}; declare -n m=$ref; ref=${m[1]#o:}; echo "${m[0]}"; unset -n m; declare -n m=$ref; echo "${m[k]}"
+`
+	out, err := exec.Command(bash, "-c", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash 执行失败: %v\n%s", err, out)
+	}
+	if want := "s:v1\ns:v2\ni:1\ns:v3\n"; string(out) != want {
+		t.Errorf("bash 输出 %q，期望 %q", out, want)
+	}
+}
@@ -0,0 +1,137 @@
+package qqjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"common_tool/pkg/errorutil"
+	"common_tool/pkg/sh"
+)
+
+// 用 JSON Schema 校验输入，-p/-P 指定时只校验对应的子树
+// 有违反约束的地方时返回 CodeInvalidData
+func (opts *CLIOptions) validateJSON() error {
+	if opts.Format != "txt" && opts.Format != "sh" {
+		return fmt.Errorf("validate 模式只支持 txt / sh 格式: %s", opts.Format)
+	}
+	if opts.SchemaFile == "" {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeMissingInput, "缺少 --schema 参数", fmt.Errorf("validate 模式需要指定 schema 文件"))
+	}
+
+	schemaData, err := os.ReadFile(opts.SchemaFile)
+	if err != nil {
+		return fmt.Errorf("无法读取 schema 文件 %s: %w", opts.SchemaFile, err)
+	}
+	var schema any
+	if err := json.Unmarshal(schemaData, &schema); err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "schema 文件不是有效的 JSON", err)
+	}
+
+	raw, err := opts.readDocument()
+	if err != nil {
+		return err
+	}
+
+	value, err := opts.document(raw).Get(opts.Path)
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, err.Error(), err)
+	}
+
+	var doc any
+	if err := json.Unmarshal([]byte(value.Raw), &doc); err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, "输入内容不是有效的 JSON", err)
+	}
+
+	segments := opts.ArgPath
+	if !opts.UseArgPath {
+		segments = splitGJSONPath(opts.Path)
+	}
+	basePointer := ""
+	for _, seg := range segments {
+		basePointer += "/" + escapeJSONPointer(seg)
+	}
+
+	violations, err := validateSchema(schema, doc, basePointer)
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeConfigError, "schema 无法使用", err)
+	}
+
+	if opts.Format == "sh" {
+		outputViolationsBash(violations)
+	} else if err := outputViolationsText(violations, opts.JSONFormat, opts.TrieSeparator); err != nil {
+		return errorutil.NewExitError(errorutil.CodeIOError, err)
+	}
+
+	if len(violations) > 0 {
+		return &errorutil.ExitErrorWithCode{
+			Code:    errorutil.CodeInvalidData,
+			Message: fmt.Sprintf("校验失败，共 %d 处不符合 schema", len(violations)),
+		}
+	}
+	return nil
+}
+
+// 输出为 JSON 数组 [{"path": "/a/0", "message": "..."}]
+func outputViolationsText(violations []SchemaViolation, jsonFormat JSONFormat, trieSep string) error {
+	if violations == nil {
+		violations = []SchemaViolation{}
+	}
+	data, err := json.Marshal(violations)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(formatJSON(data, jsonFormat, trieSep))
+	return err
+}
+
+// 根路径在关联数组中的键，Bash 的关联数组不允许空的下标
+// 其它路径都以 / 开头，不会和它冲突
+const bashRootKey = "(root)"
+
+// 输出为关联数组的内容，同一路径的多条消息用换行连接
+// declare -A errs=()
+// eval -- errs=($(gobolt json -m validate -t sh ...))
+func outputViolationsBash(violations []SchemaViolation) {
+	merged := map[string][]string{}
+	for _, v := range violations {
+		key := v.Path
+		if key == "" {
+			key = bashRootKey
+		}
+		merged[key] = append(merged[key], v.Message)
+	}
+
+	parts := make([]string, 0, len(merged))
+	for _, p := range sortedKeys(merged) {
+		parts = append(parts, fmt.Sprintf("[%s]=%s",
+			sh.BashANSIQuote(p),
+			sh.BashANSIQuote(strings.Join(merged[p], "\n")),
+		))
+	}
+	fmt.Printf("%s", strings.Join(parts, " "))
+}
+
+// 把 gjson 路径按未转义的 . 拆分成路径片段，并去掉转义用的反斜杠
+func splitGJSONPath(path string) []string {
+	if strings.TrimSpace(path) == "" {
+		return nil
+	}
+
+	var segments []string
+	var cur strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '\\' && i+1 < len(path):
+			i++
+			cur.WriteByte(path[i])
+		case c == '.':
+			segments = append(segments, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	return append(segments, cur.String())
+}
@@ -112,3 +112,146 @@ func BuildCommandLineQuoted(args []string) string {
 	}
 	return strings.Join(quoted, " ")
 }
+
+// SplitWords 按 Bash 的规则把一行文本拆分成单词（不做变量展开）
+// 支持 '...' "..." $'...' 以及引号外的反斜杠转义
+// 可以和 BashANSIQuote / BuildCommandLineQuoted 的输出互逆
+func SplitWords(line string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	rs := []rune(line)
+
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		case r == '\\':
+			inWord = true
+			if i+1 < len(rs) {
+				i++
+				cur.WriteRune(rs[i])
+			}
+		case r == '\'':
+			inWord = true
+			end := indexRune(rs, i+1, '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("单引号未闭合: %s", line)
+			}
+			cur.WriteString(string(rs[i+1 : end]))
+			i = end
+		case r == '"':
+			inWord = true
+			j := i + 1
+			for ; j < len(rs) && rs[j] != '"'; j++ {
+				if rs[j] == '\\' && j+1 < len(rs) && strings.ContainsRune("\"\\$`", rs[j+1]) {
+					j++
+				}
+				cur.WriteRune(rs[j])
+			}
+			if j >= len(rs) {
+				return nil, fmt.Errorf("双引号未闭合: %s", line)
+			}
+			i = j
+		case r == '$' && i+1 < len(rs) && rs[i+1] == '\'':
+			inWord = true
+			n, err := unquoteANSI(rs[i+2:], &cur)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", err, line)
+			}
+			i += 1 + n
+		default:
+			inWord = true
+			cur.WriteRune(r)
+		}
+	}
+
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+func indexRune(rs []rune, from int, target rune) int {
+	for i := from; i < len(rs); i++ {
+		if rs[i] == target {
+			return i
+		}
+	}
+	return -1
+}
+
+// 解析 $'...' 的内容（不包含开头的 $'），返回消耗的字符数（包含结尾的 '）
+func unquoteANSI(rs []rune, b *strings.Builder) (int, error) {
+	simple := map[rune]rune{
+		'a': '\a', 'b': '\b', 't': '\t', 'n': '\n', 'v': '\v',
+		'f': '\f', 'r': '\r', 'E': 27, 'e': 27,
+		'\\': '\\', '\'': '\'', '"': '"', '?': '?',
+	}
+
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		if r == '\'' {
+			return i + 1, nil
+		}
+		if r != '\\' || i+1 >= len(rs) {
+			b.WriteRune(r)
+			continue
+		}
+
+		i++
+		esc := rs[i]
+		if v, ok := simple[esc]; ok {
+			b.WriteRune(v)
+			continue
+		}
+
+		switch {
+		case esc >= '0' && esc <= '7':
+			// \ooo 八进制，最多 3 位
+			val, n := 0, 0
+			for ; n < 3 && i+n < len(rs) && rs[i+n] >= '0' && rs[i+n] <= '7'; n++ {
+				val = val*8 + int(rs[i+n]-'0')
+			}
+			b.WriteByte(byte(val))
+			i += n - 1
+		case esc == 'x':
+			// \xHH 十六进制，最多 2 位
+			val, n := 0, 0
+			for ; n < 2 && i+1+n < len(rs) && isHexRune(rs[i+1+n]); n++ {
+				val = val*16 + hexRuneVal(rs[i+1+n])
+			}
+			if n == 0 {
+				b.WriteString(`\x`)
+				continue
+			}
+			b.WriteByte(byte(val))
+			i += n
+		default:
+			b.WriteRune('\\')
+			b.WriteRune(esc)
+		}
+	}
+
+	return 0, fmt.Errorf("$'...' 引号未闭合")
+}
+
+func isHexRune(r rune) bool {
+	return (r >= '0' && r <= '9') || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+func hexRuneVal(r rune) int {
+	switch {
+	case r >= '0' && r <= '9':
+		return int(r - '0')
+	case r >= 'a' && r <= 'f':
+		return int(r-'a') + 10
+	default:
+		return int(r-'A') + 10
+	}
+}
@@ -0,0 +1,66 @@
+package sh
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"set  a\tb", []string{"set", "a", "b"}},
+		{"", nil},
+		{`'a b' "c d"`, []string{"a b", "c d"}},
+		{`a'b'"c"d`, []string{"abcd"}},
+		{`'' ""`, []string{"", ""}},
+		{`'\n' "\n"`, []string{`\n`, `\n`}},
+		{`"a\"b\\c\$d\x"`, []string{`a"b\c$d\x`}},
+		{`a\ b \'`, []string{"a b", "'"}},
+		{`$'a\tb\'c' $'\x41\101\e' $'\q\x'`, []string{"a\tb'c", "AA\x1b", `\q\x`}},
+		{`$'\0' $'中文'`, []string{"\x00", "中文"}},
+		{`x$'y'z`, []string{"xyz"}},
+	}
+	for _, tt := range tests {
+		got, err := SplitWords(tt.line)
+		if err != nil {
+			t.Errorf("%q 失败: %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q = %q，期望 %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestSplitWordsErrors(t *testing.T) {
+	for _, line := range []string{`'abc`, `"abc`, `"a\"`, `$'abc`, `a $'b\'`} {
+		if got, err := SplitWords(line); err == nil {
+			t.Errorf("%q 应该报错，得到 %q", line, got)
+		}
+	}
+}
+
+func TestSplitWordsQuoteRoundTrip(t *testing.T) {
+	args := []string{"", "a b", "it's", `back\slash`, "tab\there", "line\nbreak", "\x1b[0m", "\x01\x7f", "中文 $HOME `x`"}
+	got, err := SplitWords(BuildCommandLineQuoted(args))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, args) {
+		t.Errorf("结果 = %q，期望 %q", got, args)
+	}
+}
+
+func TestUnquoteANSI(t *testing.T) {
+	var b strings.Builder
+	n, err := unquoteANSI([]rune(`a\'b' rest`), &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || b.String() != "a'b" {
+		t.Errorf("消耗 %d 个字符，得到 %q，期望 5 %q", n, b.String(), "a'b")
+	}
+}
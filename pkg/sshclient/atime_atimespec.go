@@ -0,0 +1,18 @@
+//go:build darwin || freebsd || netbsd
+
+package sshclient
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// 本地文件的访问时间，os.FileInfo 只有修改时间
+func localAtime(info os.FileInfo) (time.Time, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(st.Atimespec.Sec), int64(st.Atimespec.Nsec)), true
+}
@@ -0,0 +1,13 @@
+//go:build !(aix || dragonfly || linux || openbsd || solaris || darwin || freebsd || netbsd || windows)
+
+package sshclient
+
+import (
+	"os"
+	"time"
+)
+
+// 其它系统不读取访问时间，--preserve 时报告没有保留
+func localAtime(info os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package sshclient
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// 本地文件的访问时间，os.FileInfo 只有修改时间
+func localAtime(info os.FileInfo) (time.Time, bool) {
+	attr, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, attr.LastAccessTime.Nanoseconds()), true
+}
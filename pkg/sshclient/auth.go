@@ -0,0 +1,223 @@
+package sshclient
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"common_tool/pkg/errorutil"
+	"common_tool/pkg/logutil"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// 认证方式，--auth-order 按顺序尝试
+// publickey            : --identity 指定的私钥(有对应的证书时使用证书)
+// agent                : SSH_AUTH_SOCK 指向的 ssh-agent 中的密钥
+// keyboard-interactive : 服务端的提问，有 --password 时用密码回答，否则从终端读取(不是终端或者并行执行时不读取)
+// password             : --password 指定的密码
+const (
+	AuthPublicKey           = "publickey"
+	AuthAgent               = "agent"
+	AuthKeyboardInteractive = "keyboard-interactive"
+	AuthPassword            = "password"
+)
+
+var defaultAuthOrder = []string{AuthPublicKey, AuthAgent, AuthKeyboardInteractive, AuthPassword}
+
+// 标准输入只通过这一个 reader 读取，keyboard-interactive 读取回答时多读到缓冲区中的内容
+// 之后还会被 --stream 和 shell 转发到远端，不会丢失
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// 按 --auth-order 的顺序生成认证方式，返回的 cleanup 用于在握手完成后关闭 agent 的连接
+// x/crypto/ssh 中同一种认证方式只会尝试一次，所以 publickey 和 agent 的密钥合并成一个，
+// 放在两者中靠前的位置，内部的顺序也和 --auth-order 相同
+func authMethods(base CLIOptionsBase) ([]ssh.AuthMethod, func(), error) {
+	order := base.AuthOrder
+	if len(order) == 0 {
+		order = defaultAuthOrder
+	}
+
+	cleanup := func() {}
+	var (
+		methods      []ssh.AuthMethod
+		signers      []ssh.Signer
+		publicKeyPos = -1
+	)
+	for _, name := range order {
+		switch strings.TrimSpace(name) {
+		case AuthPublicKey:
+			keys, err := loadIdentities(base)
+			if err != nil {
+				return nil, cleanup, err
+			}
+			signers = append(signers, keys...)
+		case AuthAgent:
+			keys, closeAgent := agentSigners()
+			signers = append(signers, keys...)
+			cleanup = closeAgent
+		case AuthKeyboardInteractive:
+			prompt := !base.noPrompt && isTerminal(int(os.Stdin.Fd()))
+			methods = append(methods, ssh.KeyboardInteractive(keyboardInteractive(base.Password, prompt)))
+			continue
+		case AuthPassword:
+			if base.Password != "" {
+				methods = append(methods, ssh.Password(base.Password))
+			}
+			continue
+		default:
+			return nil, cleanup, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage,
+				fmt.Sprintf("未知的认证方式: %q", name),
+				fmt.Errorf("--auth-order 只能包含 %s", strings.Join(defaultAuthOrder, " / ")))
+		}
+		if publicKeyPos < 0 {
+			publicKeyPos = len(methods)
+			methods = append(methods, nil)
+		}
+	}
+
+	if publicKeyPos >= 0 {
+		if len(signers) > 0 {
+			methods[publicKeyPos] = ssh.PublicKeys(signers...)
+		} else {
+			methods = append(methods[:publicKeyPos], methods[publicKeyPos+1:]...)
+		}
+	}
+
+	// 什么都没有的时候和以前一样尝试空密码
+	if len(methods) == 0 {
+		methods = append(methods, ssh.Password(base.Password))
+	}
+	return methods, cleanup, nil
+}
+
+// 读取 --identity 指定的私钥，同目录下有 <私钥>-cert.pub 或者指定了 --cert 时使用证书认证
+func loadIdentities(base CLIOptionsBase) ([]ssh.Signer, error) {
+	var signers []ssh.Signer
+	for _, file := range base.IdentityFiles {
+		file = expandHome(file)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeMissingInput, "无法读取私钥文件", err)
+		}
+
+		var signer ssh.Signer
+		if base.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(base.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(data)
+		}
+		if err != nil {
+			if _, ok := err.(*ssh.PassphraseMissingError); ok {
+				return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage,
+					fmt.Sprintf("私钥 %s 有密码保护，请使用 --passphrase 指定", file), err)
+			}
+			return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData,
+				fmt.Sprintf("无法解析私钥 %s", file), err)
+		}
+
+		certFile := base.CertFile
+		if certFile == "" {
+			if _, err := os.Stat(file + "-cert.pub"); err == nil {
+				certFile = file + "-cert.pub"
+			}
+		}
+		if certFile != "" {
+			certSigner, err := certSigner(expandHome(certFile), signer)
+			if err != nil {
+				return nil, err
+			}
+			if certSigner != nil {
+				signers = append(signers, certSigner)
+			}
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+// 证书和私钥不匹配的时候返回 nil，这样 --cert 可以和多个 --identity 一起使用
+func certSigner(file string, signer ssh.Signer) (ssh.Signer, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeMissingInput, "无法读取证书文件", err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData, fmt.Sprintf("无法解析证书 %s", file), err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidData,
+			fmt.Sprintf("%s 不是 SSH 证书", file), fmt.Errorf("invalid certificate"))
+	}
+	if string(cert.Key.Marshal()) != string(signer.PublicKey().Marshal()) {
+		logutil.Debug("证书 %s 和私钥不匹配，跳过", file)
+		return nil, nil
+	}
+	return ssh.NewCertSigner(cert, signer)
+}
+
+// 没有 SSH_AUTH_SOCK 或者连接失败时不使用 agent
+func agentSigners() ([]ssh.Signer, func()) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, func() {}
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		logutil.Warn("连接 ssh-agent 失败: %v", err)
+		return nil, func() {}
+	}
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		logutil.Warn("读取 ssh-agent 的密钥失败: %v", err)
+		conn.Close()
+		return nil, func() {}
+	}
+	return signers, func() { conn.Close() }
+}
+
+// 有密码时用密码回答所有不回显的问题，prompt 为 true 时其它问题从标准输入读取
+// 不能读取或者读取失败时回答空字符串，让服务端拒绝后继续尝试后面的认证方式(返回错误会中止整个认证)
+func keyboardInteractive(password string, prompt bool) ssh.KeyboardInteractiveChallenge {
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		if prompt && (name != "" || instruction != "") && len(questions) > 0 {
+			fmt.Fprintln(os.Stderr, strings.TrimSpace(name+"\n"+instruction))
+		}
+		for i, q := range questions {
+			if !echos[i] && password != "" {
+				answers[i] = password
+				continue
+			}
+			if !prompt {
+				logutil.Debug("不从标准输入读取 keyboard-interactive 的回答: %q", q)
+				break
+			}
+			fmt.Fprint(os.Stderr, q)
+			line, err := stdinReader.ReadString('\n')
+			if err != nil && line == "" {
+				logutil.Warn("读取 keyboard-interactive 的回答失败: %v", err)
+				fmt.Fprintln(os.Stderr)
+				break
+			}
+			answers[i] = strings.TrimRight(line, "\r\n")
+		}
+		return answers, nil
+	}
+}
+
+// ~/xx 展开成用户目录
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, p[1:])
+		}
+	}
+	return p
+}
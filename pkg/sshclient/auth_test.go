@@ -0,0 +1,31 @@
+package sshclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeyboardInteractiveNoPrompt(t *testing.T) {
+	tests := []struct {
+		name      string
+		password  string
+		questions []string
+		echos     []bool
+		want      []string
+	}{
+		{"密码回答不回显的问题", "pw", []string{"Password: ", "Code: "}, []bool{false, false}, []string{"pw", "pw"}},
+		{"不读取回显的问题", "pw", []string{"Password: ", "User: "}, []bool{false, true}, []string{"pw", ""}},
+		{"没有密码", "", []string{"Password: "}, []bool{false}, []string{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := keyboardInteractive(tt.password, false)("", "", tt.questions, tt.echos)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("回答 = %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,462 @@
+package sshclient
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"common_tool/pkg/errorutil"
+	"common_tool/pkg/logutil"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// 端口转发的类型，和 ssh 的 -L -R -D 相同
+const (
+	ForwardLocal   = "L"
+	ForwardRemote  = "R"
+	ForwardDynamic = "D"
+)
+
+type CLIOptionsForward struct {
+	CLIOptionsBase
+	Local   []string
+	Remote  []string
+	Dynamic []string
+	// 保活请求的间隔(0 表示不发送)，连续多少次没有响应时断开
+	KeepAlive    time.Duration
+	KeepAliveMax int
+}
+
+// Listen 是监听的地址，Target 是转发的目标地址(-D 时为空，由 SOCKS5 请求决定)
+type forwardSpec struct {
+	Kind   string
+	Listen string
+	Target string
+}
+
+func (f forwardSpec) String() string {
+	if f.Kind == ForwardDynamic {
+		return fmt.Sprintf("-D %s (SOCKS5)", f.Listen)
+	}
+	return fmt.Sprintf("-%s %s -> %s", f.Kind, f.Listen, f.Target)
+}
+
+// -L / -R: [bind_address:]port:host:hostport，-D: [bind_address:]port
+// bind_address 默认 localhost，* 或者空表示所有地址，IPv6 地址用 [] 括起来
+func parseForwardSpec(kind, s string) (forwardSpec, error) {
+	parts := splitForwardSpec(s)
+	spec := forwardSpec{Kind: kind}
+	bind := func(addr, port string) string {
+		if addr == "*" || addr == "" {
+			addr = "0.0.0.0"
+		}
+		return net.JoinHostPort(addr, port)
+	}
+	switch {
+	case kind == ForwardDynamic && len(parts) == 1:
+		spec.Listen = bind("localhost", parts[0])
+	case kind == ForwardDynamic && len(parts) == 2:
+		spec.Listen = bind(parts[0], parts[1])
+	case kind != ForwardDynamic && len(parts) == 3:
+		spec.Listen = bind("localhost", parts[0])
+		spec.Target = net.JoinHostPort(parts[1], parts[2])
+	case kind != ForwardDynamic && len(parts) == 4:
+		spec.Listen = bind(parts[0], parts[1])
+		spec.Target = net.JoinHostPort(parts[2], parts[3])
+	default:
+		return spec, fmt.Errorf("-%s 的格式有误: %q", kind, s)
+	}
+
+	ports := []string{spec.Listen}
+	if spec.Target != "" {
+		ports = append(ports, spec.Target)
+	}
+	for _, addr := range ports {
+		_, port, _ := net.SplitHostPort(addr)
+		if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+			return spec, fmt.Errorf("-%s 中的端口有误: %q", kind, s)
+		}
+	}
+	return spec, nil
+}
+
+// 按 : 分割，[] 中的 : 不分割
+func splitForwardSpec(s string) []string {
+	var parts []string
+	var cur strings.Builder
+	inBracket := false
+	for _, r := range s {
+		switch {
+		case r == '[':
+			inBracket = true
+		case r == ']':
+			inBracket = false
+		case r == ':' && !inBracket:
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	return append(parts, cur.String())
+}
+
+func (opts *CLIOptionsForward) specs() ([]forwardSpec, error) {
+	var specs []forwardSpec
+	for _, group := range []struct {
+		kind  string
+		items []string
+	}{{ForwardLocal, opts.Local}, {ForwardRemote, opts.Remote}, {ForwardDynamic, opts.Dynamic}} {
+		for _, item := range group.items {
+			spec, err := parseForwardSpec(group.kind, item)
+			if err != nil {
+				return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage, "端口转发的参数有误", err)
+			}
+			specs = append(specs, spec)
+		}
+	}
+	if len(specs) == 0 {
+		return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage,
+			"至少需要一个 -L / -R / -D", fmt.Errorf("no forward specified"))
+	}
+	return specs, nil
+}
+
+// 在一个连接上建立所有的转发，直到 Ctrl-C、连接断开或者保活失败
+func (opts *CLIOptionsForward) RunForward() error {
+	specs, err := opts.specs()
+	if err != nil {
+		return err
+	}
+
+	conn, err := createSSHClient(opts.CLIOptionsBase)
+	if err != nil {
+		return connectError("连接失败", err)
+	}
+	defer conn.Close()
+
+	var listeners []net.Listener
+	defer func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}()
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for _, spec := range specs {
+		ln, err := listenForward(conn, spec)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, ln)
+		fmt.Fprintf(os.Stderr, "转发 %s (监听 %s)\n", spec, ln.Addr())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveForward(conn, ln, spec, stop)
+		}()
+	}
+	fmt.Fprintf(os.Stderr, "经过 %s，按 Ctrl-C 退出\n", net.JoinHostPort(opts.Host, opts.Port))
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	closed := make(chan error, 1)
+	go func() { closed <- conn.Wait() }()
+	keepAliveFailed := make(chan error, 1)
+	stopKeepAlive := keepAlive(conn, opts.KeepAlive, opts.KeepAliveMax, keepAliveFailed)
+	defer stopKeepAlive()
+
+	var result error
+	select {
+	case s := <-sig:
+		logutil.Info("收到信号 %v，停止端口转发", s)
+	case err := <-closed:
+		result = errorutil.NewExitErrorWithMessage(errorutil.CodeSSHError, "连接已经断开", err)
+	case err := <-keepAliveFailed:
+		result = errorutil.NewExitErrorWithMessage(errorutil.CodeSSHError, "服务端没有响应保活请求", err)
+	}
+
+	// 先关闭监听，再关闭正在转发的连接和 SSH 连接
+	for _, ln := range listeners {
+		ln.Close()
+	}
+	listeners = nil
+	close(stop)
+	conn.Close()
+	wg.Wait()
+	return result
+}
+
+// -L -D 在本地监听，-R 请求服务端监听(tcpip-forward)
+func listenForward(conn *ssh.Client, spec forwardSpec) (net.Listener, error) {
+	if spec.Kind == ForwardRemote {
+		ln, err := conn.Listen("tcp", spec.Listen)
+		if err != nil {
+			return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeSSHError,
+				fmt.Sprintf("服务端拒绝监听 %s", spec.Listen), err)
+		}
+		return ln, nil
+	}
+	ln, err := net.Listen("tcp", spec.Listen)
+	if err != nil {
+		return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeIOError,
+			fmt.Sprintf("无法监听本地地址 %s", spec.Listen), err)
+	}
+	return ln, nil
+}
+
+// 监听关闭前一直接受连接，所有连接结束后返回
+func serveForward(conn *ssh.Client, ln net.Listener, spec forwardSpec, stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) && !errors.Is(err, io.EOF) {
+				logutil.Debug("%s 停止接受连接: %v", spec.String(), err)
+			}
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handleForward(conn, c, spec, stop)
+		}()
+	}
+}
+
+func handleForward(conn *ssh.Client, c net.Conn, spec forwardSpec, stop <-chan struct{}) {
+	defer c.Close()
+
+	var (
+		target net.Conn
+		err    error
+	)
+	switch spec.Kind {
+	case ForwardLocal:
+		target, err = conn.Dial("tcp", spec.Target)
+	case ForwardRemote:
+		target, err = net.DialTimeout("tcp", spec.Target, 20*time.Second)
+	case ForwardDynamic:
+		var addr string
+		if addr, err = socks5Handshake(c); err != nil {
+			logutil.Warn("%s: SOCKS5 请求有误: %v", spec.String(), err)
+			return
+		}
+		target, err = conn.Dial("tcp", addr)
+		if err != nil {
+			socks5Reply(c, socks5HostUnreachable)
+		} else {
+			socks5Reply(c, socks5Succeeded)
+		}
+		spec.Target = addr
+	}
+	if err != nil {
+		logutil.Warn("%s: 连接 %s 失败: %v", spec.String(), spec.Target, err)
+		return
+	}
+	defer target.Close()
+
+	logutil.Debug("%s: %s 已连接", spec.String(), c.RemoteAddr().String())
+	pipeConn(c, target, stop)
+}
+
+// 双向复制，一个方向结束时关闭对端的写，两个方向都结束或者 stop 关闭后返回
+func pipeConn(a, b net.Conn, stop <-chan struct{}) {
+	done := make(chan struct{}, 2)
+	copyHalf := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+		done <- struct{}{}
+	}
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-stop:
+			a.Close()
+			b.Close()
+			return
+		}
+	}
+}
+
+// 定时发送 keepalive@openssh.com，连续 max 次失败时通知 failed
+func keepAlive(conn *ssh.Client, interval time.Duration, max int, failed chan<- error) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		misses := 0
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			reply := make(chan error, 1)
+			go func() {
+				_, _, err := conn.SendRequest("keepalive@openssh.com", true, nil)
+				reply <- err
+			}()
+			var err error
+			select {
+			case err = <-reply:
+			case <-time.After(interval):
+				err = fmt.Errorf("保活请求超时(%v)", interval)
+			case <-done:
+				return
+			}
+			if err == nil {
+				misses = 0
+				continue
+			}
+			misses++
+			logutil.Warn("保活请求失败(%d/%d): %v", misses, max, err)
+			if misses >= max {
+				failed <- err
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// SOCKS5(RFC 1928)，只支持无认证的 CONNECT
+const (
+	socks5Version           = 0x05
+	socks5Succeeded         = 0x00
+	socks5HostUnreachable   = 0x04
+	socks5CmdNotSupported   = 0x07
+	socks5AddrNotSupported  = 0x08
+	socks5NoAcceptableAuths = 0xff
+)
+
+// 完成协商，返回客户端请求连接的 host:port，域名由服务端解析
+func socks5Handshake(c net.Conn) (string, error) {
+	c.SetDeadline(time.Now().Add(30 * time.Second))
+	defer c.SetDeadline(time.Time{})
+
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(c, hdr); err != nil {
+		return "", err
+	}
+	if hdr[0] != socks5Version {
+		return "", fmt.Errorf("不支持的 SOCKS 版本 %d", hdr[0])
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(c, methods); err != nil {
+		return "", err
+	}
+	if !bytes.Contains(methods, []byte{0x00}) {
+		c.Write([]byte{socks5Version, socks5NoAcceptableAuths})
+		return "", fmt.Errorf("客户端不支持无认证方式")
+	}
+	if _, err := c.Write([]byte{socks5Version, 0x00}); err != nil {
+		return "", err
+	}
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(c, req); err != nil {
+		return "", err
+	}
+	if req[1] != 0x01 {
+		socks5Reply(c, socks5CmdNotSupported)
+		return "", fmt.Errorf("不支持的命令 %d", req[1])
+	}
+
+	var host string
+	switch req[3] {
+	case 0x01, 0x04:
+		ip := make([]byte, net.IPv4len)
+		if req[3] == 0x04 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(c, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case 0x03:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(c, n); err != nil {
+			return "", err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(c, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		socks5Reply(c, socks5AddrNotSupported)
+		return "", fmt.Errorf("不支持的地址类型 %d", req[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(c, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// 绑定地址固定为 0.0.0.0:0
+func socks5Reply(c net.Conn, code byte) {
+	c.Write([]byte{socks5Version, code, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+}
+
+func sshForwardCmd() *cobra.Command {
+	opts := &CLIOptionsForward{}
+
+	cmd := &cobra.Command{
+		Use:   "forward",
+		Short: "端口转发(-L 本地 / -R 远端 / -D SOCKS5)",
+		Long: `端口转发，和 ssh 的 -L -R -D 相同，每种都可以重复指定多个，共用一个连接
+	-L [bind_address:]port:host:hostport  本地监听 port，连接经过 SSH 主机转发到 host:hostport
+	-R [bind_address:]port:host:hostport  SSH 主机上监听 port，连接转发到本地可以访问的 host:hostport
+	-D [bind_address:]port                本地 SOCKS5 代理(无认证，CONNECT)，域名由 SSH 主机解析
+bind_address 默认 localhost，* 表示所有地址，IPv6 地址用 [] 括起来
+连接参数和 gobolt ssh cmd 相同(包括 -J 跳板机)
+--keepalive 指定保活请求的间隔(0 表示不发送)，连续 --keepalive-max 次没有响应时退出(退出码 71)
+按 Ctrl-C 停止所有转发并退出(退出码 0)，连接断开时退出码为 71
+举例:
+gobolt ssh forward -H lab1 -U root -P xx -L 8443:10.0.0.5:443 -L 2200:10.0.0.6:22
+gobolt ssh forward -H lab1 -D 1080
+curl --socks5-hostname 127.0.0.1:1080 -k https://10.0.0.5/redfish/v1
+gobolt ssh forward -H lab1 -R 8080:127.0.0.1:80
+		`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return opts.RunForward()
+		},
+	}
+
+	bindCommonSSHFlags(cmd, &opts.CLIOptionsBase)
+	cmd.Flags().StringArrayVarP(&opts.Local, "local", "L", nil, "本地转发 [bind_address:]port:host:hostport，可以重复指定多个")
+	cmd.Flags().StringArrayVarP(&opts.Remote, "remote", "R", nil, "远端转发 [bind_address:]port:host:hostport，可以重复指定多个")
+	cmd.Flags().StringArrayVarP(&opts.Dynamic, "dynamic", "D", nil, "SOCKS5 代理 [bind_address:]port，可以重复指定多个")
+	cmd.Flags().DurationVar(&opts.KeepAlive, "keepalive", 30*time.Second, "保活请求的间隔，0 表示不发送")
+	cmd.Flags().IntVar(&opts.KeepAliveMax, "keepalive-max", 3, "连续多少次保活失败时断开")
+
+	return cmd
+}
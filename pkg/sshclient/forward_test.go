@@ -0,0 +1,113 @@
+package sshclient
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestParseForwardSpec(t *testing.T) {
+	tests := []struct {
+		kind   string
+		spec   string
+		listen string
+		target string
+		err    bool
+	}{
+		{ForwardLocal, "8443:10.0.0.5:443", "localhost:8443", "10.0.0.5:443", false},
+		{ForwardLocal, "0.0.0.0:8443:db:5432", "0.0.0.0:8443", "db:5432", false},
+		{ForwardLocal, "*:80:web:80", "0.0.0.0:80", "web:80", false},
+		{ForwardLocal, ":80:web:80", "0.0.0.0:80", "web:80", false},
+		{ForwardLocal, "[::1]:8080:[fe80::1]:80", "[::1]:8080", "[fe80::1]:80", false},
+		{ForwardRemote, "8080:127.0.0.1:80", "localhost:8080", "127.0.0.1:80", false},
+		{ForwardDynamic, "1080", "localhost:1080", "", false},
+		{ForwardDynamic, "*:1080", "0.0.0.0:1080", "", false},
+		{ForwardDynamic, "[::]:1080", "[::]:1080", "", false},
+		{ForwardLocal, "8443", "", "", true},
+		{ForwardLocal, "a:b:c:d:e", "", "", true},
+		{ForwardLocal, "x:host:80", "", "", true},
+		{ForwardLocal, "80:host:70000", "", "", true},
+		{ForwardDynamic, "1080:host:80", "", "", true},
+		{ForwardDynamic, "-1", "", "", true},
+	}
+	for _, tt := range tests {
+		spec, err := parseForwardSpec(tt.kind, tt.spec)
+		if tt.err {
+			if err == nil {
+				t.Errorf("-%s %q 应该报错，得到 %v", tt.kind, tt.spec, spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("-%s %q 失败: %v", tt.kind, tt.spec, err)
+			continue
+		}
+		if spec.Kind != tt.kind || spec.Listen != tt.listen || spec.Target != tt.target {
+			t.Errorf("-%s %q = %+v，期望 %s -> %s", tt.kind, tt.spec, spec, tt.listen, tt.target)
+		}
+	}
+}
+
+func TestSocks5Handshake(t *testing.T) {
+	tests := []struct {
+		name     string
+		greeting []byte
+		request  []byte
+		target   string
+		// 客户端收到的所有内容
+		reply []byte
+		// 请求不完整，发送后关闭连接
+		truncated bool
+	}{
+		{"IPv4", []byte{5, 1, 0}, []byte{5, 1, 0, 1, 10, 0, 0, 5, 0x01, 0xbb}, "10.0.0.5:443", []byte{5, 0}, false},
+		{"域名", []byte{5, 2, 2, 0}, append(append([]byte{5, 1, 0, 3, 7}, "example"...), 0, 80), "example:80", []byte{5, 0}, false},
+		{"IPv6", []byte{5, 1, 0}, append(append([]byte{5, 1, 0, 4}, net.IPv6loopback...), 0, 22), "[::1]:22", []byte{5, 0}, false},
+		{"不支持无认证", []byte{5, 1, 2}, nil, "", []byte{5, socks5NoAcceptableAuths}, false},
+		{"SOCKS4", []byte{4, 1, 0}, nil, "", nil, false},
+		{"BIND 命令", []byte{5, 1, 0}, []byte{5, 2, 0, 1}, "",
+			[]byte{5, 0, 5, socks5CmdNotSupported, 0, 1, 0, 0, 0, 0, 0, 0}, false},
+		{"未知的地址类型", []byte{5, 1, 0}, []byte{5, 1, 0, 9}, "",
+			[]byte{5, 0, 5, socks5AddrNotSupported, 0, 1, 0, 0, 0, 0, 0, 0}, false},
+		{"请求不完整", []byte{5, 1, 0}, []byte{5, 1, 0, 3, 7, 'e', 'x'}, "", []byte{5, 0}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// net.Pipe 没有缓冲，客户端只发送服务端会读取的内容
+			server, client := net.Pipe()
+			received := make(chan []byte, 1)
+			go func() {
+				defer client.Close()
+				var buf bytes.Buffer
+				if _, err := client.Write(tt.greeting); err == nil && tt.request != nil {
+					method := make([]byte, 2)
+					if _, err := io.ReadFull(client, method); err == nil {
+						buf.Write(method)
+						client.Write(tt.request)
+					}
+				}
+				if tt.truncated {
+					client.Close()
+				}
+				rest, _ := io.ReadAll(client)
+				received <- append(buf.Bytes(), rest...)
+			}()
+
+			target, err := socks5Handshake(server)
+			server.Close()
+			got := <-received
+
+			if tt.target == "" {
+				if err == nil {
+					t.Errorf("应该失败，得到 %q", target)
+				}
+			} else if err != nil || target != tt.target {
+				t.Errorf("目标 = %q %v，期望 %q", target, err, tt.target)
+			}
+			if !bytes.Equal(got, tt.reply) {
+				t.Errorf("客户端收到 %v，期望 %v", got, tt.reply)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package sshclient
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"common_tool/pkg/errorutil"
+	"common_tool/pkg/logutil"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// 主机密钥的校验方式
+// strict     : 只接受 known_hosts 中已经记录的主机
+// accept-new : 第一次连接的主机自动记录到 known_hosts(TOFU)，已经记录的主机必须一致(默认)
+// --insecure 完全不校验
+const (
+	HostKeyStrict    = "strict"
+	HostKeyAcceptNew = "accept-new"
+)
+
+// 并行连接多个主机时防止同时写 known_hosts
+var knownHostsMu sync.Mutex
+
+func knownHostsPath(base CLIOptionsBase) string {
+	if base.KnownHostsFile != "" {
+		return expandHome(base.KnownHostsFile)
+	}
+	return expandHome("~/.ssh/known_hosts")
+}
+
+// 设置 config 的 HostKeyCallback，addr 是 host:port
+// 已经记录过的主机只协商记录中的密钥类型，避免服务端先提供另一种类型的密钥被误判为不一致
+func setHostKeyCheck(base CLIOptionsBase, addr string, config *ssh.ClientConfig) error {
+	if base.Insecure {
+		logutil.Warn("--insecure: 不校验 %s 的主机密钥", addr)
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		return nil
+	}
+
+	mode := base.HostKeyCheck
+	if mode == "" {
+		mode = HostKeyAcceptNew
+	}
+	if mode != HostKeyStrict && mode != HostKeyAcceptNew {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage,
+			fmt.Sprintf("未知的主机密钥校验方式: %q", mode),
+			fmt.Errorf("--host-key-check 只能是 %s / %s", HostKeyStrict, HostKeyAcceptNew))
+	}
+
+	file := knownHostsPath(base)
+	knownHostsMu.Lock()
+	check, err := loadKnownHosts(file)
+	knownHostsMu.Unlock()
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeConfigError, fmt.Sprintf("无法读取 %s", file), err)
+	}
+
+	config.HostKeyAlgorithms = knownAlgorithms(check, addr)
+	config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &keyErr) && len(keyErr.Want) > 0:
+			want := keyErr.Want[0]
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeHostKeyMismatch,
+				fmt.Sprintf("%s 的主机密钥和 %s:%d 中的记录不一致，可能是中间人攻击或者主机已经重装，"+
+					"确认后请删除旧的记录", hostname, want.Filename, want.Line),
+				fmt.Errorf("主机密钥不一致: 收到 %s %s", key.Type(), ssh.FingerprintSHA256(key)))
+		case errors.As(err, &keyErr) && mode == HostKeyAcceptNew:
+			if err := appendKnownHost(file, hostname, remote, key); err != nil {
+				return errorutil.NewExitErrorWithMessage(errorutil.CodeIOError, fmt.Sprintf("无法写入 %s", file), err)
+			}
+			logutil.Info("记录新的主机 %s: %s %s", hostname, key.Type(), ssh.FingerprintSHA256(key))
+			return nil
+		case errors.As(err, &keyErr):
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeHostKeyUnknown,
+				fmt.Sprintf("%s 不在 %s 中(%s %s)", hostname, file, key.Type(), ssh.FingerprintSHA256(key)),
+				err)
+		default:
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeConfigError, fmt.Sprintf("%s 的格式有误", file), err)
+		}
+	}
+	return nil
+}
+
+// 文件不存在时当作空文件
+func loadKnownHosts(file string) (ssh.HostKeyCallback, error) {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return func(string, net.Addr, ssh.PublicKey) error {
+			return &knownhosts.KeyError{}
+		}, nil
+	}
+	return knownhosts.New(file)
+}
+
+// 用一个随机的密钥查询，KeyError.Want 就是记录中这个主机所有的密钥
+func knownAlgorithms(check ssh.HostKeyCallback, addr string) []string {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	probe, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	err = check(addr, &net.TCPAddr{}, probe)
+	if !errors.As(err, &keyErr) || len(keyErr.Want) == 0 {
+		return nil
+	}
+
+	var algos []string
+	seen := map[string]bool{}
+	add := func(names ...string) {
+		for _, n := range names {
+			if !seen[n] {
+				seen[n] = true
+				algos = append(algos, n)
+			}
+		}
+	}
+	for _, k := range keyErr.Want {
+		switch k.Key.Type() {
+		case ssh.KeyAlgoRSA:
+			add(ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		case ssh.CertAlgoRSAv01:
+			add(ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSAv01)
+		default:
+			add(k.Key.Type())
+		}
+	}
+	return algos
+}
+
+func appendKnownHost(file, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	addrs := []string{knownhosts.Normalize(hostname)}
+	// 通过跳板机连接时 remote 是 0.0.0.0:0，不记录
+	if tcp, ok := remote.(*net.TCPAddr); ok && tcp.IP != nil && !tcp.IP.IsUnspecified() {
+		if ip := knownhosts.Normalize(net.JoinHostPort(tcp.IP.String(), fmt.Sprint(tcp.Port))); ip != addrs[0] {
+			addrs = append(addrs, ip)
+		}
+	}
+	_, err = fmt.Fprintln(f, knownhosts.Line(addrs, key))
+	return err
+}
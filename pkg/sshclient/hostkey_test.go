@@ -0,0 +1,159 @@
+package sshclient
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"common_tool/pkg/errorutil"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func testHostKey(t *testing.T, kind string) ssh.PublicKey {
+	t.Helper()
+	var pub any
+	switch kind {
+	case "ed25519":
+		p, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub = p
+	case "ecdsa":
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub = &k.PublicKey
+	case "rsa":
+		k, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub = &k.PublicKey
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// 按 mode 校验 addr 的主机密钥，返回错误的退出码，通过时为 0
+func checkHostKey(t *testing.T, file, mode, addr string, key ssh.PublicKey) int {
+	t.Helper()
+	config := &ssh.ClientConfig{}
+	base := CLIOptionsBase{KnownHostsFile: file, HostKeyCheck: mode}
+	if err := setHostKeyCheck(base, addr, config); err != nil {
+		t.Fatal(err)
+	}
+	err := config.HostKeyCallback(addr, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 22}, key)
+	if err == nil {
+		return 0
+	}
+	var exitErr *errorutil.ExitErrorWithCode
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("错误没有退出码: %v", err)
+	}
+	return exitErr.Code
+}
+
+func TestHostKeyCheck(t *testing.T) {
+	known, other := testHostKey(t, "ed25519"), testHostKey(t, "ed25519")
+	file := writeTestFile(t, t.TempDir(), "known_hosts", knownhosts.Line([]string{"r1.lab"}, known)+"\n")
+
+	tests := []struct {
+		name string
+		mode string
+		addr string
+		key  ssh.PublicKey
+		want int
+	}{
+		{"strict 密钥一致", HostKeyStrict, "r1.lab:22", known, 0},
+		{"strict 密钥不一致", HostKeyStrict, "r1.lab:22", other, errorutil.CodeHostKeyMismatch},
+		{"strict 未知的主机", HostKeyStrict, "r2.lab:22", known, errorutil.CodeHostKeyUnknown},
+		{"accept-new 密钥不一致", HostKeyAcceptNew, "r1.lab:22", other, errorutil.CodeHostKeyMismatch},
+		{"端口不同是不同的主机", HostKeyStrict, "r1.lab:2222", known, errorutil.CodeHostKeyUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkHostKey(t, file, tt.mode, tt.addr, tt.key); got != tt.want {
+				t.Errorf("退出码 = %d，期望 %d", got, tt.want)
+			}
+		})
+	}
+
+	base := CLIOptionsBase{KnownHostsFile: file, HostKeyCheck: "sometimes"}
+	if err := setHostKeyCheck(base, "r1.lab:22", &ssh.ClientConfig{}); err == nil {
+		t.Errorf("未知的校验方式应该报错")
+	}
+}
+
+func TestHostKeyAcceptNew(t *testing.T) {
+	// known_hosts 和所在的目录都不存在
+	file := filepath.Join(t.TempDir(), "ssh", "known_hosts")
+	key, changed := testHostKey(t, "ed25519"), testHostKey(t, "ed25519")
+
+	if got := checkHostKey(t, file, HostKeyAcceptNew, "r1.lab:22", key); got != 0 {
+		t.Fatalf("第一次连接的退出码 = %d", got)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != 1 {
+		t.Fatalf("应该追加一行，得到 %d 行: %s", n, data)
+	}
+
+	// 记录后同一个密钥通过，不再追加；换了密钥被拒绝
+	if got := checkHostKey(t, file, HostKeyStrict, "r1.lab:22", key); got != 0 {
+		t.Errorf("记录后 strict 的退出码 = %d", got)
+	}
+	if got := checkHostKey(t, file, HostKeyAcceptNew, "r1.lab:22", key); got != 0 {
+		t.Errorf("再次连接的退出码 = %d", got)
+	}
+	if got := checkHostKey(t, file, HostKeyAcceptNew, "r1.lab:22", changed); got != errorutil.CodeHostKeyMismatch {
+		t.Errorf("密钥改变后的退出码 = %d，期望 %d", got, errorutil.CodeHostKeyMismatch)
+	}
+	if after, _ := os.ReadFile(file); !bytes.Equal(after, data) {
+		t.Errorf("known_hosts 被修改: %s", after)
+	}
+}
+
+func TestKnownAlgorithms(t *testing.T) {
+	ecKey, rsaKey := testHostKey(t, "ecdsa"), testHostKey(t, "rsa")
+	file := writeTestFile(t, t.TempDir(), "known_hosts",
+		knownhosts.Line([]string{"ec.lab"}, ecKey)+"\n"+
+			knownhosts.Line([]string{"both.lab"}, rsaKey)+"\n"+
+			knownhosts.Line([]string{"both.lab"}, ecKey)+"\n")
+
+	tests := []struct {
+		addr string
+		want []string
+	}{
+		{"ec.lab:22", []string{ssh.KeyAlgoECDSA256}},
+		{"both.lab:22", []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA, ssh.KeyAlgoECDSA256}},
+		// 没有记录时不限制，由服务端和客户端协商
+		{"new.lab:22", nil},
+	}
+	for _, tt := range tests {
+		config := &ssh.ClientConfig{}
+		if err := setHostKeyCheck(CLIOptionsBase{KnownHostsFile: file}, tt.addr, config); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(config.HostKeyAlgorithms, tt.want) {
+			t.Errorf("%s 的密钥类型 = %q，期望 %q", tt.addr, config.HostKeyAlgorithms, tt.want)
+		}
+	}
+}
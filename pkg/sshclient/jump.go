@@ -0,0 +1,104 @@
+package sshclient
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"common_tool/pkg/errorutil"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 跳板机的参数从命令行的参数复制，主机、端口、用户来自 --jump，
+// 没有指定的参数按跳板机自己的主机配置填充，再没有时端口为 22、用户和命令行相同
+// 命令行中明确指定的认证参数(比如 -P -i)对所有跳板机都有效，
+// 目标的主机配置中的密码、私钥、主机密钥等参数不用于跳板机
+func (base CLIOptionsBase) jumpHosts() ([]CLIOptionsBase, error) {
+	spec := strings.TrimSpace(base.Jump)
+	if spec == "" || strings.EqualFold(spec, "none") {
+		return nil, nil
+	}
+
+	var hops []CLIOptionsBase
+	for _, item := range strings.Split(spec, ",") {
+		user, host, port, err := parseHostSpec(strings.TrimSpace(item))
+		if err != nil {
+			return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage,
+				fmt.Sprintf("跳板机的格式有误: %q", item), err)
+		}
+
+		hop := base
+		if base.cli != nil {
+			hop = *base.cli
+			hop.noPrompt = base.noPrompt
+		}
+		hop.Host, hop.Port, hop.Jump = host, "22", ""
+		// 跳板机配置中的 ProxyJump 不再展开，链路只由 --jump 决定
+		set := map[string]bool{"jump": true}
+		for name := range base.explicit {
+			switch name {
+			case "host", "port", "user", "jump", "ssh-config", "profile-file":
+			default:
+				set[name] = true
+			}
+		}
+		if user != "" {
+			hop.User = user
+			set["user"] = true
+		}
+		if port != "" {
+			hop.Port = port
+			set["port"] = true
+		}
+		if err := hop.applyHostConfig(set); err != nil {
+			return nil, err
+		}
+		hops = append(hops, hop)
+	}
+	return hops, nil
+}
+
+// [user@]host[:port]，IPv6 地址带端口时写成 [::1]:22
+func parseHostSpec(s string) (user, host, port string, err error) {
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		user, s = s[:i], s[i+1:]
+	}
+	host = s
+	if strings.HasPrefix(s, "[") || strings.Count(s, ":") == 1 {
+		if host, port, err = net.SplitHostPort(s); err != nil {
+			return "", "", "", err
+		}
+	}
+	if host == "" {
+		return "", "", "", fmt.Errorf("缺少主机")
+	}
+	return user, host, port, nil
+}
+
+// 通过已经建立的连接打开到 addr 的 direct-tcpip 通道，在通道上进行 SSH 握手
+func dialThrough(via *ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := via.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// 通道不支持 SetDeadline，超时后直接关闭通道让握手失败
+	var timer *time.Timer
+	if config.Timeout > 0 {
+		timer = time.AfterFunc(config.Timeout, func() { conn.Close() })
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if timer != nil && !timer.Stop() {
+		if err == nil {
+			c.Close()
+		}
+		return nil, fmt.Errorf("ssh: 握手超时(%v)", config.Timeout)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
@@ -0,0 +1,107 @@
+package sshclient
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// 和命令行一样解析参数并填充主机配置
+func parseBaseFlags(t *testing.T, args ...string) CLIOptionsBase {
+	t.Helper()
+	base := CLIOptionsBase{}
+	cmd := &cobra.Command{}
+	bindCommonSSHFlags(cmd, &base)
+	if err := cmd.Flags().Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.resolveHost(cmd.Flags()); err != nil {
+		t.Fatal(err)
+	}
+	return base
+}
+
+func TestJumpHostsIgnoreTargetProfile(t *testing.T) {
+	dir := t.TempDir()
+	profiles := writeTestFile(t, dir, "profiles.json", `{
+		"t1": {"host": "10.0.0.1", "user": "tuser", "password": "tpw", "identity": ["/t_id"],
+		       "known_hosts": "/t_kh", "host_key_check": "strict", "jump": "gw,admin@gw2:2200"},
+		"gw": {"host": "gw.lab", "user": "gwuser", "identity": ["/gw_id"]}
+	}`)
+
+	tests := []struct {
+		name string
+		args []string
+		want []CLIOptionsBase
+	}{
+		{"跳板机只使用自己的配置", nil, []CLIOptionsBase{
+			{Host: "gw.lab", Port: "22", User: "gwuser", IdentityFiles: []string{"/gw_id"}, HostKeyCheck: HostKeyAcceptNew},
+			{Host: "gw2", Port: "2200", User: "admin", HostKeyCheck: HostKeyAcceptNew},
+		}},
+		{"命令行的认证参数对跳板机有效", []string{"-P", "cli", "-i", "/cli_id", "--known-hosts", "/cli_kh"}, []CLIOptionsBase{
+			{Host: "gw.lab", Port: "22", User: "gwuser", Password: "cli", IdentityFiles: []string{"/cli_id"}, KnownHostsFile: "/cli_kh", HostKeyCheck: HostKeyAcceptNew},
+			{Host: "gw2", Port: "2200", User: "admin", Password: "cli", IdentityFiles: []string{"/cli_id"}, KnownHostsFile: "/cli_kh", HostKeyCheck: HostKeyAcceptNew},
+		}},
+		{"命令行的用户名用于没有配置的跳板机", []string{"-U", "me", "-p", "2022"}, []CLIOptionsBase{
+			{Host: "gw.lab", Port: "22", User: "gwuser", IdentityFiles: []string{"/gw_id"}, HostKeyCheck: HostKeyAcceptNew},
+			{Host: "gw2", Port: "2200", User: "admin", HostKeyCheck: HostKeyAcceptNew},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-H", "t1", "--profile-file", profiles, "--ssh-config", "none"}, tt.args...)
+			base := parseBaseFlags(t, args...)
+			// 目标自己仍然使用主机配置
+			if base.Host != "10.0.0.1" || base.KnownHostsFile == "" || len(base.IdentityFiles) == 0 {
+				t.Fatalf("目标没有使用主机配置: %+v", base)
+			}
+
+			hops, err := base.jumpHosts()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(hops) != len(tt.want) {
+				t.Fatalf("跳板机数量 = %d，期望 %d", len(hops), len(tt.want))
+			}
+			for i, hop := range hops {
+				want := tt.want[i]
+				if hop.Host != want.Host || hop.Port != want.Port || hop.User != want.User ||
+					hop.Password != want.Password || hop.KnownHostsFile != want.KnownHostsFile ||
+					hop.HostKeyCheck != want.HostKeyCheck || hop.Jump != "" ||
+					len(hop.IdentityFiles) != len(want.IdentityFiles) ||
+					(len(want.IdentityFiles) > 0 && hop.IdentityFiles[0] != want.IdentityFiles[0]) {
+					t.Errorf("跳板机 %d = %+v\n期望       %+v", i, hop, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseHostSpec(t *testing.T) {
+	tests := []struct {
+		spec             string
+		user, host, port string
+		err              bool
+	}{
+		{"h", "", "h", "", false},
+		{"u@h:2200", "u", "h", "2200", false},
+		{"a@b@h", "a@b", "h", "", false},
+		{"[::1]:22", "", "::1", "22", false},
+		{"::1", "", "::1", "", false},
+		{"u@", "", "", "", true},
+		{"[::1", "", "", "", true},
+	}
+	for _, tt := range tests {
+		user, host, port, err := parseHostSpec(tt.spec)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q 应该报错", tt.spec)
+			}
+			continue
+		}
+		if err != nil || user != tt.user || host != tt.host || port != tt.port {
+			t.Errorf("%q = %q %q %q %v，期望 %q %q %q", tt.spec, user, host, port, err, tt.user, tt.host, tt.port)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package sshclient
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"common_tool/pkg/errorutil"
+)
+
+// 多个主机并行执行时的输出方式
+// stream : 实时输出，每行前面加上 [主机]，stderr 的行输出到 stderr(默认)
+// group  : 全部完成后按主机的顺序分组输出 stdout，stderr 的行加上 [主机] 输出到 stderr
+// json   : 全部完成后输出 JSON 报告
+const (
+	OutputStream = "stream"
+	OutputGroup  = "group"
+	OutputJSON   = "json"
+)
+
+// 每个主机的执行结果，ExitCode 和单个主机执行时进程的退出码相同
+// (远程命令失败时是命令的退出码，其它错误是 errorutil 的错误码)
+type HostResult struct {
+	Host        string `json:"host"`
+	ExitCode    int    `json:"exit_code"`
+	Code        int    `json:"code"`
+	CmdExitCode int    `json:"cmd_exit_code,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Stdout      string `json:"stdout"`
+	Stderr      string `json:"stderr"`
+	DurationMs  int64  `json:"duration_ms"`
+}
+
+// --hosts 和 --hosts-file 中的主机，格式和 --jump 相同: [user@]host[:port]，也可以是主机配置的名字
+func (opts *CLIOptionsCmd) hostList() ([]string, error) {
+	hosts := append([]string{}, opts.Hosts...)
+	if opts.HostsFile != "" {
+		f, err := os.Open(expandHome(opts.HostsFile))
+		if err != nil {
+			return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeMissingInput, "无法读取主机列表文件", err)
+		}
+		defer f.Close()
+		// 每行一个或多个主机，# 后面是注释
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line, _, _ := strings.Cut(scanner.Text(), "#")
+			hosts = append(hosts, strings.Fields(line)...)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeIOError, "无法读取主机列表文件", err)
+		}
+	}
+
+	var result []string
+	for _, h := range hosts {
+		if h = strings.TrimSpace(h); h != "" {
+			result = append(result, h)
+		}
+	}
+	if len(result) == 0 {
+		return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeMissingInput, "主机列表为空", fmt.Errorf("no hosts"))
+	}
+	return result, nil
+}
+
+// 主机的连接参数，主机中的用户和端口优先于命令行参数，其它和 -H 一样按主机配置填充
+func (opts *CLIOptionsCmd) hostOptions(spec string) (CLIOptionsBase, error) {
+	user, host, port, err := parseHostSpec(spec)
+	if err != nil {
+		return CLIOptionsBase{}, errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage,
+			fmt.Sprintf("主机的格式有误: %q", spec), err)
+	}
+
+	base := opts.CLIOptionsBase
+	base.Host = host
+	base.noPrompt = true
+	set := map[string]bool{}
+	for name := range opts.explicit {
+		set[name] = true
+	}
+	if user != "" {
+		base.User = user
+		set["user"] = true
+	}
+	if port != "" {
+		base.Port = port
+		set["port"] = true
+	}
+	return base, base.applyHostConfig(set)
+}
+
+// 在多个主机上并行执行 opts.Cmd，任何一个主机失败时返回错误:
+// 所有失败的错误码相同时使用这个错误码，否则是 CodeCmdFailed
+func (opts *CLIOptionsCmd) RunParallel() error {
+	if opts.Host != "" {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage,
+			"-H 不能和 --hosts / --hosts-file 一起使用", fmt.Errorf("conflicting flags"))
+	}
+	if opts.Parallel < 1 {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage,
+			fmt.Sprintf("--parallel 必须大于 0: %d", opts.Parallel), fmt.Errorf("invalid parallel"))
+	}
+	switch opts.Output {
+	case OutputStream, OutputGroup, OutputJSON:
+	default:
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage,
+			fmt.Sprintf("未知的输出方式: %q", opts.Output),
+			fmt.Errorf("--output 只能是 %s / %s / %s", OutputStream, OutputGroup, OutputJSON))
+	}
+
+	hosts, err := opts.hostList()
+	if err != nil {
+		return err
+	}
+	width := 0
+	for _, h := range hosts {
+		width = max(width, len(h))
+	}
+
+	results := make([]HostResult, len(hosts))
+	var outMu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.Parallel)
+	for i, spec := range hosts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			var stdout, stderr io.Writer
+			var outBuf, errBuf bytes.Buffer
+			stdout, stderr = &outBuf, &errBuf
+			if opts.Output == OutputStream {
+				prefix := fmt.Sprintf("[%-*s] ", width, spec)
+				outLines := &prefixWriter{mu: &outMu, out: os.Stdout, prefix: prefix}
+				errLines := &prefixWriter{mu: &outMu, out: os.Stderr, prefix: prefix}
+				defer outLines.Flush()
+				defer errLines.Flush()
+				stdout = io.MultiWriter(&outBuf, outLines)
+				stderr = io.MultiWriter(&errBuf, errLines)
+			}
+
+			start := time.Now()
+			err := opts.runOnHost(spec, stdout, stderr)
+			results[i] = HostResult{
+				Host:       spec,
+				Stdout:     outBuf.String(),
+				Stderr:     errBuf.String(),
+				DurationMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				_, exitCode, code := errorutil.FormatErrorAndCode(err)
+				results[i].ExitCode, results[i].Code = exitCode, code
+				results[i].Error = errorutil.RootError(err).Error()
+				if e, ok := err.(*errorutil.ExitErrorWithCode); ok {
+					results[i].CmdExitCode = e.CmdExitCode
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := writeResults(os.Stdout, os.Stderr, opts.Output, results, width); err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeIOError, "输出结果失败", err)
+	}
+	return parallelError(results)
+}
+
+func (opts *CLIOptionsCmd) runOnHost(spec string, stdout, stderr io.Writer) error {
+	base, err := opts.hostOptions(spec)
+	if err != nil {
+		return err
+	}
+	conn, err := createSSHClient(base)
+	if err != nil {
+		return connectError("连接失败", err)
+	}
+	defer conn.Close()
+
+	session, err := conn.NewSession()
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeSSHError, "创建 session 失败", err)
+	}
+	defer session.Close()
+
+	var errBuf bytes.Buffer
+	session.Stdout = stdout
+	session.Stderr = io.MultiWriter(stderr, &errBuf)
+	if err := session.Run(opts.Cmd); err != nil {
+		return remoteCmdError(err, errBuf.String())
+	}
+	return nil
+}
+
+func writeResults(stdout, stderr io.Writer, output string, results []HostResult, width int) error {
+	failed := 0
+	for _, r := range results {
+		if r.Code != errorutil.CodeSuccess {
+			failed++
+		}
+	}
+
+	switch output {
+	case OutputJSON:
+		data, err := json.MarshalIndent(results, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(stdout, string(data))
+		return err
+	case OutputGroup:
+		// stderr 仍然输出到 stderr，和 stream 一样每行前面加上 [主机]
+		var mu sync.Mutex
+		for _, r := range results {
+			fmt.Fprintf(stdout, "===== %s (exit %d, %dms) =====\n", r.Host, r.ExitCode, r.DurationMs)
+			io.WriteString(stdout, r.Stdout)
+			errLines := &prefixWriter{mu: &mu, out: stderr, prefix: fmt.Sprintf("[%-*s] ", width, r.Host)}
+			io.WriteString(errLines, r.Stderr)
+			errLines.Flush()
+			if r.Error != "" {
+				fmt.Fprintf(stderr, "[%-*s] 错误: %s\n", width, r.Host, r.Error)
+			}
+		}
+	default:
+		// 实时输出已经完成，只汇总失败的主机
+		for _, r := range results {
+			if r.Code != errorutil.CodeSuccess {
+				fmt.Fprintf(stderr, "[%-*s] 失败(exit %d): %s\n", width, r.Host, r.ExitCode, r.Error)
+			}
+		}
+	}
+	_, err := fmt.Fprintf(stderr, "共 %d 台主机，成功 %d 台，失败 %d 台\n", len(results), len(results)-failed, failed)
+	return err
+}
+
+func parallelError(results []HostResult) error {
+	var failed []string
+	code := errorutil.CodeSuccess
+	for _, r := range results {
+		if r.Code == errorutil.CodeSuccess {
+			continue
+		}
+		failed = append(failed, r.Host)
+		if code == errorutil.CodeSuccess {
+			code = r.Code
+		} else if code != r.Code {
+			code = errorutil.CodeCmdFailed
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return errorutil.NewExitErrorWithMessage(code,
+		fmt.Sprintf("%d/%d 台主机失败: %s", len(failed), len(results), strings.Join(failed, ",")),
+		fmt.Errorf("parallel execution failed"))
+}
+
+// 按行输出，每行前面加上前缀，多个主机共用一个锁，保证行不会交错
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// 输出最后没有换行的部分
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.emit(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+func (w *prefixWriter) emit(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	io.WriteString(w.out, w.prefix)
+	w.out.Write(line)
+}
@@ -0,0 +1,116 @@
+package sshclient
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"common_tool/pkg/errorutil"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &prefixWriter{mu: &sync.Mutex{}, out: &out, prefix: "[h1] "}
+	for _, chunk := range []string{"a\nb", "c\n\nd1", "", "d2"} {
+		if n, err := w.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write(%q) = %d %v", chunk, n, err)
+		}
+	}
+	// 没有换行的部分在 Flush 之前不输出
+	if want := "[h1] a\n[h1] bc\n[h1] \n"; out.String() != want {
+		t.Errorf("Flush 前 = %q，期望 %q", out.String(), want)
+	}
+	w.Flush()
+	w.Flush()
+	if want := "[h1] a\n[h1] bc\n[h1] \n[h1] d1d2\n"; out.String() != want {
+		t.Errorf("Flush 后 = %q，期望 %q", out.String(), want)
+	}
+}
+
+func TestParallelError(t *testing.T) {
+	ok := HostResult{Host: "ok"}
+	failed := func(host string, code int) HostResult {
+		return HostResult{Host: host, Code: code, ExitCode: code}
+	}
+
+	tests := []struct {
+		name    string
+		results []HostResult
+		code    int
+		hosts   string
+	}{
+		{"都成功", []HostResult{ok, ok}, errorutil.CodeSuccess, ""},
+		{"错误码相同", []HostResult{ok, failed("a", errorutil.CodeSSHError), failed("b", errorutil.CodeSSHError)},
+			errorutil.CodeSSHError, "a,b"},
+		{"错误码不同", []HostResult{failed("a", errorutil.CodeSSHError), ok, failed("b", errorutil.CodeHostKeyMismatch)},
+			errorutil.CodeCmdFailed, "a,b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parallelError(tt.results)
+			if tt.code == errorutil.CodeSuccess {
+				if err != nil {
+					t.Errorf("应该成功，得到 %v", err)
+				}
+				return
+			}
+			var exitErr *errorutil.ExitErrorWithCode
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("错误没有退出码: %v", err)
+			}
+			if exitErr.Code != tt.code || !strings.HasSuffix(exitErr.Message, tt.hosts) {
+				t.Errorf("错误 = %d %q，期望 %d，失败的主机 %s", exitErr.Code, exitErr.Message, tt.code, tt.hosts)
+			}
+		})
+	}
+}
+
+func TestHostList(t *testing.T) {
+	file := writeTestFile(t, t.TempDir(), "hosts.txt", `# 机房 A
+r1 root@r2:2200   # 注释
+  bmc1
+
+[::1]:22 # IPv6
+`)
+	opts := &CLIOptionsCmd{Hosts: []string{"cli1", " ", "cli2"}, HostsFile: file}
+	got, err := opts.hostList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"cli1", "cli2", "r1", "root@r2:2200", "bmc1", "[::1]:22"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("主机 = %q，期望 %q", got, want)
+	}
+
+	for _, opts := range []*CLIOptionsCmd{
+		{HostsFile: writeTestFile(t, t.TempDir(), "empty.txt", "# 只有注释\n\n")},
+		{HostsFile: "/nonexistent/hosts.txt"},
+	} {
+		if hosts, err := opts.hostList(); err == nil {
+			t.Errorf("%s 应该报错，得到 %q", opts.HostsFile, hosts)
+		}
+	}
+}
+
+func TestWriteResultsGroup(t *testing.T) {
+	results := []HostResult{
+		{Host: "r1", Stdout: "out1\n", Stderr: "warn1\nwarn2"},
+		{Host: "r22", ExitCode: 2, Code: 2, Stdout: "out2\n", Stderr: "err2\n", Error: "exit 2"},
+	}
+	var stdout, stderr bytes.Buffer
+	if err := writeResults(&stdout, &stderr, OutputGroup, results, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	wantOut := "===== r1 (exit 0, 0ms) =====\nout1\n===== r22 (exit 2, 0ms) =====\nout2\n"
+	if stdout.String() != wantOut {
+		t.Errorf("stdout = %q\n期望     %q", stdout.String(), wantOut)
+	}
+	wantErr := "[r1 ] warn1\n[r1 ] warn2\n[r22] err2\n[r22] 错误: exit 2\n共 2 台主机，成功 1 台，失败 1 台\n"
+	if stderr.String() != wantErr {
+		t.Errorf("stderr = %q\n期望     %q", stderr.String(), wantErr)
+	}
+}
@@ -0,0 +1,212 @@
+package sshclient
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"common_tool/pkg/logutil"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// --preserve 时没有保留的元数据，传输结束后一起输出到 stderr(日志默认写文件，容易看不到)
+type preserveReport struct {
+	items []string
+}
+
+func (r *preserveReport) add(p, what string, err error) {
+	r.items = append(r.items, fmt.Sprintf("%s: %s: %v", p, what, err))
+}
+
+func (r *preserveReport) print() {
+	if r == nil || len(r.items) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\n以下 %d 项元数据没有保留:\n", len(r.items))
+	for _, item := range r.items {
+		fmt.Fprintf(os.Stderr, "  %s\n", item)
+	}
+}
+
+// 设置元数据失败不影响传输: --preserve 时记录到报告中，否则和以前一样只记录警告
+func (t transferOptions) failed(p, what string, err error) {
+	if t.report != nil {
+		t.report.add(p, what, err)
+		return
+	}
+	logutil.Warn("设置文件%s失败: %v", what, err)
+}
+
+// 目录的权限和时间在目录的内容写完后才设置
+type pendingAttrs struct {
+	path string
+	info os.FileInfo
+}
+
+// 设置远端文件的权限和时间，info 是本地文件的信息
+// 不保留元数据时访问时间为当前时间
+func (t transferOptions) setRemoteAttrs(client *sftp.Client, remotePath string, info os.FileInfo) {
+	atime := time.Now()
+	if t.Preserve {
+		if a, ok := localAtime(info); ok {
+			atime = a
+		} else {
+			t.failed(remotePath, "访问时间", fmt.Errorf("无法读取本地文件的访问时间"))
+		}
+	}
+	if err := client.Chmod(remotePath, info.Mode()); err != nil {
+		t.failed(remotePath, "权限", err)
+	}
+	if err := client.Chtimes(remotePath, atime, info.ModTime()); err != nil {
+		t.failed(remotePath, "时间", err)
+	}
+}
+
+// 设置本地文件的权限和时间，info 是远端文件的信息
+func (t transferOptions) setLocalAttrs(localPath string, info os.FileInfo) {
+	atime := time.Now()
+	if t.Preserve {
+		if st, ok := info.Sys().(*sftp.FileStat); ok {
+			atime = time.Unix(int64(st.Atime), 0)
+		} else {
+			t.failed(localPath, "访问时间", fmt.Errorf("远端没有返回访问时间"))
+		}
+	}
+	if err := os.Chmod(localPath, info.Mode()); err != nil {
+		t.failed(localPath, "权限", err)
+	}
+	if err := os.Chtimes(localPath, atime, info.ModTime()); err != nil {
+		t.failed(localPath, "时间", err)
+	}
+}
+
+// 在远端创建和本地相同的符号链接(不跟随链接)，已有的文件或链接先删除，已有的目录不覆盖
+func uploadSymlink(client *sftp.Client, localPath, remotePath string) error {
+	target, err := os.Readlink(localPath)
+	if err != nil {
+		return err
+	}
+	target = filepath.ToSlash(target)
+	if info, err := client.Lstat(remotePath); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("远端 %s 是已有的目录", remotePath)
+		}
+		if err := client.Remove(remotePath); err != nil {
+			return err
+		}
+	}
+	if err := client.Symlink(target, remotePath); err != nil {
+		return err
+	}
+	fmt.Printf("[%s] -> %s\n", remotePath, target)
+	return nil
+}
+
+func downloadSymlink(client *sftp.Client, remotePath, localPath string) error {
+	target, err := client.ReadLink(remotePath)
+	if err != nil {
+		return err
+	}
+	target = filepath.FromSlash(target)
+	if info, err := os.Lstat(localPath); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("本地 %s 是已有的目录", localPath)
+		}
+		if err := os.Remove(localPath); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	if err := os.Symlink(target, localPath); err != nil {
+		return err
+	}
+	fmt.Printf("[%s] -> %s\n", localPath, target)
+	return nil
+}
+
+// scp 协议不能传输符号链接，会按链接指向的文件传输，--preserve 时列出这些链接
+func reportScpSymlinks(report *preserveReport, localPath string) {
+	filepath.Walk(localPath, func(p string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			report.add(p, "符号链接", fmt.Errorf("scp 不能传输符号链接，按链接指向的内容传输，需要时请使用 tftp_send"))
+		}
+		return nil
+	})
+}
+
+// scp_get 前通过 SFTP 记录的远端文件，传输后用来检查哪些元数据没有保留
+// 读取文件会更新远端的访问时间，所以必须在传输前记录
+type scpRemoteEntry struct {
+	// 相对 RemotePath 的路径，RemotePath 本身为 ""
+	rel      string
+	symlink  bool
+	mtime    time.Time
+	atime    time.Time
+	hasAtime bool
+}
+
+func listScpRemote(conn *ssh.Client, remotePath string) ([]scpRemoteEntry, error) {
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var entries []scpRemoteEntry
+	walker := client.Walk(remotePath)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, err
+		}
+		rel, err := RelativeRemotePath(remotePath, walker.Path())
+		if err != nil {
+			return nil, err
+		}
+		if walker.Path() == remotePath {
+			rel = ""
+		}
+		info := walker.Stat()
+		e := scpRemoteEntry{rel: rel, symlink: info.Mode()&os.ModeSymlink != 0, mtime: info.ModTime()}
+		if st, ok := info.Sys().(*sftp.FileStat); ok {
+			e.atime, e.hasAtime = time.Unix(int64(st.Atime), 0), true
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// 和传输前记录的远端文件比较，符号链接和时间不同的文件加入报告
+// localRoot 是 RemotePath 对应的本地路径
+func checkScpReceived(report *preserveReport, entries []scpRemoteEntry, localRoot string) {
+	for _, e := range entries {
+		local := filepath.Join(localRoot, filepath.FromSlash(e.rel))
+		if e.symlink {
+			report.add(local, "符号链接", fmt.Errorf("scp 不能传输符号链接，按链接指向的内容传输，需要时请使用 tftp_get"))
+			continue
+		}
+		info, err := os.Lstat(local)
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Truncate(time.Second).Equal(e.mtime.Truncate(time.Second)) {
+			report.add(local, "修改时间", fmt.Errorf("远端是 %s，本地是 %s",
+				e.mtime.Format(time.DateTime), info.ModTime().Format(time.DateTime)))
+		}
+		if !e.hasAtime {
+			continue
+		}
+		atime, ok := localAtime(info)
+		switch {
+		case !ok:
+			report.add(local, "访问时间", fmt.Errorf("无法读取本地文件的访问时间"))
+		case !atime.Truncate(time.Second).Equal(e.atime):
+			report.add(local, "访问时间", fmt.Errorf("远端是 %s，本地是 %s",
+				e.atime.Format(time.DateTime), atime.Format(time.DateTime)))
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package sshclient
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckScpReceived(t *testing.T) {
+	dir := t.TempDir()
+	file := writeTestFile(t, dir, "f", "x")
+	mtime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.Local)
+	atime := time.Date(2020, 1, 2, 0, 0, 0, 0, time.Local)
+	if err := os.Chtimes(file, atime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, hasAtime := localAtime(info)
+
+	tests := []struct {
+		name    string
+		entries []scpRemoteEntry
+		// 报告中每一项包含的内容
+		want []string
+	}{
+		{"时间都保留了", []scpRemoteEntry{{rel: "f", mtime: mtime, atime: atime, hasAtime: true}}, nil},
+		{"远端没有访问时间", []scpRemoteEntry{{rel: "f", mtime: mtime}}, nil},
+		{"修改时间不同", []scpRemoteEntry{{rel: "f", mtime: mtime.Add(time.Hour), atime: atime, hasAtime: true}},
+			[]string{"f: 修改时间"}},
+		{"访问时间不同", []scpRemoteEntry{{rel: "f", mtime: mtime, atime: atime.Add(time.Hour), hasAtime: true}},
+			[]string{"f: 访问时间"}},
+		{"符号链接", []scpRemoteEntry{{rel: "link", symlink: true}, {rel: "missing", mtime: mtime}},
+			[]string{"link: 符号链接"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 不能读取本地访问时间的系统上，远端有访问时间时总是报告
+			if !hasAtime && tt.entries[0].hasAtime && tt.want == nil {
+				tt.want = []string{"f: 访问时间"}
+			}
+			report := &preserveReport{}
+			checkScpReceived(report, tt.entries, dir)
+			if len(report.items) != len(tt.want) {
+				t.Fatalf("报告 = %q，期望包含 %q", report.items, tt.want)
+			}
+			for i, item := range report.items {
+				if !strings.Contains(item, tt.want[i]) {
+					t.Errorf("报告第 %d 项 = %q，期望包含 %q", i, item, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package sshclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"common_tool/pkg/errorutil"
+	"common_tool/pkg/logutil"
+
+	"github.com/spf13/pflag"
+)
+
+// gobolt 的主机配置文件，-H 指定的名字在文件中时使用其中的配置
+// 文件是一个 JSON 对象，可以用 gobolt json 编辑:
+//
+//	{
+//	  "bmc1": {"host": "10.43.111.20", "port": 50956, "user": "root", "password": "xx"},
+//	  "r1":   {"host": "r1.lab", "identity": ["~/.ssh/id_ed25519"], "jump": "admin@gw:2222"}
+//	}
+//
+//	gobolt json -m w -k file -i ~/.gobolt/ssh_profiles.json -P -s 10.43.111.20 -- bmc1 host
+const defaultProfileFile = "~/.gobolt/ssh_profiles.json"
+
+// 不需要 ~/.ssh/config 时使用 --ssh-config none
+const defaultSSHConfigFile = "~/.ssh/config"
+
+type hostProfile struct {
+	Host         string     `json:"host"`
+	Port         portNumber `json:"port"`
+	User         string     `json:"user"`
+	Password     string     `json:"password"`
+	Identity     []string   `json:"identity"`
+	Passphrase   string     `json:"passphrase"`
+	Cert         string     `json:"cert"`
+	Jump         string     `json:"jump"`
+	Timeout      string     `json:"timeout"`
+	KnownHosts   string     `json:"known_hosts"`
+	HostKeyCheck string     `json:"host_key_check"`
+	AuthOrder    []string   `json:"auth_order"`
+}
+
+// 端口可以写成数字或者字符串
+type portNumber string
+
+func (p *portNumber) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*p = portNumber(s)
+		return nil
+	}
+	var n int
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("port 必须是数字或者字符串")
+	}
+	*p = portNumber(strconv.Itoa(n))
+	return nil
+}
+
+// 读取配置文件，文件不存在时 required 决定是否报错
+func loadProfiles(file string, required bool) (map[string]hostProfile, error) {
+	data, err := os.ReadFile(expandHome(file))
+	if os.IsNotExist(err) && !required {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeMissingInput, fmt.Sprintf("无法读取主机配置文件 %s", file), err)
+	}
+	profiles := map[string]hostProfile{}
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, errorutil.NewExitErrorWithMessage(errorutil.CodeConfigError, fmt.Sprintf("主机配置文件 %s 的格式有误", file), err)
+	}
+	return profiles, nil
+}
+
+// 按 命令行参数 > gobolt 主机配置 > ~/.ssh/config > 参数默认值 的优先级填充 base
+// 只填充命令行中没有指定的参数，-H 的值可以是配置文件中的名字或者 ~/.ssh/config 中的 Host
+func (base *CLIOptionsBase) resolveHost(flags *pflag.FlagSet) error {
+	base.explicit = map[string]bool{}
+	flags.Visit(func(f *pflag.Flag) { base.explicit[f.Name] = true })
+	cli := *base
+	base.cli = &cli
+	return base.applyHostConfig(maps.Clone(base.explicit))
+}
+
+// set 中是已经指定的参数名，填充后的参数也会加入 set
+func (base *CLIOptionsBase) applyHostConfig(set map[string]bool) error {
+	if base.Host == "" {
+		return nil
+	}
+
+	fill := func(name, value string, apply func()) {
+		if value != "" && !set[name] {
+			apply()
+			set[name] = true
+		}
+	}
+
+	profiles, err := loadProfiles(base.ProfileFile, set["profile-file"])
+	if err != nil {
+		return err
+	}
+	if p, ok := profiles[base.Host]; ok {
+		logutil.Debug("使用主机配置 %s: %s", base.Host, base.ProfileFile)
+		if p.Host != "" {
+			base.Host = p.Host
+		}
+		fill("port", string(p.Port), func() { base.Port = string(p.Port) })
+		fill("user", p.User, func() { base.User = p.User })
+		fill("password", p.Password, func() { base.Password = p.Password })
+		fill("passphrase", p.Passphrase, func() { base.Passphrase = p.Passphrase })
+		fill("cert", p.Cert, func() { base.CertFile = p.Cert })
+		fill("known-hosts", p.KnownHosts, func() { base.KnownHostsFile = p.KnownHosts })
+		fill("host-key-check", p.HostKeyCheck, func() { base.HostKeyCheck = p.HostKeyCheck })
+		fill("jump", p.Jump, func() { base.Jump = p.Jump })
+		if len(p.Identity) > 0 {
+			fill("identity", "-", func() { base.IdentityFiles = p.Identity })
+		}
+		if len(p.AuthOrder) > 0 {
+			fill("auth-order", "-", func() { base.AuthOrder = p.AuthOrder })
+		}
+		if p.Timeout != "" && !set["timeout"] {
+			d, err := time.ParseDuration(p.Timeout)
+			if err != nil {
+				return errorutil.NewExitErrorWithMessage(errorutil.CodeConfigError,
+					fmt.Sprintf("主机配置 %s 的 timeout 格式有误", base.ProfileFile), err)
+			}
+			base.Timeout = d
+			set["timeout"] = true
+		}
+	}
+
+	if strings.EqualFold(base.SSHConfigFile, "none") {
+		return nil
+	}
+	file := expandHome(base.SSHConfigFile)
+	h, err := lookupSSHConfig(file, base.Host)
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeConfigError, fmt.Sprintf("无法解析 %s", file), err)
+	}
+	if h.HostName != base.Host {
+		logutil.Debug("%s: %s -> %s", file, base.Host, h.HostName)
+	}
+	base.Host = h.HostName
+	fill("port", h.Port, func() { base.Port = h.Port })
+	fill("user", h.User, func() { base.User = h.User })
+	fill("known-hosts", h.UserKnownHostsFile, func() { base.KnownHostsFile = h.UserKnownHostsFile })
+	fill("jump", h.ProxyJump, func() { base.Jump = h.ProxyJump })
+	if len(h.IdentityFiles) > 0 {
+		fill("identity", "-", func() { base.IdentityFiles = h.IdentityFiles })
+	}
+	// StrictHostKeyChecking: yes / ask 不能交互确认，都按 strict 处理，no / off 不校验
+	switch strings.ToLower(h.StrictHostKeyChecking) {
+	case "yes", "ask":
+		fill("host-key-check", HostKeyStrict, func() { base.HostKeyCheck = HostKeyStrict })
+	case "accept-new":
+		fill("host-key-check", HostKeyAcceptNew, func() { base.HostKeyCheck = HostKeyAcceptNew })
+	case "no", "off":
+		if !set["host-key-check"] {
+			fill("insecure", "-", func() { base.Insecure = true })
+		}
+	}
+	if h.ConnectTimeout != "" && !set["timeout"] {
+		sec, err := strconv.Atoi(h.ConnectTimeout)
+		if err != nil {
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeConfigError,
+				fmt.Sprintf("%s 中 ConnectTimeout 的格式有误", file), err)
+		}
+		base.Timeout = time.Duration(sec) * time.Second
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package sshclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"common_tool/pkg/errorutil"
+	"common_tool/pkg/logutil"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTP 传输(tftp_send / tftp_get)的选项
+type transferOptions struct {
+	// 断点续传: 目标文件已经存在并且不比源文件大时，从目标文件的大小处继续
+	Resume bool
+	// 传输后比较两端的 sha256
+	Verify bool
+	// 保留访问时间，符号链接按链接创建，目录也设置权限和时间
+	Preserve bool
+	// 校验时在这个连接上执行 sha256sum
+	SSH *ssh.Client
+	// Preserve 时记录没有保留的元数据
+	report *preserveReport
+}
+
+// 断点续传的起始位置，partial 是目标文件的信息，不续传时为 0
+func (t transferOptions) resumeOffset(partial os.FileInfo, statErr error, total int64, name string) int64 {
+	if !t.Resume || statErr != nil || !partial.Mode().IsRegular() {
+		return 0
+	}
+	if partial.Size() > total {
+		logutil.Warn("%s 已有的部分(%d)比源文件(%d)大，重新传输", name, partial.Size(), total)
+		return 0
+	}
+	if partial.Size() > 0 {
+		logutil.Info("%s 从 %s 处继续传输", name, humanize.Bytes(uint64(partial.Size())))
+	}
+	return partial.Size()
+}
+
+// offset 为 0 时创建(清空)远端文件，否则打开已有的文件并移动到 offset
+func openRemoteForWrite(client *sftp.Client, remotePath string, offset int64) (*sftp.File, error) {
+	if offset == 0 {
+		return client.Create(remotePath)
+	}
+	f, err := client.OpenFile(remotePath, os.O_WRONLY)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func openLocalForWrite(localPath string, offset int64) (*os.File, error) {
+	if offset == 0 {
+		return os.Create(localPath)
+	}
+	f, err := os.OpenFile(localPath, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// 比较本地文件和远端文件的 sha256，不一致时返回 CodeChecksumMismatch
+// 本地文件直接读取计算，远端文件优先在远端执行 sha256sum，没有 sha256sum 时通过 SFTP 读回来计算
+func (t transferOptions) verifyChecksum(client *sftp.Client, localPath, remotePath string, resumed bool) error {
+	localSum, err := localSHA256(localPath)
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeIOError, fmt.Sprintf("计算本地文件 %s 的 sha256 失败", localPath), err)
+	}
+	remoteSum, err := remoteSHA256(t.SSH, client, remotePath)
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeSSHError, fmt.Sprintf("计算远端文件 %s 的 sha256 失败", remotePath), err)
+	}
+
+	if localSum != remoteSum {
+		msg := fmt.Sprintf("%s 传输后校验失败: 本地 sha256 %s，远端 %s", remotePath, localSum, remoteSum)
+		if resumed {
+			msg += "，续传前已有的部分可能和源文件不同，请去掉 --resume 重新传输"
+		}
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeChecksumMismatch, msg, fmt.Errorf("sha256 mismatch"))
+	}
+	fmt.Printf("[%s] sha256 OK: %s\n", remotePath, localSum)
+	return nil
+}
+
+func localSHA256(localPath string) (string, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func remoteSHA256(conn *ssh.Client, client *sftp.Client, remotePath string) (string, error) {
+	if conn != nil {
+		sum, err := remoteSHA256Sum(conn, remotePath)
+		if err == nil {
+			return sum, nil
+		}
+		logutil.Debug("远端 sha256sum 不可用(%v)，通过 SFTP 读取远端文件计算", err)
+	}
+
+	f, err := client.Open(remotePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := f.WriteTo(h); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func remoteSHA256Sum(conn *ssh.Client, remotePath string) (string, error) {
+	session, err := conn.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	out, err := session.Output("sha256sum " + shellQuote(remotePath))
+	if err != nil {
+		return "", err
+	}
+	// 文件名中有反斜杠或者换行时 sha256sum 在行首加上 \
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("sha256sum 没有输出")
+	}
+	sum := strings.ToLower(strings.TrimPrefix(fields[0], `\`))
+	if _, err := hex.DecodeString(sum); err != nil || len(sum) != sha256.Size*2 {
+		return "", fmt.Errorf("无法解析 sha256sum 的输出: %q", out)
+	}
+	return sum, nil
+}
+
+// POSIX sh 的单引号转义，远端的 shell 不一定是 bash
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
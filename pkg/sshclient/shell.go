@@ -0,0 +1,160 @@
+package sshclient
+
+import (
+	"io"
+	"os"
+
+	"common_tool/pkg/errorutil"
+	"common_tool/pkg/logutil"
+	"common_tool/pkg/sh"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+type CLIOptionsShell struct {
+	CLIOptionsBase
+	// 为空时打开交互式 shell，否则在 PTY 中执行这个命令
+	Cmd string
+	// 远端的 TERM
+	Term string
+}
+
+// 交互式 shell，本地是终端时申请 PTY 并进入 raw 模式，窗口大小变化时通知远端
+// 退出码和 RunRemoteCommand 相同
+func (opts *CLIOptionsShell) RunShell() error {
+	conn, err := createSSHClient(opts.CLIOptionsBase)
+	if err != nil {
+		return connectError("连接失败", err)
+	}
+	defer conn.Close()
+
+	session, err := conn.NewSession()
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeSSHError, "创建 session 失败", err)
+	}
+	defer session.Close()
+
+	inFd, outFd := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if isTerminal(inFd) {
+		width, height, err := terminalSize(outFd)
+		if err != nil {
+			width, height = 80, 24
+		}
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err := session.RequestPty(opts.Term, height, width, modes); err != nil {
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeSSHError, "申请 PTY 失败", err)
+		}
+
+		state, err := makeRaw(inFd)
+		if err != nil {
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeIOError, "无法设置终端为 raw 模式", err)
+		}
+		defer restoreTerm(inFd, state)
+
+		resized := make(chan struct{}, 1)
+		stop := notifyResize(outFd, resized)
+		defer stop()
+		go func() {
+			for range resized {
+				if w, h, err := terminalSize(outFd); err == nil {
+					session.WindowChange(h, w)
+				}
+			}
+		}()
+	} else {
+		logutil.Warn("标准输入不是终端，不申请 PTY")
+	}
+
+	if err := forwardStdin(session); err != nil {
+		return err
+	}
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	if opts.Cmd == "" {
+		if err := session.Shell(); err != nil {
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeSSHError, "启动 shell 失败", err)
+		}
+		err = session.Wait()
+	} else {
+		err = session.Run(opts.Cmd)
+	}
+	if err != nil {
+		return remoteCmdError(err, "")
+	}
+	return nil
+}
+
+// 实时输出远端命令的 stdout / stderr，本地的标准输入转发到远端
+func (opts *CLIOptionsCmd) RunStream() error {
+	conn, err := createSSHClient(opts.CLIOptionsBase)
+	if err != nil {
+		return connectError("连接失败", err)
+	}
+	defer conn.Close()
+
+	session, err := conn.NewSession()
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeSSHError, "创建 session 失败", err)
+	}
+	defer session.Close()
+
+	if err := forwardStdin(session); err != nil {
+		return err
+	}
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+	if err := session.Run(opts.Cmd); err != nil {
+		return remoteCmdError(err, "")
+	}
+	return nil
+}
+
+// 直接设置 session.Stdin 时 Wait 会等到本地的标准输入结束才返回，
+// 所以自己转发，本地输入结束时关闭远端的标准输入，远端命令结束后不再等待
+func forwardStdin(session *ssh.Session) error {
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeSSHError, "无法打开远端的标准输入", err)
+	}
+	go func() {
+		io.Copy(stdin, stdinReader)
+		stdin.Close()
+	}()
+	return nil
+}
+
+func sshShellCmd() *cobra.Command {
+	opts := &CLIOptionsShell{}
+
+	cmd := &cobra.Command{
+		Use:   "shell",
+		Short: "打开远端的交互式 shell，或者在 PTY 中执行 -- 后面的命令",
+		Long: `打开远端的交互式 shell，或者在 PTY 中执行 -- 后面的命令(比如 top vim 这样需要终端的程序)
+本地是终端时申请 PTY，终端进入 raw 模式(Ctrl-C 等按键发送到远端)，窗口大小变化时通知远端
+本地不是终端时不申请 PTY，只转发输入输出
+连接参数和 gobolt ssh cmd 相同，退出码是远端 shell 或者命令的退出码
+举例:
+gobolt ssh shell -H 10.43.111.20 -U root -P xx
+gobolt ssh shell -H bmc1 -J gw1 -- top
+		`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.Cmd = sh.BuildCommandLineQuoted(args)
+			return opts.RunShell()
+		},
+	}
+
+	bindCommonSSHFlags(cmd, &opts.CLIOptionsBase)
+	term := os.Getenv("TERM")
+	if term == "" {
+		term = "xterm-256color"
+	}
+	cmd.Flags().StringVar(&opts.Term, "term", term, "远端的 TERM，默认和本地相同")
+
+	return cmd
+}
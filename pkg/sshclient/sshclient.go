@@ -5,8 +5,10 @@ import (
 	"bytes"
 	"common_tool/pkg/logutil"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
@@ -23,10 +25,9 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-// :TODO: 当前使用 TFTP 获取和发送文件不会保留元数据
-// client.Stat(path)：获取远程文件的元信息（权限、时间戳等）
-// os.Chtimes(localPath, atime, mtime)：设置本地文件的访问时间和修改时间
-// os.Chmod(localPath, mode)：设置本地文件的权限
+// TFTP 获取和发送文件默认保留权限和修改时间，--preserve 时还保留访问时间、目录的权限和时间，
+// 符号链接按链接创建(见 preserve.go)，scp 总是保留权限和时间，但是不能传输符号链接，
+// --preserve 时列出按内容传输的符号链接，scp_get 还列出没有保留的时间
 const (
 	SCP_RECEIVE_FLAG  = "scp_get"
 	SCP_SEND_FLAG     = "scp_send"
@@ -43,11 +44,39 @@ type CLIOptionsBase struct {
 	Timeout  time.Duration
 	User     string
 	Password string
+	// 私钥文件(可以多个)、私钥的密码、证书文件
+	IdentityFiles []string
+	Passphrase    string
+	CertFile      string
+	// 认证方式的尝试顺序
+	AuthOrder []string
+	// known_hosts 文件、主机密钥的校验方式、是否完全不校验
+	KnownHostsFile string
+	HostKeyCheck   string
+	Insecure       bool
+	// gobolt 主机配置文件、ssh config 文件，-H 是其中的名字时使用对应的配置
+	ProfileFile   string
+	SSHConfigFile string
+	// 跳板机 user@host:port，多个用逗号分隔，按顺序连接
+	Jump string
+	// 命令行中指定的参数名，跳板机的配置不覆盖这些参数
+	explicit map[string]bool
+	// 填充主机配置之前的参数(命令行的值和默认值)，跳板机从这里复制
+	cli *CLIOptionsBase
+	// 并行执行时多个连接同时认证，keyboard-interactive 不从标准输入读取回答
+	noPrompt bool
 }
 
 type CLIOptionsCmd struct {
 	CLIOptionsBase
 	Cmd string
+	// 并行执行的主机列表、主机列表文件、最大并发数、输出方式
+	Hosts     []string
+	HostsFile string
+	Parallel  int
+	Output    string
+	// 实时输出并转发标准输入
+	Stream bool
 }
 
 type CLIOptionsTransfer struct {
@@ -55,17 +84,97 @@ type CLIOptionsTransfer struct {
 	LocalPath  string
 	RemotePath string
 	Direction  string
+	// 断点续传、传输后校验 sha256(只用于 SFTP)
+	Resume bool
+	Verify bool
+	// 保留权限、时间和符号链接
+	Preserve bool
 }
 
 // 新增通用连接函数
+// 所有的子命令(包括 scp)都通过这里建立连接，有 --jump 时依次经过跳板机
 func createSSHClient(base CLIOptionsBase) (*ssh.Client, error) {
+	hops, err := base.jumpHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	var jumps []*ssh.Client
+	closeJumps := func() {
+		for i := len(jumps) - 1; i >= 0; i-- {
+			jumps[i].Close()
+		}
+	}
+	var via *ssh.Client
+	for _, hop := range hops {
+		client, err := dialSSH(via, hop)
+		if err != nil {
+			closeJumps()
+			return nil, connectError(fmt.Sprintf("连接跳板机 %s 失败", net.JoinHostPort(hop.Host, hop.Port)), err)
+		}
+		jumps = append(jumps, client)
+		via = client
+	}
+
+	client, err := dialSSH(via, base)
+	if err != nil {
+		closeJumps()
+		return nil, err
+	}
+	// 目标的连接关闭后再关闭跳板机的连接
+	if len(jumps) > 0 {
+		go func() {
+			client.Wait()
+			closeJumps()
+		}()
+	}
+	return client, nil
+}
+
+// via 不为空时通过 via 的 direct-tcpip 通道连接
+func dialSSH(via *ssh.Client, base CLIOptionsBase) (*ssh.Client, error) {
+	auth, cleanup, err := authMethods(base)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	addr := net.JoinHostPort(base.Host, base.Port)
 	config := &ssh.ClientConfig{
-		User:            base.User,
-		Auth:            []ssh.AuthMethod{ssh.Password(base.Password)},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         base.Timeout,
+		User:    base.User,
+		Auth:    auth,
+		Timeout: base.Timeout,
+	}
+	if err := setHostKeyCheck(base, addr, config); err != nil {
+		return nil, err
+	}
+	if via == nil {
+		return ssh.Dial("tcp", addr, config)
+	}
+	return dialThrough(via, addr, config)
+}
+
+// 建立连接时的错误，已经带有退出码的(比如参数错误)保留原来的退出码，其它的按 SSH 错误处理
+func connectError(msg string, err error) error {
+	var exitErr *errorutil.ExitErrorWithCode
+	if errors.As(err, &exitErr) {
+		return errorutil.NewExitErrorWithMessage(exitErr.Code, msg+": "+exitErr.Message, err)
 	}
-	return ssh.Dial("tcp", base.Host+":"+base.Port, config)
+	return errorutil.NewExitErrorWithMessage(errorutil.CodeSSHError, msg, err)
+}
+
+// 在已经建立的连接上创建 SCP 客户端，关闭 SCP 客户端时连接一起关闭
+func createSCPClient(base CLIOptionsBase) (*scp.Client, error) {
+	conn, err := createSSHClient(base)
+	if err != nil {
+		return nil, err
+	}
+	client, err := scp.NewClientFromExistingSSH(conn, &scp.ClientOption{})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
 }
 
 type SSHSFTPClient struct {
@@ -99,7 +208,7 @@ func (c *SSHSFTPClient) Close() {
 func (opts *CLIOptionsCmd) RunRemoteCommand() error {
 	conn, err := createSSHClient(opts.CLIOptionsBase)
 	if err != nil {
-		return fmt.Errorf("连接失败: %w", err)
+		return connectError("连接失败", err)
 	}
 	defer conn.Close()
 
@@ -119,27 +228,10 @@ func (opts *CLIOptionsCmd) RunRemoteCommand() error {
 	err = session.Run(opts.Cmd)
 	output := outputBuf.String() + errorBuf.String()
 	if err != nil {
-		if exitErr, ok := err.(*ssh.ExitError); ok {
-			// 将原始输出打印出来（按流分发）
-			os.Stdout.Write(outputBuf.Bytes())
-			os.Stderr.Write(errorBuf.Bytes())
-
-			return errorutil.NewCmdFailure(
-				exitErr.ExitStatus(),
-				fmt.Sprintf("远程命令失败（ExitCode=%d）：%s", exitErr.ExitStatus(), output),
-				err,
-			)
-		}
-
-		// 非命令失败类型错误，依然打印原始输出
+		// 将原始输出打印出来（按流分发）
 		os.Stdout.Write(outputBuf.Bytes())
 		os.Stderr.Write(errorBuf.Bytes())
-
-		return errorutil.NewExitErrorWithMessage(
-			errorutil.CodeSSHError,
-			fmt.Sprintf("SSH 执行失败: %s", output),
-			err,
-		)
+		return remoteCmdError(err, output)
 	}
 
 	// 成功路径：只打印 stdout
@@ -147,6 +239,24 @@ func (opts *CLIOptionsCmd) RunRemoteCommand() error {
 	return nil
 }
 
+// session.Run 的错误，远程命令的退出码不为 0 时是命令失败，其它是 SSH 错误
+// output 是命令的输出，放在错误信息中，输出已经实时打印时为空
+func remoteCmdError(err error, output string) error {
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		message := fmt.Sprintf("远程命令失败（ExitCode=%d）", exitErr.ExitStatus())
+		if output != "" {
+			message += "：" + output
+		}
+		return errorutil.NewCmdFailure(exitErr.ExitStatus(), message, err)
+	}
+
+	message := "SSH 执行失败"
+	if output != "" {
+		message += ": " + output
+	}
+	return errorutil.NewExitErrorWithMessage(errorutil.CodeSSHError, message, err)
+}
+
 // ./gobolt ssh scp_get -H 10.43.111.20 -U root -P xx -p 50956 -L ./ -R '//home/xx/xx.txt'
 // gitbash 传路径要用 // 不然会被自动转换
 func (opts *CLIOptionsTransfer) SendDirOrFileToRemote() error {
@@ -171,10 +281,19 @@ func (opts *CLIOptionsTransfer) ReceiveDirOrFileFromRemote() error {
 	}
 }
 
+// --preserve 时记录没有保留的元数据，传输结束后输出
+func (opts *CLIOptionsTransfer) transferOptions(conn *ssh.Client) transferOptions {
+	topt := transferOptions{Resume: opts.Resume, Verify: opts.Verify, Preserve: opts.Preserve, SSH: conn}
+	if opts.Preserve {
+		topt.report = &preserveReport{}
+	}
+	return topt
+}
+
 func (opts *CLIOptionsTransfer) sendViaSFTP() error {
 	client, err := createSSHAndSFTP(opts.CLIOptionsBase)
 	if err != nil {
-		return fmt.Errorf("SFTP 初始化失败: %w", err)
+		return connectError("SFTP 初始化失败", err)
 	}
 	defer client.Close()
 
@@ -184,9 +303,16 @@ func (opts *CLIOptionsTransfer) sendViaSFTP() error {
 		return fmt.Errorf("源路径无效: %w", err)
 	}
 
+	topt := opts.transferOptions(client.SSH)
+	defer topt.report.print()
+	if opts.Preserve {
+		if li, err := os.Lstat(opts.LocalPath); err == nil && li.Mode()&os.ModeSymlink != 0 {
+			return uploadSymlink(client.SFTP, opts.LocalPath, opts.RemotePath)
+		}
+	}
 	if info.IsDir() {
 		logutil.Debug("is dir, show LocalPath: %v RemotePath: %v", opts.LocalPath, opts.RemotePath)
-		return uploadDirectory(client.SFTP, opts.LocalPath, opts.RemotePath)
+		return uploadDirectory(client.SFTP, opts.LocalPath, opts.RemotePath, topt)
 	} else {
 		logutil.Debug("is file, show LocalPath: %v RemotePath: %v", opts.LocalPath, opts.RemotePath)
 		// 转换为绝对路径
@@ -196,7 +322,7 @@ func (opts *CLIOptionsTransfer) sendViaSFTP() error {
 		fmt.Println("Uploading from:", absDir)
 		fmt.Println("          to:  ", path.Dir(opts.RemotePath))
 		fmt.Println()
-		return uploadFile(client.SFTP, opts.LocalPath, opts.RemotePath, absDir)
+		return uploadFile(client.SFTP, opts.LocalPath, opts.RemotePath, absDir, topt)
 	}
 }
 
@@ -209,6 +335,8 @@ type ProgressReader struct {
 	startTime         time.Time
 	lastReport        time.Time
 	lastBytesReported int64
+	// 断点续传时已经存在的部分，不计入平均速度
+	offset int64
 }
 
 func (r *ProgressReader) Read(p []byte) (n int, err error) {
@@ -255,7 +383,7 @@ func (r *ProgressReader) printProgress(elapsedSec float64) {
 	totalElapsed := time.Since(r.startTime).Seconds()
 	var avgSpeed float64
 	if totalElapsed > 0 {
-		avgSpeed = float64(r.bytesRead) / totalElapsed / (1024 * 1024)
+		avgSpeed = float64(r.bytesRead-r.offset) / totalElapsed / (1024 * 1024)
 	}
 
 	fmt.Fprintf(os.Stdout,
@@ -290,7 +418,7 @@ func (fw *FlushWriter) Write(p []byte) (n int, err error) {
 // :TODO: 文件的路径太长了，是否可以提取公共前缀？
 // :TODO: 当前TFTP的上传很慢(只有600K)，原因未知
 func uploadFile(
-	client *sftp.Client, localPath, remotePath, srcDir string) error {
+	client *sftp.Client, localPath, remotePath, srcDir string, topt transferOptions) error {
 	// 打开本地文件
 	srcFile, err := os.Open(localPath)
 	if err != nil {
@@ -306,15 +434,23 @@ func uploadFile(
 			"can not get real path from srcDir: %v, localPath: %v", srcDir, localPath)
 	}
 	fileInfo, _ := srcFile.Stat()
+	remoteInfo, statErr := client.Stat(remotePath)
+	offset := topt.resumeOffset(remoteInfo, statErr, fileInfo.Size(), relPath)
+	if _, err := srcFile.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seek local file failed: %w", err)
+	}
 	progressReader := &ProgressReader{
-		Reader:     bufio.NewReaderSize(srcFile, bufferSize),
-		total:      fileInfo.Size(),
-		lastReport: time.Now(),
-		Filename:   relPath,
+		Reader:            bufio.NewReaderSize(srcFile, bufferSize),
+		total:             fileInfo.Size(),
+		lastReport:        time.Now(),
+		Filename:          relPath,
+		bytesRead:         offset,
+		lastBytesReported: offset,
+		offset:            offset,
 	}
 
-	// 创建远程文件
-	dstFile, err := client.Create(remotePath)
+	// 创建远程文件，续传时打开已有的文件
+	dstFile, err := openRemoteForWrite(client, remotePath, offset)
 	if err != nil {
 		return fmt.Errorf("create remote file failed: %w", err)
 	}
@@ -341,44 +477,35 @@ func uploadFile(
 	if err := bufWriter.Flush(); err != nil {
 		return fmt.Errorf("file Flush failed: %w", err)
 	}
-
-	if stat, err := os.Stat(localPath); err == nil {
-		if err := client.Chmod(remotePath, stat.Mode()); err != nil {
-			logutil.Warn("设置文件权限失败: %v", err)
-		}
+	if err := dstFile.Close(); err != nil {
+		return fmt.Errorf("close remote file failed: %w", err)
 	}
 
-	// 保留修改时间
-	if stat, err := os.Stat(localPath); err == nil {
-		mtime := stat.ModTime()
-		atime := time.Now() // 访问时间通常设为当前时间
-		if err := client.Chtimes(remotePath, atime, mtime); err != nil {
-			logutil.Warn("设置文件时间失败: %v", err)
-		}
+	// 保留权限和修改时间，使用读取前的信息(读取会改变访问时间)
+	topt.setRemoteAttrs(client, remotePath, fileInfo)
+
+	if topt.Verify {
+		return topt.verifyChecksum(client, localPath, remotePath, offset > 0)
 	}
 
 	// 文件属性修改失败不报错
 	return nil
 }
 
-// 递归上传目录，忽略符号链接
-func uploadDirectory(client *sftp.Client, srcDir, destDir string) error {
+// 递归上传目录，忽略符号链接(--preserve 时在远端创建相同的链接)
+func uploadDirectory(client *sftp.Client, srcDir, destDir string, topt transferOptions) error {
 	absDir, _ := filepath.Abs(srcDir)
 	fmt.Println()
 	fmt.Println("Uploading from:", absDir)
 	fmt.Println("          to:  ", destDir)
 	fmt.Println()
 
-	return filepath.Walk(srcDir, func(localPath string, info os.FileInfo, err error) error {
+	var dirs []pendingAttrs
+	err := filepath.Walk(srcDir, func(localPath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// 忽略符号链接
-		if info.Mode()&os.ModeSymlink != 0 {
-			return nil
-		}
-
 		relPath, err := filepath.Rel(srcDir, localPath)
 		if err != nil {
 			return fmt.Errorf("计算相对路径失败: %w", err)
@@ -392,13 +519,34 @@ func uploadDirectory(client *sftp.Client, srcDir, destDir string) error {
 			"destDir: %v srcDir: %v localpath: %v relPath: %v remotePath: %v",
 			destDir, srcDir, localPath, relPath, remotePath)
 
+		if info.Mode()&os.ModeSymlink != 0 {
+			if topt.Preserve {
+				if err := uploadSymlink(client, localPath, remotePath); err != nil {
+					topt.failed(remotePath, "符号链接", err)
+				}
+			}
+			return nil
+		}
+
 		if info.IsDir() {
 			logutil.Debug("remotePath: %v, is dir.", remotePath)
+			if topt.Preserve {
+				dirs = append(dirs, pendingAttrs{path: remotePath, info: info})
+			}
 			return client.MkdirAll(remotePath)
 		}
 
-		return uploadFile(client, localPath, remotePath, absDir)
+		return uploadFile(client, localPath, remotePath, absDir, topt)
 	})
+	if err != nil {
+		return err
+	}
+
+	// 写入文件会改变目录的修改时间，所以最后从最深的目录开始设置
+	for i := len(dirs) - 1; i >= 0; i-- {
+		topt.setRemoteAttrs(client, dirs[i].path, dirs[i].info)
+	}
+	return nil
 }
 
 func tryDownloadAsDirectoryViaScp(
@@ -433,13 +581,9 @@ func tryDownloadAsDirectoryViaScp(
 }
 
 func (opts *CLIOptionsTransfer) receiveViaSCP() error {
-	sshConf := scp.NewSSHConfigFromPassword(opts.User, opts.Password)
-	sshConf.HostKeyCallback = ssh.InsecureIgnoreHostKey()
-	sshConf.Timeout = opts.Timeout
-
-	client, err := scp.NewClient(opts.Host+":"+opts.Port, sshConf, &scp.ClientOption{})
+	client, err := createSCPClient(opts.CLIOptionsBase)
 	if err != nil {
-		return fmt.Errorf("创建 SCP 客户端失败: %w", err)
+		return connectError("创建 SCP 客户端失败", err)
 	}
 	defer client.Close()
 
@@ -448,12 +592,31 @@ func (opts *CLIOptionsTransfer) receiveViaSCP() error {
 
 	// logutil.Error("show RemotePath: %v", opts.RemotePath)
 
+	// --preserve 时在传输前记录远端的符号链接和访问时间，传输后检查
+	var report *preserveReport
+	var entries []scpRemoteEntry
+	fileRoot := opts.LocalPath
+	if opts.Preserve {
+		report = &preserveReport{}
+		defer report.print()
+		if entries, err = listScpRemote(client.Client, opts.RemotePath); err != nil {
+			report.add(opts.RemotePath, "符号链接和访问时间", fmt.Errorf("无法通过 SFTP 检查远端: %w", err))
+		}
+		// 拉取文件到已有目录时，文件保存在目录下
+		if fi, err := os.Stat(opts.LocalPath); err == nil && fi.IsDir() {
+			fileRoot = filepath.Join(opts.LocalPath, path.Base(opts.RemotePath))
+		}
+	}
+
 	// 尝试作为目录拉取
 	dirErr := tryDownloadAsDirectoryViaScp(client, opts.RemotePath, opts.LocalPath, &scp.DirTransferOption{
 		Context:      ctx,
 		PreserveProp: true,
 	})
 	if dirErr == nil {
+		if report != nil {
+			checkScpReceived(report, entries, opts.LocalPath)
+		}
 		return nil
 	}
 
@@ -463,6 +626,9 @@ func (opts *CLIOptionsTransfer) receiveViaSCP() error {
 		PreserveProp: true,
 	})
 	if fileErr == nil {
+		if report != nil {
+			checkScpReceived(report, entries, fileRoot)
+		}
 		return nil
 	}
 
@@ -470,13 +636,9 @@ func (opts *CLIOptionsTransfer) receiveViaSCP() error {
 }
 
 func (opts *CLIOptionsTransfer) sendViaSCP() error {
-	sshConf := scp.NewSSHConfigFromPassword(opts.User, opts.Password)
-	sshConf.HostKeyCallback = ssh.InsecureIgnoreHostKey()
-	sshConf.Timeout = opts.Timeout
-
-	client, err := scp.NewClient(opts.Host+":"+opts.Port, sshConf, &scp.ClientOption{})
+	client, err := createSCPClient(opts.CLIOptionsBase)
 	if err != nil {
-		return fmt.Errorf("创建 SCP 客户端失败: %w", err)
+		return connectError("创建 SCP 客户端失败", err)
 	}
 	defer client.Close()
 
@@ -484,6 +646,11 @@ func (opts *CLIOptionsTransfer) sendViaSCP() error {
 	if err != nil {
 		return fmt.Errorf("本地路径无效: %w", err)
 	}
+	if opts.Preserve {
+		report := &preserveReport{}
+		reportScpSymlinks(report, opts.LocalPath)
+		defer report.print()
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
 	defer cancel()
@@ -519,7 +686,7 @@ func (opts *CLIOptionsTransfer) sendViaSCP() error {
 func (opts *CLIOptionsTransfer) receiveViaSFTP() error {
 	client, err := createSSHAndSFTP(opts.CLIOptionsBase)
 	if err != nil {
-		return fmt.Errorf("SFTP 初始化失败: %w", err)
+		return connectError("SFTP 初始化失败", err)
 	}
 	defer client.Close()
 
@@ -528,8 +695,15 @@ func (opts *CLIOptionsTransfer) receiveViaSFTP() error {
 		return fmt.Errorf("远端路径无效: %w", err)
 	}
 
+	topt := opts.transferOptions(client.SSH)
+	defer topt.report.print()
+	if opts.Preserve {
+		if li, err := client.SFTP.Lstat(opts.RemotePath); err == nil && li.Mode()&os.ModeSymlink != 0 {
+			return downloadSymlink(client.SFTP, opts.RemotePath, opts.LocalPath)
+		}
+	}
 	if info.IsDir() {
-		return downloadDirectory(client.SFTP, opts.RemotePath, opts.LocalPath)
+		return downloadDirectory(client.SFTP, opts.RemotePath, opts.LocalPath, topt)
 	}
 
 	localAbsPath, _ := filepath.Abs(opts.LocalPath)
@@ -539,7 +713,7 @@ func (opts *CLIOptionsTransfer) receiveViaSFTP() error {
 	fmt.Println("            to:  ", localAbsDir)
 	fmt.Println()
 
-	return downloadFile(client.SFTP, opts.RemotePath, opts.LocalPath, path.Dir(opts.RemotePath))
+	return downloadFile(client.SFTP, opts.RemotePath, opts.LocalPath, path.Dir(opts.RemotePath), topt)
 }
 
 // RelativeRemotePath 计算 remoteFile 相对于 remoteRootDir 的路径
@@ -558,7 +732,7 @@ func RelativeRemotePath(remoteRootDir, remoteFile string) (string, error) {
 }
 
 func downloadFile(
-	client *sftp.Client, remoteFile, localPath, remoteRootDir string) error {
+	client *sftp.Client, remoteFile, localPath, remoteRootDir string, topt transferOptions) error {
 	srcFile, err := client.Open(remoteFile)
 	if err != nil {
 		return fmt.Errorf("打开远端文件失败: %w", err)
@@ -572,19 +746,29 @@ func downloadFile(
 		return fmt.Errorf("获取远端文件信息失败: %w", err)
 	}
 
+	localInfo, statErr := os.Stat(localPath)
+	offset := topt.resumeOffset(localInfo, statErr, fileInfo.Size(), relRemotePath)
+	if _, err := srcFile.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("移动远端文件的读取位置失败: %w", err)
+	}
+
 	// 进度监控 + 带缓冲的读取器
 	progressReader := &ProgressReader{
-		Reader:     bufio.NewReaderSize(srcFile, bufferSize),
-		total:      fileInfo.Size(),
-		lastReport: time.Now(),
-		Filename:   relRemotePath,
+		Reader:            bufio.NewReaderSize(srcFile, bufferSize),
+		total:             fileInfo.Size(),
+		lastReport:        time.Now(),
+		Filename:          relRemotePath,
+		bytesRead:         offset,
+		lastBytesReported: offset,
+		offset:            offset,
 	}
 
 	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
 		return fmt.Errorf("创建本地目录失败: %w", err)
 	}
 
-	dstFile, err := os.Create(localPath)
+	// 续传时打开已有的文件
+	dstFile, err := openLocalForWrite(localPath, offset)
 	if err != nil {
 		return fmt.Errorf("创建本地文件失败: %w", err)
 	}
@@ -599,24 +783,22 @@ func downloadFile(
 	if err := bufWriter.Flush(); err != nil {
 		return fmt.Errorf("写入缓冲区失败: %w", err)
 	}
-
-	// 还原权限
-	if err := os.Chmod(localPath, fileInfo.Mode()); err != nil {
-		logutil.Warn("设置文件权限失败: %v", err)
+	if err := dstFile.Close(); err != nil {
+		return fmt.Errorf("关闭本地文件失败: %w", err)
 	}
 
-	// 还原时间
-	mtime := fileInfo.ModTime()
-	atime := time.Now()
-	if err := os.Chtimes(localPath, atime, mtime); err != nil {
-		logutil.Warn("设置文件时间失败: %v", err)
+	// 还原权限和时间
+	topt.setLocalAttrs(localPath, fileInfo)
+
+	if topt.Verify {
+		return topt.verifyChecksum(client, localPath, remoteFile, offset > 0)
 	}
 
 	// 文件属性修改失败不报错
 	return nil
 }
 
-func downloadDirectory(client *sftp.Client, remoteDir, localRoot string) error {
+func downloadDirectory(client *sftp.Client, remoteDir, localRoot string, topt transferOptions) error {
 	localAbsDir, _ := filepath.Abs(localRoot)
 	fmt.Println()
 	fmt.Println("Downloading from:", remoteDir)
@@ -639,6 +821,7 @@ func downloadDirectory(client *sftp.Client, remoteDir, localRoot string) error {
 
 	// 遍历远端目录结构
 	logutil.Debug("show localRoot: %v", localRoot)
+	var dirs []pendingAttrs
 	walker := client.Walk(remoteDir)
 	for walker.Step() {
 		if err := walker.Err(); err != nil {
@@ -657,8 +840,14 @@ func downloadDirectory(client *sftp.Client, remoteDir, localRoot string) error {
 			continue
 		}
 
+		// 跳过符号链接，--preserve 时在本地创建相同的链接
 		if info.Mode()&os.ModeSymlink != 0 {
-			continue // 跳过符号链接
+			if topt.Preserve {
+				if err := downloadSymlink(client, remotePath, localPath); err != nil {
+					topt.failed(localPath, "符号链接", err)
+				}
+			}
+			continue
 		}
 
 		if info.IsDir() {
@@ -666,13 +855,25 @@ func downloadDirectory(client *sftp.Client, remoteDir, localRoot string) error {
 			if err := os.MkdirAll(localPath, 0755); err != nil {
 				return fmt.Errorf("创建本地目录失败: %w", err)
 			}
+			if topt.Preserve {
+				dirs = append(dirs, pendingAttrs{path: localPath, info: info})
+			}
 			continue
 		}
 
-		if err := downloadFile(client, remotePath, localPath, remoteDir); err != nil {
+		if err := downloadFile(client, remotePath, localPath, remoteDir, topt); err != nil {
+			// 已经有退出码的错误(比如校验失败)不再包装，保留退出码
+			if errorutil.HasExitCode(err) {
+				return err
+			}
 			return fmt.Errorf("下载文件失败 [%s]: %w", remotePath, err)
 		}
 	}
+
+	// 写入文件会改变目录的修改时间，所以最后从最深的目录开始设置
+	for i := len(dirs) - 1; i >= 0; i-- {
+		topt.setLocalAttrs(dirs[i].path, dirs[i].info)
+	}
 	return nil
 }
 
@@ -680,14 +881,17 @@ func SSHCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "ssh",
 		Short: "远程 SSH 操作",
-		Long:  "通过 SSH 执行命令、发送或获取文件或者目录",
+		Long:  "通过 SSH 执行命令、发送或获取文件或者目录、同步目录",
 	}
 
 	cmd.AddCommand(sshCmdCmd())
+	cmd.AddCommand(sshShellCmd())
+	cmd.AddCommand(sshForwardCmd())
 	cmd.AddCommand(sshTftpSendCmd())
 	cmd.AddCommand(sshTftpReceiveCmd())
 	cmd.AddCommand(sshScpSendCmd())
 	cmd.AddCommand(sshScpReceiveCmd())
+	cmd.AddCommand(sshSyncCmd())
 
 	return cmd
 }
@@ -703,16 +907,72 @@ func sshCmdCmd() *cobra.Command {
 		Long: `执行远端命令，命令跟在最后的 -- 后面，支持命令带参数
 举例:
 gobolt ssh cmd -H 10.43.111.20 -U xx -P xx -p 50956 -- ls -l "/home/"
+
+使用私钥(可以重复 -i，有 <私钥>-cert.pub 时自动使用证书)、ssh-agent(SSH_AUTH_SOCK):
+gobolt ssh cmd -H 10.43.111.20 -U root -i ~/.ssh/id_ed25519 --passphrase xx -- uptime
+gobolt ssh cmd -H 10.43.111.20 -U root --auth-order agent,password -P xx -- uptime
+
+--auth-order 指定认证方式的尝试顺序，默认 publickey,agent,keyboard-interactive,password
+keyboard-interactive 中不回显的问题用 -P 的密码回答，其它问题从终端读取，标准输入不是终端
+或者使用 --hosts 并行执行时不读取
+
+主机密钥按 --known-hosts(默认 ~/.ssh/known_hosts)校验:
+	--host-key-check accept-new  第一次连接的主机自动记录，已经记录的必须一致(默认)
+	--host-key-check strict      只接受已经记录的主机，否则退出码为 75
+	--insecure                   不校验
+密钥和记录不一致(中间人攻击或者主机重装)时退出码为 73，连接失败为 71
+
+-H 可以是主机配置的名字，按 命令行参数 > --profile-file > --ssh-config 的优先级填充参数:
+	--profile-file  gobolt 主机配置(默认 ~/.gobolt/ssh_profiles.json)，JSON 对象，名字对应
+	                host port user password identity passphrase cert timeout known_hosts host_key_check auth_order jump
+	--ssh-config    ssh 配置(默认 ~/.ssh/config)，使用 HostName Port User IdentityFile ProxyJump
+	                UserKnownHostsFile StrictHostKeyChecking ConnectTimeout，none 表示不使用
+gobolt json -m w -k file -i ~/.gobolt/ssh_profiles.json -P -s 10.43.111.20 -- bmc1 host
+gobolt json -m w -k file -i ~/.gobolt/ssh_profiles.json -P -j 50956 -- bmc1 port
+gobolt ssh cmd -H bmc1 -U admin -- uptime
+
+通过跳板机连接(所有子命令都支持)，-J/--jump 按顺序经过每个跳板机，没有指定用户和端口时
+使用跳板机自己的主机配置，否则使用目标的用户和 22 端口，认证参数和目标相同:
+gobolt ssh cmd -J admin@gw1:2222,gw2 -H 192.168.10.5 -U root -P xx -- uptime
+gobolt ssh scp_send -J gw1 -H bmc1 -L ./fw.bin -R /tmp/fw.bin
+
+在多个主机上并行执行(--hosts 和 --hosts-file 可以一起使用，不能和 -H 一起使用):
+gobolt ssh cmd --hosts 10.43.111.20,root@10.43.111.21:50956,bmc1 -U root -P xx -- uptime
+gobolt ssh cmd --hosts-file hosts.txt --parallel 20 --output json -- cat /etc/os-release
+	--parallel  最大并发数，默认 10
+	--output    stream 实时输出，每行前面加上 [主机](默认)
+	            group  全部完成后按主机分组输出，stderr 的行加上 [主机] 输出到 stderr
+	            json   全部完成后输出 JSON 报告: host exit_code code cmd_exit_code error stdout stderr duration_ms
+任何一个主机失败时返回错误，所有失败的错误码相同时使用这个错误码(比如都连接失败时为 71)，否则为 70
+
+默认等命令结束后才输出，--stream 实时输出并转发标准输入，退出码同样是远端命令的退出码:
+tail -f app.log | gobolt ssh cmd -H 10.43.111.20 -U root -P xx --stream -- grep ERROR
+需要终端的程序使用 gobolt ssh shell
 		`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// 获取要执行的命令
 			opts.Cmd = sh.BuildCommandLineQuoted(args)
+			if len(opts.Hosts) > 0 || opts.HostsFile != "" {
+				if opts.Stream {
+					return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage,
+						"--stream 不能和 --hosts / --hosts-file 一起使用，并行执行时使用 --output stream", fmt.Errorf("conflicting flags"))
+				}
+				return opts.RunParallel()
+			}
+			if opts.Stream {
+				return opts.RunStream()
+			}
 			// 连接 SSH，执行命令
 			return opts.RunRemoteCommand()
 		},
 	}
 
 	bindCommonSSHFlags(cmd, &opts.CLIOptionsBase)
+	cmd.Flags().StringSliceVar(&opts.Hosts, "hosts", nil, "在多个主机上并行执行，逗号分隔，[user@]host[:port] 或者主机配置的名字")
+	cmd.Flags().StringVar(&opts.HostsFile, "hosts-file", "", "主机列表文件，每行一个主机，# 后面是注释")
+	cmd.Flags().IntVar(&opts.Parallel, "parallel", 10, "并行执行的最大并发数")
+	cmd.Flags().StringVar(&opts.Output, "output", OutputStream, "并行执行的输出方式(stream|group|json)")
+	cmd.Flags().BoolVar(&opts.Stream, "stream", false, "实时输出远端命令的 stdout / stderr，并把标准输入转发到远端")
 
 	// :TODO: 哪些参数必须带需要检查
 	// 注意检查的时候只需要检查长选项，短选项只是语法糖的作用，长选项和短选项
@@ -723,35 +983,41 @@ gobolt ssh cmd -H 10.43.111.20 -U xx -P xx -p 50956 -- ls -l "/home/"
 }
 
 func sshTftpSendCmd() *cobra.Command {
-	return newSSHTransferCommand(TFTP_SEND_FLAG, "发送 文件/目录 到远端服务器(tftp)", func(opts *CLIOptionsTransfer) error {
+	cmd, opts := newSSHTransferCommand(TFTP_SEND_FLAG, "发送 文件/目录 到远端服务器(tftp)", func(opts *CLIOptionsTransfer) error {
 		opts.Direction = TFTP_SEND_FLAG
 		return opts.SendDirOrFileToRemote()
 	})
+	bindSFTPTransferFlags(cmd, opts)
+	return cmd
 }
 
 func sshTftpReceiveCmd() *cobra.Command {
-	return newSSHTransferCommand(TFTP_RECEIVE_FLAG, "从远端服务器接收 文件/目录(tftp)", func(opts *CLIOptionsTransfer) error {
+	cmd, opts := newSSHTransferCommand(TFTP_RECEIVE_FLAG, "从远端服务器接收 文件/目录(tftp)", func(opts *CLIOptionsTransfer) error {
 		opts.Direction = TFTP_RECEIVE_FLAG
 		return opts.ReceiveDirOrFileFromRemote()
 	})
+	bindSFTPTransferFlags(cmd, opts)
+	return cmd
 }
 
 func sshScpSendCmd() *cobra.Command {
-	return newSSHTransferCommand(SCP_SEND_FLAG, "发送 文件/目录 到远端服务器(scp)", func(opts *CLIOptionsTransfer) error {
+	cmd, _ := newSSHTransferCommand(SCP_SEND_FLAG, "发送 文件/目录 到远端服务器(scp)", func(opts *CLIOptionsTransfer) error {
 		opts.Direction = SCP_SEND_FLAG
 		// 这里也可以加区分逻辑，比如后续区分协议方式
 		return opts.SendDirOrFileToRemote()
 	})
+	return cmd
 }
 
 func sshScpReceiveCmd() *cobra.Command {
-	return newSSHTransferCommand(SCP_RECEIVE_FLAG, "从远端服务器接收 文件/目录(scp)", func(opts *CLIOptionsTransfer) error {
+	cmd, _ := newSSHTransferCommand(SCP_RECEIVE_FLAG, "从远端服务器接收 文件/目录(scp)", func(opts *CLIOptionsTransfer) error {
 		opts.Direction = SCP_RECEIVE_FLAG
 		return opts.ReceiveDirOrFileFromRemote()
 	})
+	return cmd
 }
 
-func newSSHTransferCommand(name, short string, action func(*CLIOptionsTransfer) error) *cobra.Command {
+func newSSHTransferCommand(name, short string, action func(*CLIOptionsTransfer) error) (*cobra.Command, *CLIOptionsTransfer) {
 	opts := &CLIOptionsTransfer{}
 
 	cmd := &cobra.Command{
@@ -765,8 +1031,26 @@ func newSSHTransferCommand(name, short string, action func(*CLIOptionsTransfer)
 	bindCommonSSHFlags(cmd, &opts.CLIOptionsBase)
 	cmd.Flags().StringVarP(&opts.LocalPath, "local", "L", "", "本地 文件/目录 路径")
 	cmd.Flags().StringVarP(&opts.RemotePath, "remote", "R", "", "远端 文件/目录 路径")
+	cmd.Flags().BoolVar(&opts.Preserve, "preserve", false, "保留权限、访问/修改时间，符号链接按链接创建(scp 总是保留权限和时间，不能传输符号链接，加上时列出没有保留的项目)")
 
-	return cmd
+	return cmd, opts
+}
+
+// SFTP 支持按偏移量读写，只有 tftp_send / tftp_get 支持断点续传
+func bindSFTPTransferFlags(cmd *cobra.Command, opts *CLIOptionsTransfer) {
+	cmd.Flags().BoolVar(&opts.Resume, "resume", false, "断点续传，目标文件已经存在并且不比源文件大时从目标文件的大小处继续")
+	cmd.Flags().BoolVar(&opts.Verify, "verify", false, "传输后比较两端的 sha256(远端执行 sha256sum，没有时读回计算)，不一致时退出码为 76")
+	cmd.Long = cmd.Short + `
+--resume 断点续传: 目标文件已经存在并且不比源文件大时，从目标文件的大小处继续写入
+--verify 传输后比较两端的 sha256，远端优先执行 sha256sum，没有 sha256sum 时通过 SFTP 读回来计算，
+         不一致时退出码为 76(续传时建议一起使用，可以发现已有部分和源文件不同的情况)
+--preserve 保留文件和目录的权限、访问时间和修改时间，符号链接按链接创建(不加时跳过目录中的符号链接)，
+         没有保留的项目在传输结束后输出，不影响退出码
+举例:
+gobolt ssh tftp_send -H bmc1 -L ./fw.bin -R /tmp/fw.bin --resume --verify
+gobolt ssh tftp_get -H bmc1 -R /var/log/big.tar -L ./big.tar --resume --verify
+gobolt ssh tftp_send -H bmc1 -L ./rootfs -R /opt/rootfs --preserve
+`
 }
 
 // 通用参数绑定
@@ -776,4 +1060,19 @@ func bindCommonSSHFlags(cmd *cobra.Command, base *CLIOptionsBase) {
 	cmd.Flags().DurationVarP(&base.Timeout, "timeout", "t", 20*time.Second, "连接超时，默认20秒(1s 2m2s 1h32m12s 20ms 这样的格式)")
 	cmd.Flags().StringVarP(&base.User, "user", "U", "", "用户名，默认为空")
 	cmd.Flags().StringVarP(&base.Password, "password", "P", "", "密码，默认为空")
+	cmd.Flags().StringArrayVarP(&base.IdentityFiles, "identity", "i", nil, "私钥文件，可以重复指定多个")
+	cmd.Flags().StringVar(&base.Passphrase, "passphrase", "", "私钥的密码")
+	cmd.Flags().StringVar(&base.CertFile, "cert", "", "证书文件，默认使用私钥同目录下的 <私钥>-cert.pub")
+	cmd.Flags().StringVar(&base.KnownHostsFile, "known-hosts", "", "known_hosts 文件，默认 ~/.ssh/known_hosts")
+	cmd.Flags().StringVar(&base.HostKeyCheck, "host-key-check", HostKeyAcceptNew, "主机密钥校验方式(strict|accept-new)，accept-new 自动记录第一次连接的主机")
+	cmd.Flags().BoolVar(&base.Insecure, "insecure", false, "不校验主机密钥(不安全)")
+	cmd.Flags().StringSliceVar(&base.AuthOrder, "auth-order", defaultAuthOrder, "认证方式的尝试顺序(publickey,agent,keyboard-interactive,password)")
+	cmd.Flags().StringVar(&base.ProfileFile, "profile-file", defaultProfileFile, "gobolt 主机配置文件(JSON)")
+	cmd.Flags().StringVar(&base.SSHConfigFile, "ssh-config", defaultSSHConfigFile, "ssh 配置文件，none 表示不使用")
+	cmd.Flags().StringVarP(&base.Jump, "jump", "J", "", "跳板机 user@host:port，多个用逗号分隔，按顺序连接")
+
+	// 参数解析完成后按主机配置填充没有指定的参数
+	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		return base.resolveHost(cmd.Flags())
+	}
 }
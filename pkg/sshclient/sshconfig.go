@@ -0,0 +1,231 @@
+package sshclient
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"common_tool/pkg/logutil"
+)
+
+// ~/.ssh/config 中 gobolt 使用的配置项，没有出现的是空值
+// 和 ssh 一样，单值的配置项以第一次匹配到的为准，IdentityFile 累加
+type sshConfigHost struct {
+	HostName              string
+	Port                  string
+	User                  string
+	IdentityFiles         []string
+	ProxyJump             string
+	UserKnownHostsFile    string
+	StrictHostKeyChecking string
+	ConnectTimeout        string
+}
+
+type sshConfigEntry struct {
+	key  string
+	args []string
+}
+
+type sshConfigBlock struct {
+	patterns []string
+	// Match 块不支持，总是不匹配
+	match   bool
+	entries []sshConfigEntry
+}
+
+// 最多展开的 Include 层数，防止循环包含
+const maxSSHConfigDepth = 16
+
+// 读取 ssh config，文件不存在时返回空配置
+func parseSSHConfigFile(file string, depth int) ([]sshConfigBlock, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Host 之前的配置对所有主机生效
+	blocks := []sshConfigBlock{{patterns: []string{"*"}}}
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, args, err := splitSSHConfigLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, lineNo, err)
+		}
+		switch key {
+		case "host":
+			blocks = append(blocks, sshConfigBlock{patterns: args})
+		case "match":
+			logutil.Debug("%s:%d: 不支持 Match，跳过这个块", file, lineNo)
+			blocks = append(blocks, sshConfigBlock{match: true})
+		case "include":
+			if depth >= maxSSHConfigDepth {
+				return nil, fmt.Errorf("%s:%d: Include 层数太多", file, lineNo)
+			}
+			// 被包含文件中 Host 之前的配置属于当前的块，文件结束后恢复当前的块
+			current := blocks[len(blocks)-1]
+			for _, pattern := range args {
+				pattern = expandHome(pattern)
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(expandHome("~/.ssh"), pattern)
+				}
+				files, _ := filepath.Glob(pattern)
+				for _, inc := range files {
+					included, err := parseSSHConfigFile(inc, depth+1)
+					if err != nil {
+						return nil, err
+					}
+					if len(included) == 0 {
+						continue
+					}
+					last := &blocks[len(blocks)-1]
+					last.entries = append(last.entries, included[0].entries...)
+					if len(included) > 1 {
+						blocks = append(blocks, included[1:]...)
+						blocks = append(blocks, sshConfigBlock{patterns: current.patterns, match: current.match})
+					}
+				}
+			}
+		default:
+			blocks[len(blocks)-1].entries = append(blocks[len(blocks)-1].entries, sshConfigEntry{key: key, args: args})
+		}
+	}
+	return blocks, scanner.Err()
+}
+
+// Keyword value 或者 Keyword=value，值可以用双引号包含空格
+func splitSSHConfigLine(line string) (string, []string, error) {
+	key, rest := line, ""
+	if i := strings.IndexAny(line, " \t="); i >= 0 {
+		key = line[:i]
+		rest = strings.TrimPrefix(strings.TrimLeft(line[i:], " \t"), "=")
+	}
+
+	var args []string
+	var cur strings.Builder
+	inQuote, hasArg := false, false
+	for _, r := range rest {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			hasArg = true
+		case (r == ' ' || r == '\t') && !inQuote:
+			if hasArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				hasArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			hasArg = true
+		}
+	}
+	if inQuote {
+		return "", nil, fmt.Errorf("引号没有结束")
+	}
+	if hasArg {
+		args = append(args, cur.String())
+	}
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("%s 缺少参数", key)
+	}
+	return strings.ToLower(key), args, nil
+}
+
+// 任意一个模式匹配并且没有 ! 开头的模式匹配
+func (b sshConfigBlock) matches(host string) bool {
+	if b.match {
+		return false
+	}
+	matched := false
+	for _, p := range b.patterns {
+		negated := strings.HasPrefix(p, "!")
+		ok, _ := path.Match(strings.ToLower(strings.TrimPrefix(p, "!")), strings.ToLower(host))
+		if ok && negated {
+			return false
+		}
+		matched = matched || ok
+	}
+	return matched
+}
+
+// 查找 alias 对应的配置
+func lookupSSHConfig(file, alias string) (*sshConfigHost, error) {
+	blocks, err := parseSSHConfigFile(file, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &sshConfigHost{}
+	for _, b := range blocks {
+		if !b.matches(alias) {
+			continue
+		}
+		for _, e := range b.entries {
+			first := func(field *string) {
+				if *field == "" {
+					*field = e.args[0]
+				}
+			}
+			switch e.key {
+			case "hostname":
+				first(&h.HostName)
+			case "port":
+				first(&h.Port)
+			case "user":
+				first(&h.User)
+			case "identityfile":
+				h.IdentityFiles = append(h.IdentityFiles, e.args[0])
+			case "proxyjump":
+				first(&h.ProxyJump)
+			case "userknownhostsfile":
+				first(&h.UserKnownHostsFile)
+			case "stricthostkeychecking":
+				first(&h.StrictHostKeyChecking)
+			case "connecttimeout":
+				first(&h.ConnectTimeout)
+			}
+		}
+	}
+
+	// HostName 中的 %h 是别名，其它配置中的 %h 是真正的主机名
+	h.HostName = expandSSHTokens(h.HostName, alias, "", "")
+	if h.HostName == "" {
+		h.HostName = alias
+	}
+	for i, f := range h.IdentityFiles {
+		h.IdentityFiles[i] = expandSSHTokens(f, h.HostName, h.Port, h.User)
+	}
+	h.UserKnownHostsFile = expandSSHTokens(h.UserKnownHostsFile, h.HostName, h.Port, h.User)
+	return h, nil
+}
+
+// 支持 %h %p %r %u %d %%
+func expandSSHTokens(s, host, port, remoteUser string) string {
+	if !strings.Contains(s, "%") {
+		return expandHome(s)
+	}
+	localUser, home := "", ""
+	if u, err := user.Current(); err == nil {
+		localUser, home = u.Username, u.HomeDir
+	}
+	if port == "" {
+		port = "22"
+	}
+	r := strings.NewReplacer("%%", "%", "%h", host, "%p", port, "%r", remoteUser, "%u", localUser, "%d", home)
+	return expandHome(r.Replace(s))
+}
@@ -0,0 +1,232 @@
+package sshclient
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestSplitSSHConfigLine(t *testing.T) {
+	tests := []struct {
+		line string
+		key  string
+		args []string
+		err  bool
+	}{
+		{"Host a b", "host", []string{"a", "b"}, false},
+		{"HostName\t10.0.0.1", "hostname", []string{"10.0.0.1"}, false},
+		{"User=root", "user", []string{"root"}, false},
+		{"User = root", "user", []string{"root"}, false},
+		{`IdentityFile "~/my keys/id" other`, "identityfile", []string{"~/my keys/id", "other"}, false},
+		{`IdentityFile a"b c"d`, "identityfile", []string{"ab cd"}, false},
+		{`User ""`, "user", []string{""}, false},
+		{`IdentityFile "~/id`, "", nil, true},
+		{"Port", "", nil, true},
+		{"Port =", "", nil, true},
+	}
+	for _, tt := range tests {
+		key, args, err := splitSSHConfigLine(tt.line)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q 应该报错，得到 %q %q", tt.line, key, args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q 失败: %v", tt.line, err)
+			continue
+		}
+		if key != tt.key || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%q = %q %q，期望 %q %q", tt.line, key, args, tt.key, tt.args)
+		}
+	}
+}
+
+func TestSSHConfigBlockMatches(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		host     string
+		want     bool
+	}{
+		{[]string{"*"}, "any", true},
+		{[]string{"web?"}, "web1", true},
+		{[]string{"web?"}, "web10", false},
+		{[]string{"WEB*"}, "web1.lab", true},
+		{[]string{"web*", "!web-bad"}, "web-bad", false},
+		{[]string{"!web-bad", "web*"}, "web-bad", false},
+		{[]string{"!web-bad"}, "db", false},
+		{[]string{"db", "10.0.0.*"}, "10.0.0.5", true},
+	}
+	for _, tt := range tests {
+		if got := (sshConfigBlock{patterns: tt.patterns}).matches(tt.host); got != tt.want {
+			t.Errorf("%q 匹配 %q = %v，期望 %v", tt.patterns, tt.host, got, tt.want)
+		}
+	}
+	if (sshConfigBlock{patterns: []string{"*"}, match: true}).matches("any") {
+		t.Errorf("Match 块不应该匹配")
+	}
+}
+
+func TestLookupSSHConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "inc.conf", `ConnectTimeout 5
+Host db
+  HostName 10.0.0.5
+  User dbuser
+`)
+	config := writeTestFile(t, dir, "config", `# 注释
+User global
+Include `+filepath.Join(dir, "inc*.conf")+`
+Host web* !web-bad
+  HostName %h.lab
+  Port 2201
+  IdentityFile ~/.ssh/%r@%h:%p
+  IdentityFile "/keys/with space"
+Host *
+  Port 22
+  User other
+  UserKnownHostsFile /kh/%h_%p_%%
+Match host *
+  User matched
+`)
+
+	tests := []struct {
+		alias string
+		want  sshConfigHost
+	}{
+		{"web1", sshConfigHost{
+			HostName:           "web1.lab",
+			Port:               "2201",
+			User:               "global",
+			IdentityFiles:      []string{expandHome("~/.ssh/global@web1.lab:2201"), "/keys/with space"},
+			UserKnownHostsFile: "/kh/web1.lab_2201_%",
+			ConnectTimeout:     "5",
+		}},
+		{"web-bad", sshConfigHost{
+			HostName:           "web-bad",
+			Port:               "22",
+			User:               "global",
+			UserKnownHostsFile: "/kh/web-bad_22_%",
+			ConnectTimeout:     "5",
+		}},
+		// 和 ssh 一样以第一次出现的为准，文件开头的 User 优先于 Host db 中的 User
+		{"db", sshConfigHost{
+			HostName:           "10.0.0.5",
+			Port:               "22",
+			User:               "global",
+			UserKnownHostsFile: "/kh/10.0.0.5_22_%",
+			ConnectTimeout:     "5",
+		}},
+	}
+	for _, tt := range tests {
+		h, err := lookupSSHConfig(config, tt.alias)
+		if err != nil {
+			t.Fatalf("%s 失败: %v", tt.alias, err)
+		}
+		if !reflect.DeepEqual(*h, tt.want) {
+			t.Errorf("%s = %+v\n期望   %+v", tt.alias, *h, tt.want)
+		}
+	}
+}
+
+func TestLookupSSHConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	h, err := lookupSSHConfig(filepath.Join(dir, "missing"), "r1")
+	if err != nil || h.HostName != "r1" {
+		t.Errorf("文件不存在时应该返回空配置，得到 %+v %v", h, err)
+	}
+
+	loop := filepath.Join(dir, "loop")
+	writeTestFile(t, dir, "loop", "Include "+loop+"\n")
+	if _, err := lookupSSHConfig(loop, "r1"); err == nil || !strings.Contains(err.Error(), "Include") {
+		t.Errorf("循环 Include 应该报错，得到 %v", err)
+	}
+
+	bad := writeTestFile(t, dir, "bad", "Host r1\n  HostName \"x\n")
+	if _, err := lookupSSHConfig(bad, "r1"); err == nil || !strings.Contains(err.Error(), bad+":2") {
+		t.Errorf("错误应该包含文件名和行号，得到 %v", err)
+	}
+}
+
+func TestApplyHostConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	profiles := writeTestFile(t, dir, "profiles.json", `{
+		"r1": {"host": "r1.lab", "user": "puser", "password": "ppw", "identity": ["/p_id"], "timeout": "3s"}
+	}`)
+	config := writeTestFile(t, dir, "config", `Host r1.lab c1
+  Port 2200
+  User cuser
+  IdentityFile /c_id
+  StrictHostKeyChecking no
+  ConnectTimeout 7
+  ProxyJump gw
+`)
+
+	defaults := func() CLIOptionsBase {
+		return CLIOptionsBase{Port: "22", Timeout: 10 * time.Second, HostKeyCheck: HostKeyAcceptNew,
+			ProfileFile: profiles, SSHConfigFile: config}
+	}
+
+	tests := []struct {
+		name  string
+		host  string
+		flags map[string]string
+		want  CLIOptionsBase
+	}{
+		{"主机配置优先于 ssh config", "r1", nil, CLIOptionsBase{
+			Host: "r1.lab", Port: "2200", User: "puser", Password: "ppw", IdentityFiles: []string{"/p_id"},
+			Timeout: 3 * time.Second, HostKeyCheck: HostKeyAcceptNew, Insecure: true, Jump: "gw",
+		}},
+		{"命令行参数优先", "r1", map[string]string{"user": "fuser", "port": "2022", "host-key-check": HostKeyStrict}, CLIOptionsBase{
+			Host: "r1.lab", Port: "2022", User: "fuser", Password: "ppw", IdentityFiles: []string{"/p_id"},
+			Timeout: 3 * time.Second, HostKeyCheck: HostKeyStrict, Jump: "gw",
+		}},
+		{"只有 ssh config", "c1", nil, CLIOptionsBase{
+			Host: "c1", Port: "2200", User: "cuser", IdentityFiles: []string{"/c_id"},
+			Timeout: 7 * time.Second, HostKeyCheck: HostKeyAcceptNew, Insecure: true, Jump: "gw",
+		}},
+		{"都没有", "other", nil, CLIOptionsBase{
+			Host: "other", Port: "22", Timeout: 10 * time.Second, HostKeyCheck: HostKeyAcceptNew,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := defaults()
+			base.Host = tt.host
+			set := map[string]bool{}
+			for name, value := range tt.flags {
+				set[name] = true
+				switch name {
+				case "user":
+					base.User = value
+				case "port":
+					base.Port = value
+				case "host-key-check":
+					base.HostKeyCheck = value
+				}
+			}
+			if err := base.applyHostConfig(set); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.want.ProfileFile, tt.want.SSHConfigFile = profiles, config
+			if !reflect.DeepEqual(base, tt.want) {
+				t.Errorf("结果 = %+v\n期望   %+v", base, tt.want)
+			}
+		})
+	}
+}
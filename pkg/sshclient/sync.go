@@ -0,0 +1,433 @@
+package sshclient
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"common_tool/pkg/errorutil"
+	"common_tool/pkg/logutil"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/sftp"
+	"github.com/spf13/cobra"
+)
+
+// 同步的方向
+const (
+	SyncPush = "push" // 本地 -> 远端
+	SyncPull = "pull" // 远端 -> 本地
+)
+
+type CLIOptionsSync struct {
+	CLIOptionsBase
+	LocalPath  string
+	RemotePath string
+	Direction  string
+	// 大小相同时比较 sha256，而不是修改时间
+	Checksum bool
+	Include  []string
+	Exclude  []string
+	// 删除目标中源没有的文件
+	Delete bool
+	DryRun bool
+}
+
+// 目录中的一项，mtime 精确到秒(SFTP 的时间精度)
+type syncEntry struct {
+	size  int64
+	mtime int64
+	dir   bool
+}
+
+// --exclude 匹配的文件和目录(包括目录下的所有内容)不同步也不删除
+// 有 --include 时只同步匹配的文件，目录总是遍历
+// 模式中没有 / 时匹配文件名，否则匹配相对路径，语法和 path.Match 相同
+type syncFilter struct {
+	include []string
+	exclude []string
+}
+
+func matchSyncPattern(pattern, rel string) bool {
+	if strings.Contains(pattern, "/") {
+		ok, _ := path.Match(strings.TrimPrefix(pattern, "/"), rel)
+		return ok
+	}
+	ok, _ := path.Match(pattern, path.Base(rel))
+	return ok
+}
+
+func (f syncFilter) skip(rel string, dir bool) bool {
+	for _, p := range f.exclude {
+		if matchSyncPattern(p, rel) {
+			return true
+		}
+	}
+	if dir || len(f.include) == 0 {
+		return false
+	}
+	for _, p := range f.include {
+		if matchSyncPattern(p, rel) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f syncFilter) validate() error {
+	for _, p := range append(append([]string{}, f.include...), f.exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage, fmt.Sprintf("无效的模式: %q", p), err)
+		}
+	}
+	return nil
+}
+
+// 本地目录的内容，key 是 / 分隔的相对路径，忽略符号链接(和 tftp_send 相同)
+func listLocalTree(root string, filter syncFilter) (map[string]syncEntry, error) {
+	entries := map[string]syncEntry{}
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return entries, nil
+	}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root || info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if filter.skip(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		entries[rel] = syncEntry{size: info.Size(), mtime: info.ModTime().Unix(), dir: info.IsDir()}
+		return nil
+	})
+	return entries, err
+}
+
+func listRemoteTree(client *sftp.Client, root string, filter syncFilter) (map[string]syncEntry, error) {
+	entries := map[string]syncEntry{}
+	if _, err := client.Stat(root); os.IsNotExist(err) {
+		return entries, nil
+	}
+	walker := client.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, err
+		}
+		info := walker.Stat()
+		if walker.Path() == root || info == nil || info.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		rel, err := RelativeRemotePath(root, walker.Path())
+		if err != nil {
+			return nil, err
+		}
+		if filter.skip(rel, info.IsDir()) {
+			if info.IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+		entries[rel] = syncEntry{size: info.Size(), mtime: info.ModTime().Unix(), dir: info.IsDir()}
+	}
+	return entries, nil
+}
+
+type syncStats struct {
+	copied      int
+	unchanged   int
+	deleted     int
+	bytesCopied int64
+	bytesSaved  int64
+}
+
+// 同步 LocalPath 和 RemotePath 两个目录，只传输有变化的文件
+func (opts *CLIOptionsSync) RunSync() error {
+	if opts.Direction != SyncPush && opts.Direction != SyncPull {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage,
+			fmt.Sprintf("未知的同步方向: %q", opts.Direction),
+			fmt.Errorf("--direction 只能是 %s / %s", SyncPush, SyncPull))
+	}
+	if opts.LocalPath == "" || opts.RemotePath == "" {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage,
+			"需要指定 -L 和 -R", fmt.Errorf("missing path"))
+	}
+	filter := syncFilter{include: opts.Include, exclude: opts.Exclude}
+	if err := filter.validate(); err != nil {
+		return err
+	}
+
+	client, err := createSSHAndSFTP(opts.CLIOptionsBase)
+	if err != nil {
+		return connectError("SFTP 初始化失败", err)
+	}
+	defer client.Close()
+
+	localRoot := filepath.Clean(opts.LocalPath)
+	remoteRoot := path.Clean(opts.RemotePath)
+	srcRoot := localRoot
+	var srcInfo os.FileInfo
+	if opts.Direction == SyncPush {
+		srcInfo, err = os.Stat(localRoot)
+	} else {
+		srcRoot = remoteRoot
+		srcInfo, err = client.SFTP.Stat(remoteRoot)
+	}
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeMissingInput, fmt.Sprintf("源目录 %s 无法访问", srcRoot), err)
+	}
+	if !srcInfo.IsDir() {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeInvalidUsage,
+			fmt.Sprintf("%s 不是目录，单个文件请使用 tftp_send / tftp_get", srcRoot), fmt.Errorf("not a directory"))
+	}
+
+	local, err := listLocalTree(localRoot, filter)
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeIOError, "读取本地目录失败", err)
+	}
+	remote, err := listRemoteTree(client.SFTP, remoteRoot, filter)
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeSSHError, "读取远端目录失败", err)
+	}
+	src, dst := local, remote
+	if opts.Direction == SyncPull {
+		src, dst = remote, local
+	}
+
+	fmt.Println()
+	fmt.Printf("Syncing (%s): %s <-> %s:%s\n", opts.Direction, localRoot, opts.Host, remoteRoot)
+	fmt.Println()
+
+	if !opts.DryRun {
+		if err := opts.mkdir(client.SFTP, ""); err != nil {
+			return err
+		}
+	}
+
+	stats := syncStats{}
+	for _, rel := range sortedKeys(src) {
+		s := src[rel]
+		d, exists := dst[rel]
+		if s.dir {
+			if !exists && !opts.DryRun {
+				if err := opts.mkdir(client.SFTP, rel); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if exists && d.dir {
+			logutil.Warn("%s 在目标中是目录，跳过", rel)
+			continue
+		}
+
+		changed, err := opts.changed(client, rel, s, d, exists)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			stats.unchanged++
+			stats.bytesSaved += s.size
+			continue
+		}
+
+		mark := "*"
+		if !exists {
+			mark = "+"
+		}
+		stats.copied++
+		stats.bytesCopied += s.size
+		if opts.DryRun {
+			fmt.Printf("%s %s (%s)\n", mark, rel, humanize.Bytes(uint64(s.size)))
+			continue
+		}
+		if err := opts.copyFile(client, localRoot, remoteRoot, rel); err != nil {
+			return err
+		}
+	}
+
+	if opts.Delete {
+		if err := opts.deleteExtraneous(client.SFTP, localRoot, remoteRoot, src, dst, &stats); err != nil {
+			return err
+		}
+	}
+
+	total := stats.bytesCopied + stats.bytesSaved
+	percent := 0.0
+	if total > 0 {
+		percent = float64(stats.bytesSaved) / float64(total) * 100
+	}
+	prefix := ""
+	if opts.DryRun {
+		prefix = "(dry-run) "
+	}
+	fmt.Printf("\n%s传输 %d 个文件(%s)，未变化 %d 个，删除 %d 个，节省 %s(%.1f%%)\n",
+		prefix, stats.copied, humanize.Bytes(uint64(stats.bytesCopied)), stats.unchanged, stats.deleted,
+		humanize.Bytes(uint64(stats.bytesSaved)), percent)
+	return nil
+}
+
+// 大小不同时一定传输，大小相同时比较 sha256(--checksum) 或者修改时间
+func (opts *CLIOptionsSync) changed(client *SSHSFTPClient, rel string, s, d syncEntry, exists bool) (bool, error) {
+	if !exists || s.size != d.size {
+		return true, nil
+	}
+	if !opts.Checksum {
+		return s.mtime != d.mtime, nil
+	}
+
+	localPath := filepath.Join(opts.LocalPath, filepath.FromSlash(rel))
+	remotePath := path.Join(opts.RemotePath, rel)
+	localSum, err := localSHA256(localPath)
+	if err != nil {
+		return false, errorutil.NewExitErrorWithMessage(errorutil.CodeIOError, fmt.Sprintf("计算本地文件 %s 的 sha256 失败", localPath), err)
+	}
+	remoteSum, err := remoteSHA256(client.SSH, client.SFTP, remotePath)
+	if err != nil {
+		return false, errorutil.NewExitErrorWithMessage(errorutil.CodeSSHError, fmt.Sprintf("计算远端文件 %s 的 sha256 失败", remotePath), err)
+	}
+	return localSum != remoteSum, nil
+}
+
+// 在目标中创建目录，rel 为空时是根目录
+func (opts *CLIOptionsSync) mkdir(client *sftp.Client, rel string) error {
+	var err error
+	if opts.Direction == SyncPush {
+		err = client.MkdirAll(path.Join(opts.RemotePath, rel))
+	} else {
+		err = os.MkdirAll(filepath.Join(opts.LocalPath, filepath.FromSlash(rel)), 0755)
+	}
+	if err != nil {
+		return errorutil.NewExitErrorWithMessage(errorutil.CodeIOError, fmt.Sprintf("创建目录 %s 失败", rel), err)
+	}
+	return nil
+}
+
+// 使用 tftp_send / tftp_get 相同的传输(带进度)，传输后目标的修改时间和源相同
+func (opts *CLIOptionsSync) copyFile(client *SSHSFTPClient, localRoot, remoteRoot, rel string) error {
+	localPath := filepath.Join(localRoot, filepath.FromSlash(rel))
+	remotePath := path.Join(remoteRoot, rel)
+	topt := transferOptions{SSH: client.SSH}
+
+	var err error
+	if opts.Direction == SyncPush {
+		absRoot, _ := filepath.Abs(localRoot)
+		err = uploadFile(client.SFTP, localPath, remotePath, absRoot, topt)
+	} else {
+		err = downloadFile(client.SFTP, remotePath, localPath, remoteRoot, topt)
+	}
+	if err != nil && !errorutil.HasExitCode(err) {
+		err = errorutil.NewExitErrorWithMessage(errorutil.CodeIOError, fmt.Sprintf("同步 %s 失败", rel), err)
+	}
+	return err
+}
+
+// 删除目标中源没有的文件和目录，被 --exclude 排除的不删除
+// 先删除文件，再从最深的目录开始删除，目录中还有被排除的文件时保留目录
+func (opts *CLIOptionsSync) deleteExtraneous(client *sftp.Client, localRoot, remoteRoot string,
+	src, dst map[string]syncEntry, stats *syncStats) error {
+	var files, dirs []string
+	for _, rel := range sortedKeys(dst) {
+		if _, ok := src[rel]; ok {
+			continue
+		}
+		if dst[rel].dir {
+			dirs = append(dirs, rel)
+		} else {
+			files = append(files, rel)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+
+	remove := func(rel string, dir bool) error {
+		if opts.Direction == SyncPush {
+			if dir {
+				return client.RemoveDirectory(path.Join(remoteRoot, rel))
+			}
+			return client.Remove(path.Join(remoteRoot, rel))
+		}
+		return os.Remove(filepath.Join(localRoot, filepath.FromSlash(rel)))
+	}
+
+	for _, rel := range files {
+		fmt.Printf("- %s\n", rel)
+		stats.deleted++
+		if opts.DryRun {
+			continue
+		}
+		if err := remove(rel, false); err != nil {
+			return errorutil.NewExitErrorWithMessage(errorutil.CodeIOError, fmt.Sprintf("删除 %s 失败", rel), err)
+		}
+	}
+	for _, rel := range dirs {
+		fmt.Printf("- %s/\n", rel)
+		stats.deleted++
+		if opts.DryRun {
+			continue
+		}
+		if err := remove(rel, true); err != nil {
+			logutil.Warn("删除目录 %s 失败(可能有被排除的文件): %v", rel, err)
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]syncEntry) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sshSyncCmd() *cobra.Command {
+	opts := &CLIOptionsSync{}
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "同步本地和远端的目录(SFTP)，只传输有变化的文件",
+		Long: `同步本地和远端的目录(SFTP)，只传输有变化的文件，类似 rsync
+--direction push 本地 -L 同步到远端 -R(默认)，pull 远端 -R 同步到本地 -L
+文件大小不同时传输，大小相同时比较修改时间(精确到秒)，--checksum 时比较 sha256
+传输后目标文件的修改时间和源相同，下次同步时不会再传输
+
+--exclude 排除匹配的文件和目录(目录下的所有内容)，被排除的文件不同步也不删除
+--include 只同步匹配的文件，可以和 --exclude 一起使用(--exclude 优先)
+模式中没有 / 时匹配文件名，否则匹配相对路径，* ? [] 的语法和 path.Match 相同
+--delete  删除目标中源没有的文件和目录
+--dry-run 只列出要做的操作: + 新建  * 更新  - 删除
+最后输出传输、未变化和删除的文件数，以及未变化的文件节省的传输量
+举例:
+gobolt ssh sync -H bmc1 -L ./firmware -R /opt/firmware --exclude '*.tmp' --exclude .git --delete
+gobolt ssh sync -H bmc1 -L ./logs -R /var/log/app --direction pull --include '*.log' --dry-run
+		`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return opts.RunSync()
+		},
+	}
+
+	bindCommonSSHFlags(cmd, &opts.CLIOptionsBase)
+	cmd.Flags().StringVarP(&opts.LocalPath, "local", "L", "", "本地目录")
+	cmd.Flags().StringVarP(&opts.RemotePath, "remote", "R", "", "远端目录")
+	cmd.Flags().StringVar(&opts.Direction, "direction", SyncPush, "同步方向(push|pull)")
+	cmd.Flags().BoolVar(&opts.Checksum, "checksum", false, "大小相同时比较 sha256，而不是修改时间")
+	cmd.Flags().StringArrayVar(&opts.Include, "include", nil, "只同步匹配的文件，可以重复指定多个")
+	cmd.Flags().StringArrayVar(&opts.Exclude, "exclude", nil, "排除匹配的文件和目录，可以重复指定多个")
+	cmd.Flags().BoolVar(&opts.Delete, "delete", false, "删除目标中源没有的文件和目录")
+	cmd.Flags().BoolVarP(&opts.DryRun, "dry-run", "n", false, "只列出要做的操作，不实际执行")
+
+	return cmd
+}
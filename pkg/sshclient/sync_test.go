@@ -0,0 +1,129 @@
+package sshclient
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"common_tool/pkg/errorutil"
+)
+
+func TestMatchSyncPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		// 没有 / 时匹配任何一级的文件名
+		{"*.log", "a.log", true},
+		{"*.log", "dir/sub/a.log", true},
+		{"*.log", "a.log.bak", false},
+		{"cache", "x/cache", true},
+		{"cache", "x/cache/y", false},
+		// 有 / 时匹配整个相对路径，开头的 / 可以省略
+		{"dir/*.log", "dir/a.log", true},
+		{"dir/*.log", "dir/sub/a.log", false},
+		{"dir/*.log", "other/dir/a.log", false},
+		{"/dir/a.log", "dir/a.log", true},
+		{"*/a.log", "x/a.log", true},
+		{"[ab].txt", "b.txt", true},
+		{"[", "[", false},
+	}
+	for _, tt := range tests {
+		if got := matchSyncPattern(tt.pattern, tt.rel); got != tt.want {
+			t.Errorf("matchSyncPattern(%q, %q) = %v，期望 %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestSyncFilterSkip(t *testing.T) {
+	tests := []struct {
+		include []string
+		exclude []string
+		rel     string
+		dir     bool
+		want    bool
+	}{
+		{nil, nil, "a.txt", false, false},
+		{nil, []string{"*.log"}, "a.log", false, true},
+		{nil, []string{"build"}, "build", true, true},
+		{nil, []string{"build"}, "src/build", true, true},
+		// 有 --include 时只同步匹配的文件
+		{[]string{"*.go"}, nil, "main.go", false, false},
+		{[]string{"*.go"}, nil, "README.md", false, true},
+		// 目录不受 --include 影响，否则目录下匹配的文件也同步不到
+		{[]string{"*.go"}, nil, "pkg", true, false},
+		// --exclude 优先于 --include
+		{[]string{"*.go"}, []string{"*_test.go"}, "a_test.go", false, true},
+		{[]string{"*.go"}, []string{"vendor"}, "vendor", true, true},
+		{[]string{"*.go", "*.mod"}, nil, "go.mod", false, false},
+	}
+	for _, tt := range tests {
+		f := syncFilter{include: tt.include, exclude: tt.exclude}
+		if got := f.skip(tt.rel, tt.dir); got != tt.want {
+			t.Errorf("include=%q exclude=%q skip(%q, dir=%v) = %v，期望 %v",
+				tt.include, tt.exclude, tt.rel, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestSyncFilterValidate(t *testing.T) {
+	if err := (syncFilter{include: []string{"*.go"}, exclude: []string{"a/[bc]"}}).validate(); err != nil {
+		t.Errorf("有效的模式返回错误: %v", err)
+	}
+	err := (syncFilter{exclude: []string{"a[b"}}).validate()
+	var exitErr *errorutil.ExitErrorWithCode
+	if !errors.As(err, &exitErr) || exitErr.Code != errorutil.CodeInvalidUsage {
+		t.Errorf("无效的模式应该返回 CodeInvalidUsage，得到 %v", err)
+	}
+}
+
+// 排除的目录整个跳过，其下的文件即使匹配 --include 也不列出
+func TestListLocalTreeFilter(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"src/sub", "build/out", "docs"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{
+		"main.go", "main_test.go", "README.md",
+		"src/a.go", "src/sub/b.go", "src/sub/notes.txt",
+		"build/out/gen.go", "docs/x.md",
+	} {
+		writeTestFile(t, root, name, name)
+	}
+	if err := os.Symlink(filepath.Join(root, "main.go"), filepath.Join(root, "link.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := syncFilter{include: []string{"*.go"}, exclude: []string{"build", "*_test.go"}}
+	entries, err := listLocalTree(root, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for rel := range entries {
+		got = append(got, rel)
+	}
+	sort.Strings(got)
+	// 没有匹配文件的目录也会列出，符号链接忽略
+	want := []string{"docs", "main.go", "src", "src/a.go", "src/sub", "src/sub/b.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listLocalTree = %q，期望 %q", got, want)
+	}
+	if e := entries["main.go"]; e.dir || e.size != int64(len("main.go")) {
+		t.Errorf("main.go 的信息 = %+v", e)
+	}
+	if !entries["src"].dir {
+		t.Errorf("src 应该是目录")
+	}
+
+	entries, err = listLocalTree(filepath.Join(root, "missing"), filter)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("不存在的目录应该返回空的列表: %v %v", entries, err)
+	}
+}
@@ -0,0 +1,71 @@
+//go:build windows
+
+package sshclient
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+type termState struct {
+	mode uint32
+}
+
+func isTerminal(fd int) bool {
+	var mode uint32
+	return windows.GetConsoleMode(windows.Handle(fd), &mode) == nil
+}
+
+// 关闭回显和行输入，打开 VT 输入，方向键等按 VT100 序列发送到远端
+func makeRaw(fd int) (*termState, error) {
+	var mode uint32
+	if err := windows.GetConsoleMode(windows.Handle(fd), &mode); err != nil {
+		return nil, err
+	}
+	raw := mode &^ (windows.ENABLE_ECHO_INPUT | windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT | windows.ENABLE_PROCESSED_OUTPUT)
+	raw |= windows.ENABLE_VIRTUAL_TERMINAL_INPUT
+	if err := windows.SetConsoleMode(windows.Handle(fd), raw); err != nil {
+		return nil, err
+	}
+	return &termState{mode: mode}, nil
+}
+
+func restoreTerm(fd int, state *termState) error {
+	return windows.SetConsoleMode(windows.Handle(fd), state.mode)
+}
+
+func terminalSize(fd int) (width, height int, err error) {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(fd), &info); err != nil {
+		return 0, 0, err
+	}
+	return int(info.Window.Right - info.Window.Left + 1), int(info.Window.Bottom - info.Window.Top + 1), nil
+}
+
+// Windows 没有 SIGWINCH，定时检查窗口大小
+func notifyResize(fd int, ch chan<- struct{}) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		w, h, _ := terminalSize(fd)
+		for {
+			select {
+			case <-ticker.C:
+				nw, nh, err := terminalSize(fd)
+				if err != nil || (nw == w && nh == h) {
+					continue
+				}
+				w, h = nw, nh
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}